@@ -6,10 +6,12 @@ require (
 	github.com/bogem/id3v2 v1.2.0
 	github.com/dhowden/tag v0.0.0-20191122115059-7e5c04feccd8
 	github.com/faiface/beep v1.0.3-0.20200712202812-d836f29bdc50
+	github.com/fsnotify/fsnotify v1.5.4
 	github.com/gdamore/tcell v1.3.0
 	github.com/rivo/tview v0.0.0-20200404204604-ca37f83cb2e7
 	github.com/sirupsen/logrus v1.5.0
 	github.com/stretchr/testify v1.4.0
+	golang.org/x/sys v0.0.0-20220811171246-fbc7d0a398ab
 	gopkg.in/yaml.v2 v2.3.0
 )
 
@@ -32,6 +34,5 @@ require (
 	golang.org/x/exp v0.0.0-20190306152737-a1d7652674e8 // indirect
 	golang.org/x/image v0.0.0-20190227222117-0694c2d4d067 // indirect
 	golang.org/x/mobile v0.0.0-20190415191353-3e0bab5405d6 // indirect
-	golang.org/x/sys v0.0.0-20220811171246-fbc7d0a398ab // indirect
 	golang.org/x/text v0.3.3 // indirect
 )
@@ -18,25 +18,255 @@ type Config struct {
 	LogToFile         bool   `yaml:"log_to_file"`
 	LogFile           string `yaml:"log_file"`
 	LogLevel          string `yaml:"log_level"`
-	Columns           []string
-	KeyboardShortcuts map[string]string
+	IndexFile         string `yaml:"index_file"`
+	StoreFile         string `yaml:"store_file"`
+	HistoryFile       string `yaml:"history_file"`
+	Libraries         []LibraryConfig
+	Columns           []ColumnConfig
+	ColumnSets        map[string][]ColumnConfig `yaml:"column_sets"`
+	Sort              []string
+	KeyboardShortcuts map[string]string `yaml:"keyboard_shortcuts"`
+
+	// OrganizeTemplate is the layout files are moved into by grump organize,
+	// eg: "{albumartist}/{year} - {album}/{track:02} {title}.{ext}"
+	OrganizeTemplate string `yaml:"organize_template"`
+
+	// PathPattern reads tags from the paths of untagged files, eg:
+	// "{artist}/{album}/{track} - {title}"
+	PathPattern string `yaml:"path_pattern"`
+
+	// Artwork is how cover art is drawn: auto, kitty, sixel, blocks or off
+	Artwork string
+
+	// PlayCount decides when a playing track counts as played
+	PlayCount PlayCountConfig `yaml:"play_count"`
+
+	// Ratings decides where ratings are kept
+	Ratings RatingsConfig
+
+	// Trash decides what happens to deleted tracks
+	Trash TrashConfig
+
+	// ReplayGain decides how loud tracks are played
+	ReplayGain ReplayGainConfig `yaml:"replay_gain"`
 
 	loggers []io.Writer
 }
 
+// UnmarshalYAML reads a config, including keys that have since been renamed
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// alias avoids recursing back into this method
+	type plain Config
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+
+	old := struct {
+		KeyboardShortcuts map[string]string `yaml:"keyboardshortcuts"`
+	}{}
+	err = unmarshal(&old)
+	if err != nil {
+		return err
+	}
+
+	if len(old.KeyboardShortcuts) > 0 {
+		log.Warn("config key keyboardshortcuts is deprecated, use keyboard_shortcuts")
+		if c.KeyboardShortcuts == nil {
+			c.KeyboardShortcuts = map[string]string{}
+		}
+
+		// the new key wins where both set an action
+		for action, key := range old.KeyboardShortcuts {
+			if _, ok := c.KeyboardShortcuts[action]; !ok {
+				c.KeyboardShortcuts[action] = key
+			}
+		}
+	}
+
+	return nil
+}
+
+// LibraryConfig is a directory of audio files to add to the library
+type LibraryConfig struct {
+	Path     string
+	ReadOnly bool `yaml:"read_only"`
+
+	// Exclude is a list of glob patterns for files and directories to skip
+	Exclude []string
+}
+
+// ColumnConfig is a track table column. Zero values use the column's default
+// layout.
+type ColumnConfig struct {
+	// Name is a track field, eg: artist, year, length
+	Name string
+
+	// Width is the maximum width of the column in cells
+	Width int
+
+	// Expansion is the share of leftover space the column grows into
+	Expansion int
+
+	// Align is one of left, center or right
+	Align string
+}
+
+// UnmarshalYAML allows a column to be given as just its name, eg: "- artist"
+func (cc *ColumnConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*cc = ColumnConfig{Name: name}
+		return nil
+	}
+
+	// alias avoids recursing back into this method
+	type plain ColumnConfig
+	return unmarshal((*plain)(cc))
+}
+
+// PlayCountConfig is how much of a track has to be heard for it to count as
+// played. Whichever threshold is reached first counts.
+type PlayCountConfig struct {
+	// Percent of the track's length
+	Percent int
+
+	// Seconds of listening, for long tracks
+	Seconds int
+}
+
+// RatingsConfig decides where ratings are kept. Ratings are written to the
+// file's tags where possible, and otherwise to the store.
+type RatingsConfig struct {
+	// Precedence is which rating wins when a file's tags and the store
+	// disagree: tag or store
+	Precedence string
+
+	// Profile names how ratings are stored in ID3 POPM frames, either a
+	// built-in profile (grump, wmp, mediamonkey, musicbee, foobar2000) or one
+	// from Profiles
+	Profile string
+
+	// Profiles are custom rating profiles, by name
+	Profiles map[string]RatingProfileConfig
+}
+
+// RatingProfileConfig describes how another player stores ratings in POPM
+// frames
+type RatingProfileConfig struct {
+	// Email is written to grump's POPM frame
+	Email string
+
+	// ReadEmails limits which POPM frames are read, empty reads them all
+	ReadEmails []string `yaml:"read_emails"`
+
+	// Frames picks a frame when there are several: own, highest, first or
+	// last
+	Frames string
+
+	// Steps maps star scores to POPM bytes
+	Steps []RatingStepConfig
+}
+
+// RatingStepConfig maps a star score to the POPM byte written for it, and
+// the lowest byte read as it
+type RatingStepConfig struct {
+	Stars float64
+	Byte  uint8
+	Min   uint8
+}
+
+// TrashConfig is where deleted tracks go, so they can be restored
+type TrashConfig struct {
+	// Dir is a trash directory in the freedesktop.org layout, the user's
+	// trash by default. Empty deletes files right away.
+	Dir string
+
+	// Cleanup removes sidecar files left without a track (lyrics, cue
+	// sheets and the cover of an album's last track) and empty directories
+	// along with deleted tracks
+	Cleanup bool
+}
+
+// ReplayGainConfig is how ReplayGain is applied to tracks as they play
+type ReplayGainConfig struct {
+	// Mode is which gain is applied: track, album or off
+	Mode string
+
+	// Preamp is added to the gain, in dB
+	Preamp float64
+}
+
 // DefaultConfig is (you guessed it) default application config.
 func DefaultConfig() *Config {
 	return &Config{
-		LogLevel:  "warn",
-		LogToFile: false,
-		LogFile:   "grump.log",
-		Columns: []string{
-			"artist",
-			"album",
-			"title",
-			"rating",
+		LogLevel:    "warn",
+		LogToFile:   false,
+		LogFile:     "grump.log",
+		IndexFile:   defaultIndexFile(),
+		StoreFile:   defaultDataFile("store.json"),
+		HistoryFile: defaultDataFile("history.jsonl"),
+		PlayCount: PlayCountConfig{
+			Percent: 50,
+			Seconds: 240,
+		},
+		Ratings: RatingsConfig{
+			Precedence: "tag",
+			Profile:    "grump",
 		},
+		Trash: TrashConfig{
+			Dir: defaultTrashDir(),
+		},
+		ReplayGain: ReplayGainConfig{
+			Mode: "track",
+		},
+		Columns: []ColumnConfig{
+			{Name: "artist"},
+			{Name: "album"},
+			{Name: "title"},
+			{Name: "rating"},
+		},
+	}
+}
+
+// defaultIndexFile returns the default location of the library index
+func defaultIndexFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		log.WithError(err).Debug("could not determine user cache directory")
+		return ""
+	}
+
+	return filepath.Join(dir, "grump", "index.json")
+}
+
+// defaultDataFile returns the default location of a file grump keeps data
+// in. Unlike the index this can not be rebuilt, so it lives with the config
+// rather than the cache.
+func defaultDataFile(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		log.WithError(err).Debug("could not determine user config directory")
+		return ""
 	}
+
+	return filepath.Join(dir, "grump", name)
+}
+
+// defaultTrashDir returns the user's trash, as described by the
+// freedesktop.org trash spec
+func defaultTrashDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "Trash")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.WithError(err).Debug("could not determine user home directory")
+		return ""
+	}
+
+	return filepath.Join(home, ".local", "share", "Trash")
 }
 
 // Setup setups up application configuration
@@ -100,7 +330,8 @@ func loadConfig(ctx context.Context) (*Config, error) {
 }
 
 func homeConfig(ctx context.Context) (*Config, error) {
-	c := &Config{}
+	// start with defaults so the config file only needs to contain overrides
+	c := DefaultConfig()
 
 	usr, err := user.Current()
 	if err != nil {
@@ -124,6 +355,40 @@ func homeConfig(ctx context.Context) (*Config, error) {
 	return c, nil
 }
 
+// LibraryRoots combines directories given on the command line with those in
+// the config file. Command line directories that are also in the config file
+// keep their configured options.
+func (c *Config) LibraryRoots(args []string) []LibraryConfig {
+	roots := []LibraryConfig{}
+	seen := map[string]bool{}
+
+	add := func(lc LibraryConfig) {
+		key := filepath.Clean(lc.Path)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		roots = append(roots, lc)
+	}
+
+	for _, arg := range args {
+		lc := LibraryConfig{Path: arg}
+		for _, configured := range c.Libraries {
+			if filepath.Clean(configured.Path) == filepath.Clean(arg) {
+				lc = configured
+				break
+			}
+		}
+		add(lc)
+	}
+
+	for _, lc := range c.Libraries {
+		add(lc)
+	}
+
+	return roots
+}
+
 // Loggers returns a slice of loggers to use in the application
 func (c *Config) Loggers() []io.Writer {
 	return c.loggers
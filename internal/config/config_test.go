@@ -0,0 +1,63 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/dhulihan/grump/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestLibraryRoots(t *testing.T) {
+	c := config.DefaultConfig()
+	c.Libraries = []config.LibraryConfig{
+		{Path: "/music/nas", ReadOnly: true},
+		{Path: "/music/local", Exclude: []string{"*.tmp"}},
+	}
+
+	roots := c.LibraryRoots([]string{"/music/local/", "/music/new"})
+
+	assert.Equal(t, []config.LibraryConfig{
+		{Path: "/music/local", Exclude: []string{"*.tmp"}},
+		{Path: "/music/new"},
+		{Path: "/music/nas", ReadOnly: true},
+	}, roots)
+
+	assert.Empty(t, config.DefaultConfig().LibraryRoots(nil))
+}
+
+func TestColumnConfigYAML(t *testing.T) {
+	c := config.Config{}
+	err := yaml.Unmarshal([]byte(`
+columns:
+  - artist
+  - name: year
+    width: 4
+    align: right
+column_sets:
+  minimal: [title]
+`), &c)
+	require.NoError(t, err)
+
+	assert.Equal(t, []config.ColumnConfig{
+		{Name: "artist"},
+		{Name: "year", Width: 4, Align: "right"},
+	}, c.Columns)
+	assert.Equal(t, []config.ColumnConfig{{Name: "title"}}, c.ColumnSets["minimal"])
+}
+
+func TestDeprecatedKeyboardShortcuts(t *testing.T) {
+	c := config.DefaultConfig()
+	err := yaml.Unmarshal([]byte(`
+keyboardshortcuts:
+  quit: Q
+  help: H
+keyboard_shortcuts:
+  help: "?"
+`), c)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{"quit": "Q", "help": "?"}, c.KeyboardShortcuts)
+	assert.Equal(t, "warn", c.LogLevel)
+}
@@ -0,0 +1,337 @@
+package library
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	// register decoders for image.DecodeConfig
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/bogem/id3v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// pictureFrontCover is the ID3/FLAC picture type of a front cover
+	pictureFrontCover = 3
+
+	// vorbisPictureKey holds a base64 encoded FLAC picture block
+	vorbisPictureKey = "METADATA_BLOCK_PICTURE"
+)
+
+// ErrNoArtwork is returned when a track has no embedded or folder artwork
+var ErrNoArtwork = errors.New("no artwork found")
+
+// folderArtworkNames are the image names looked for next to a track, in
+// order of preference
+var folderArtworkNames = []string{"cover", "folder", "front", "album"}
+
+// folderArtworkExts are the image types looked for next to a track
+var folderArtworkExts = []string{".jpg", ".jpeg", ".png"}
+
+// Artwork is a cover image for a track
+type Artwork struct {
+	Data     []byte
+	MimeType string
+	Width    int
+	Height   int
+
+	// Source is the file the image was read from, either the track itself
+	// or an image next to it
+	Source string
+}
+
+// Artwork returns the cover art of a track. Embedded images are preferred,
+// front covers first, then images like cover.jpg in the track's directory.
+// Nothing is cached, artwork is read from disk on every call.
+func (t Track) Artwork() (*Artwork, error) {
+	// tags that can not be parsed should not hide a cover.jpg
+	art, err := embeddedArtwork(t.Path)
+	if err != nil {
+		log.WithError(err).WithField("path", t.Path).Warn("could not read embedded artwork, looking for folder artwork")
+	}
+
+	if art == nil {
+		art, err = folderArtwork(filepath.Dir(t.Path))
+		if err != nil {
+			return nil, fmt.Errorf("could not read folder artwork [%s]: [%s]", t.Path, err.Error())
+		}
+	}
+
+	if art == nil {
+		return nil, ErrNoArtwork
+	}
+
+	art.describe()
+	return art, nil
+}
+
+// describe fills in the dimensions and MIME type from the image itself, as
+// embedded values are often missing or wrong (eg: image/jpg)
+func (a *Artwork) describe() {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(a.Data))
+	if err != nil {
+		return
+	}
+
+	a.Width = cfg.Width
+	a.Height = cfg.Height
+	a.MimeType = "image/" + format
+}
+
+// embeddedArtwork returns the preferred picture embedded in a file, or nil
+// if it has none
+func embeddedArtwork(path string) (*Artwork, error) {
+	var pictures []picture
+	var err error
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		pictures, err = mp3Pictures(path)
+	case ".flac":
+		pictures, err = flacPictures(path)
+	case ".ogg":
+		pictures, err = oggPictures(path)
+	case ".wav":
+		pictures, err = wavPictures(path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var art *Artwork
+	for _, p := range pictures {
+		if art == nil || p.kind == pictureFrontCover {
+			a := p.artwork
+			a.Source = path
+			art = &a
+		}
+		if p.kind == pictureFrontCover {
+			break
+		}
+	}
+
+	return art, nil
+}
+
+// picture is an embedded image and its ID3/FLAC picture type
+type picture struct {
+	artwork Artwork
+	kind    uint32
+}
+
+func mp3Pictures(path string) ([]picture, error) {
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true, ParseFrames: []string{"Attached picture"}})
+	if err != nil {
+		return nil, err
+	}
+	defer tag.Close()
+
+	return id3Pictures(tag), nil
+}
+
+func id3Pictures(tag *id3v2.Tag) []picture {
+	pictures := []picture{}
+	for _, f := range tag.GetFrames(tag.CommonID("Attached picture")) {
+		pf, ok := f.(id3v2.PictureFrame)
+		if !ok {
+			continue
+		}
+
+		pictures = append(pictures, picture{
+			artwork: Artwork{Data: pf.Picture, MimeType: pf.MimeType},
+			kind:    uint32(pf.PictureType),
+		})
+	}
+	return pictures
+}
+
+func wavPictures(path string) ([]picture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	chunks, err := readRIFFChunks(f)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range chunks {
+		if !c.isID3() {
+			continue
+		}
+
+		tag, err := id3v2.ParseReader(bytes.NewReader(c.data), id3v2.Options{Parse: true})
+		if err != nil {
+			return nil, err
+		}
+		return id3Pictures(tag), nil
+	}
+
+	return nil, nil
+}
+
+func flacPictures(path string) ([]picture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	blocks, _, err := readFLACBlocks(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+
+	pictures := []picture{}
+	for _, b := range blocks {
+		if b.kind != flacPicture {
+			continue
+		}
+
+		p, err := decodeFLACPicture(b.data)
+		if err != nil {
+			return nil, err
+		}
+		pictures = append(pictures, p)
+	}
+	return pictures, nil
+}
+
+func oggPictures(path string) ([]picture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	_, headers, _, err := readOggHeaders(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+
+	vc, err := decodeVorbisComments(headers[0][len(vorbisCommentHeader):])
+	if err != nil {
+		return nil, err
+	}
+
+	pictures := []picture{}
+	for _, c := range vc.comments {
+		k, v := splitVorbisComment(c)
+		if !strings.EqualFold(k, vorbisPictureKey) {
+			continue
+		}
+
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode %s: [%s]", vorbisPictureKey, err.Error())
+		}
+
+		p, err := decodeFLACPicture(b)
+		if err != nil {
+			return nil, err
+		}
+		pictures = append(pictures, p)
+	}
+	return pictures, nil
+}
+
+// decodeFLACPicture parses a FLAC picture block, which vorbis comments also
+// use for embedded pictures
+func decodeFLACPicture(b []byte) (picture, error) {
+	r := bytes.NewReader(b)
+	p := picture{}
+
+	var mimeLen uint32
+	err := binary.Read(r, binary.BigEndian, &p.kind)
+	if err == nil {
+		err = binary.Read(r, binary.BigEndian, &mimeLen)
+	}
+	if err != nil || int64(mimeLen) > int64(r.Len()) {
+		return p, errors.New("truncated picture block")
+	}
+
+	mime := make([]byte, mimeLen)
+	r.Read(mime)
+
+	var descLen uint32
+	err = binary.Read(r, binary.BigEndian, &descLen)
+	if err != nil || int64(descLen) > int64(r.Len()) {
+		return p, errors.New("truncated picture block")
+	}
+	r.Seek(int64(descLen), io.SeekCurrent)
+
+	// width, height, depth, colors and data length
+	var fields [5]uint32
+	err = binary.Read(r, binary.BigEndian, &fields)
+	if err != nil || int64(fields[4]) > int64(r.Len()) {
+		return p, errors.New("truncated picture block")
+	}
+
+	data := make([]byte, fields[4])
+	r.Read(data)
+
+	p.artwork = Artwork{
+		Data:     data,
+		MimeType: string(mime),
+		Width:    int(fields[0]),
+		Height:   int(fields[1]),
+	}
+	return p, nil
+}
+
+// folderArtwork returns an image like cover.jpg from dir, or nil if there
+// is none. Names are matched ignoring case.
+func folderArtwork(dir string) (*Artwork, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		found[strings.ToLower(e.Name())] = e.Name()
+	}
+
+	for _, name := range folderArtworkNames {
+		for _, ext := range folderArtworkExts {
+			file, ok := found[name+ext]
+			if !ok {
+				continue
+			}
+
+			path := filepath.Join(dir, file)
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+
+			mime := "image/jpeg"
+			if ext == ".png" {
+				mime = "image/png"
+			}
+
+			return &Artwork{Data: data, MimeType: mime, Source: path}, nil
+		}
+	}
+
+	return nil, nil
+}
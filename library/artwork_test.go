@@ -0,0 +1,118 @@
+package library_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/bogem/id3v2"
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pngImage(t *testing.T, width, height int) []byte {
+	buf := &bytes.Buffer{}
+	require.NoError(t, png.Encode(buf, image.NewGray(image.Rect(0, 0, width, height))))
+	return buf.Bytes()
+}
+
+// pictureBlock builds a FLAC picture block with wrong dimensions, which
+// should be read from the image instead
+func pictureBlock(kind uint32, data []byte) []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, kind)
+	binary.Write(buf, binary.BigEndian, uint32(len("image/png")))
+	buf.WriteString("image/png")
+	binary.Write(buf, binary.BigEndian, uint32(len("cover")))
+	buf.WriteString("cover")
+	binary.Write(buf, binary.BigEndian, [4]uint32{1, 1, 24, 0})
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func writeOggPicture(t *testing.T, block []byte) string {
+	ident := append([]byte("\x01vorbis"), make([]byte, 23)...)
+	comment := vorbisComment("TITLE=Let It Happen", "METADATA_BLOCK_PICTURE="+base64.StdEncoding.EncodeToString(block))
+	comment = append(append([]byte("\x03vorbis"), comment...), 1)
+	setup := append([]byte("\x05vorbis"), bytes.Repeat([]byte{0xaa}, 30)...)
+	headers := append(append([]byte{}, comment...), setup...)
+
+	b := oggPage{flags: 0x02, segments: lacing(len(ident)), data: ident}.encode()
+	b = append(b, oggPage{sequence: 1, segments: append(lacing(len(comment)), lacing(len(setup))...), data: headers}.encode()...)
+	b = append(b, oggPage{flags: 0x04, sequence: 2, segments: lacing(3), data: []byte{1, 2, 3}}.encode()...)
+	return writeFile(t, "track.ogg", b)
+}
+
+func TestArtwork(t *testing.T) {
+	audio := bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x64}, 100)
+	front := pngImage(t, 3, 2)
+	back := pngImage(t, 1, 1)
+
+	mp3 := writeMP3(t, audio, 0, "")
+	tg, err := id3v2.Open(mp3, id3v2.Options{Parse: true})
+	require.NoError(t, err)
+	for _, p := range []id3v2.PictureFrame{
+		{PictureType: id3v2.PTBackCover, MimeType: "image/png", Picture: back},
+		{PictureType: id3v2.PTFrontCover, MimeType: "image/jpg", Picture: front},
+	} {
+		p.Encoding = tg.DefaultEncoding()
+		tg.AddAttachedPicture(p)
+	}
+	require.NoError(t, tg.Save())
+	tg.Close()
+
+	flac := writeFLAC(t, audio,
+		flacBlock(0, false, make([]byte, 34)),
+		flacBlock(6, false, pictureBlock(4, back)),
+		flacBlock(6, true, pictureBlock(3, front)),
+	)
+
+	// the only picture is used even if it is not a front cover
+	ogg := writeOggPicture(t, pictureBlock(0, front))
+
+	folder := writeFLAC(t, audio, flacBlock(0, true, make([]byte, 34)))
+	folderCover := filepath.Join(filepath.Dir(folder), "Folder.PNG")
+	require.NoError(t, ioutil.WriteFile(folderCover, front, 0644))
+
+	// a broken picture block still finds the folder's cover
+	broken := writeFLAC(t, audio,
+		flacBlock(0, false, make([]byte, 34)),
+		flacBlock(6, true, []byte{0, 0, 0, 3, 0xff}),
+	)
+	brokenCover := filepath.Join(filepath.Dir(broken), "cover.png")
+	require.NoError(t, ioutil.WriteFile(brokenCover, front, 0644))
+
+	var tests = []struct {
+		name   string
+		path   string
+		source string
+	}{
+		{"mp3", mp3, mp3},
+		{"flac", flac, flac},
+		{"ogg", ogg, ogg},
+		{"folder", folder, folderCover},
+		{"broken tags", broken, brokenCover},
+	}
+
+	for _, test := range tests {
+		art, err := library.Track{Path: test.path}.Artwork()
+		require.NoError(t, err, test.name)
+		assert.Equal(t, &library.Artwork{
+			Data:     front,
+			MimeType: "image/png",
+			Width:    3,
+			Height:   2,
+			Source:   test.source,
+		}, art, test.name)
+	}
+
+	_, err = library.Track{Path: writeFile(t, "track.mp3", audio)}.Artwork()
+	assert.Equal(t, library.ErrNoArtwork, err)
+}
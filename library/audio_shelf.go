@@ -12,9 +12,71 @@ type AudioShelf interface {
 
 	// LoadTracks fills the shelf with tracks
 	LoadTracks() (count uint64, err error)
+
+	// SetProgressFunc registers a callback that is notified as LoadTracks
+	// makes progress. It is never called concurrently.
+	SetProgressFunc(f ProgressFunc)
+
 	LoadTrack(ctx context.Context, location string) (*Track, error)
 	SaveTrack(ctx context.Context, prev, track *Track) (*Track, error)
 	DeleteTrack(ctx context.Context, track *Track) error
+
+	// RestoreTrack moves a deleted track back from the trash, returning
+	// ErrNotOnShelf if it was deleted from another shelf
+	RestoreTrack(ctx context.Context, entry TrashEntry) (*Track, error)
+
+	// CountPlay adds one to a track's play count and persists it, returning
+	// the updated track
+	CountPlay(ctx context.Context, track *Track) (*Track, error)
+
+	// Watch emits events as tracks are added to, removed from or changed on
+	// the shelf outside of grump. The channel is closed when ctx is done.
+	Watch(ctx context.Context) (<-chan TrackEvent, error)
+}
+
+// ScanProgress describes how far along a shelf is in loading its tracks.
+type ScanProgress struct {
+	Scanned uint64
+	Total   uint64
+}
+
+// Done returns true once every track has been scanned
+func (p ScanProgress) Done() bool {
+	return p.Scanned >= p.Total
+}
+
+// ProgressFunc receives scan progress updates
+type ProgressFunc func(ScanProgress)
+
+// TrackEventType is the kind of change a TrackEvent describes
+type TrackEventType int
+
+const (
+	// TrackAdded is sent when a new track appears on a shelf
+	TrackAdded TrackEventType = iota
+	// TrackRemoved is sent when a track disappears from a shelf
+	TrackRemoved
+	// TrackChanged is sent when an existing track's metadata changes
+	TrackChanged
+)
+
+func (t TrackEventType) String() string {
+	switch t {
+	case TrackAdded:
+		return "added"
+	case TrackRemoved:
+		return "removed"
+	case TrackChanged:
+		return "changed"
+	default:
+		return "unknown"
+	}
+}
+
+// TrackEvent describes a change to a track on a shelf
+type TrackEvent struct {
+	Type  TrackEventType
+	Track Track
 }
 
 // TrackHandler is responsible for performing track type-specific operations
@@ -1,6 +1,9 @@
 package library_test
 
 import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/dhulihan/grump/library"
@@ -32,3 +35,48 @@ func TestShouldInclude(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadTracksProgress(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{}
+	for i := 0; i < 20; i++ {
+		p := filepath.Join(dir, fmt.Sprintf("%02d.wav", i))
+		if err := ioutil.WriteFile(p, []byte("RIFF"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, p)
+	}
+
+	s, _ := library.NewLocalAudioShelf(dir)
+	s.SetWorkers(4)
+
+	updates := []library.ScanProgress{}
+	s.SetProgressFunc(func(p library.ScanProgress) {
+		updates = append(updates, p)
+	})
+
+	count, err := s.LoadTracks()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 20 {
+		t.Errorf("wanted 20 tracks, got %d", count)
+	}
+
+	// tracks must come back in walk order regardless of worker scheduling
+	for i, track := range s.Tracks() {
+		if track.Path != files[i] {
+			t.Errorf("track %d: wanted [%s], got [%s]", i, files[i], track.Path)
+		}
+	}
+
+	if len(updates) != 21 {
+		t.Fatalf("wanted 21 progress updates, got %d", len(updates))
+	}
+
+	last := updates[len(updates)-1]
+	if !last.Done() || last.Total != 20 {
+		t.Errorf("wanted final progress 20/20, got %d/%d", last.Scanned, last.Total)
+	}
+}
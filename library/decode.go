@@ -0,0 +1,44 @@
+package library
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/flac"
+	"github.com/faiface/beep/mp3"
+	"github.com/faiface/beep/vorbis"
+	"github.com/faiface/beep/wav"
+)
+
+// OpenAudio opens a track's audio stream. Closing the stream closes the
+// file.
+func OpenAudio(track Track) (beep.StreamSeekCloser, beep.Format, error) {
+	f, err := os.Open(track.Path)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+
+	var s beep.StreamSeekCloser
+	var format beep.Format
+
+	switch track.FileType {
+	case "MP3":
+		s, format, err = mp3.Decode(f)
+	case "FLAC":
+		s, format, err = flac.Decode(f)
+	case "OGG":
+		s, format, err = vorbis.Decode(f)
+	case "WAV":
+		s, format, err = wav.Decode(f)
+	default:
+		err = fmt.Errorf("unsupported file type [%s]", track.FileType)
+	}
+
+	if err != nil {
+		f.Close()
+		return nil, beep.Format{}, err
+	}
+
+	return s, format, nil
+}
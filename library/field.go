@@ -0,0 +1,195 @@
+package library
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Field names a queryable/sortable Track attribute
+type Field string
+
+// Track fields
+const (
+	FieldAlbum       Field = "album"
+	FieldAlbumArtist Field = "albumartist"
+	FieldArtist      Field = "artist"
+	FieldBitDepth    Field = "bitdepth"
+	FieldBitrate     Field = "bitrate"
+	FieldChannels    Field = "channels"
+	FieldComment     Field = "comment"
+	FieldComposer    Field = "composer"
+	FieldDiscNumber  Field = "disc"
+	FieldDiscTotal   Field = "disctotal"
+	FieldFileType    Field = "filetype"
+	FieldGenre       Field = "genre"
+	FieldLength      Field = "length"
+	FieldLyrics      Field = "lyrics"
+	FieldMimeType    Field = "mimetype"
+	FieldPath        Field = "path"
+	FieldPlayCount   Field = "playcount"
+	FieldRating      Field = "rating"
+	FieldSampleRate  Field = "samplerate"
+	FieldTitle       Field = "title"
+	FieldTrackNumber Field = "track"
+	FieldTrackTotal  Field = "tracktotal"
+	FieldYear        Field = "year"
+)
+
+// fieldInfo describes how to read a field from a track. Exactly one of text
+// or number is set. sort optionally overrides text when ordering tracks.
+// Tag fields also set setText or setNumber.
+type fieldInfo struct {
+	text      func(t *Track) string
+	number    func(t *Track) int64
+	sort      func(t *Track) string
+	setText   func(t *Track, v string)
+	setNumber func(t *Track, n int)
+}
+
+var fields = map[Field]fieldInfo{
+	FieldAlbum:       {text: func(t *Track) string { return t.Album }, sort: albumSort, setText: func(t *Track, v string) { t.Album = v }},
+	FieldAlbumArtist: {text: func(t *Track) string { return t.AlbumArtist }, sort: albumArtistSort, setText: func(t *Track, v string) { t.AlbumArtist = v }},
+	FieldArtist:      {text: func(t *Track) string { return t.Artist }, sort: artistSort, setText: func(t *Track, v string) { t.Artist = v }},
+	FieldBitDepth:    {number: func(t *Track) int64 { return int64(t.BitDepth) }},
+	FieldBitrate:     {number: func(t *Track) int64 { return int64(t.Bitrate) }},
+	FieldChannels:    {number: func(t *Track) int64 { return int64(t.Channels) }},
+	FieldComment:     {text: func(t *Track) string { return t.Comment }, setText: func(t *Track, v string) { t.Comment = v }},
+	FieldComposer:    {text: func(t *Track) string { return t.Composer }, setText: func(t *Track, v string) { t.Composer = v }},
+	FieldDiscNumber:  {number: func(t *Track) int64 { return int64(t.DiscNumber) }, setNumber: func(t *Track, n int) { t.DiscNumber = n }},
+	FieldDiscTotal:   {number: func(t *Track) int64 { return int64(t.DiscTotal) }, setNumber: func(t *Track, n int) { t.DiscTotal = n }},
+	FieldFileType:    {text: func(t *Track) string { return t.FileType }},
+	FieldGenre:       {text: func(t *Track) string { return t.Genre }, setText: func(t *Track, v string) { t.Genre = v }},
+	FieldLength:      {number: func(t *Track) int64 { return int64(t.Length) }},
+	FieldLyrics:      {text: func(t *Track) string { return t.Lyrics }},
+	FieldMimeType:    {text: func(t *Track) string { return t.MimeType }},
+	FieldPath:        {text: func(t *Track) string { return t.Path }},
+	FieldPlayCount:   {number: func(t *Track) int64 { return int64(t.PlayCount) }},
+	FieldRating:      {number: func(t *Track) int64 { return int64(t.Rating) }},
+	FieldSampleRate:  {number: func(t *Track) int64 { return int64(t.SampleRate) }},
+	FieldTitle:       {text: func(t *Track) string { return t.Title }, sort: titleSort, setText: func(t *Track, v string) { t.Title = v }},
+	FieldTrackNumber: {number: func(t *Track) int64 { return int64(t.TrackNumber) }, setNumber: func(t *Track, n int) { t.TrackNumber = n }},
+	FieldTrackTotal:  {number: func(t *Track) int64 { return int64(t.TrackTotal) }, setNumber: func(t *Track, n int) { t.TrackTotal = n }},
+	FieldYear:        {number: func(t *Track) int64 { return int64(t.Year) }, setNumber: func(t *Track, n int) { t.Year = n }},
+}
+
+// Fields returns the names of all track fields, sorted
+func Fields() []Field {
+	names := make([]Field, 0, len(fields))
+	for f := range fields {
+		names = append(names, f)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// ParseField looks up a field by name, ignoring case
+func ParseField(name string) (Field, error) {
+	f := Field(strings.ToLower(name))
+	if _, ok := fields[f]; !ok {
+		return "", fmt.Errorf("unknown field [%s]", name)
+	}
+
+	return f, nil
+}
+
+// Numeric returns true if the field holds a number
+func (f Field) Numeric() bool {
+	return fields[f].number != nil
+}
+
+// Text returns the field value of a track as a string
+func (f Field) Text(t Track) string {
+	info, ok := fields[f]
+	switch {
+	case !ok:
+		return ""
+	case info.text != nil:
+		return info.text(&t)
+	default:
+		return fmt.Sprintf("%d", info.number(&t))
+	}
+}
+
+// Number returns the field value of a track as a number. Text fields are
+// always 0.
+func (f Field) Number(t Track) int64 {
+	info, ok := fields[f]
+	if !ok || info.number == nil {
+		return 0
+	}
+
+	return info.number(&t)
+}
+
+// Settable returns true if the field is a tag that can be set
+func (f Field) Settable() bool {
+	info := fields[f]
+	return info.setText != nil || info.setNumber != nil
+}
+
+// Set changes the field value of a track. Numbers are parsed from value.
+func (f Field) Set(t *Track, value string) error {
+	info := fields[f]
+	switch {
+	case info.setText != nil:
+		info.setText(t, value)
+	case info.setNumber != nil:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("could not set [%s]: [%s is not a number]", f, value)
+		}
+		info.setNumber(t, n)
+	default:
+		return fmt.Errorf("could not set [%s]: [not a tag]", f)
+	}
+
+	return nil
+}
+
+// SortText returns the value a text field is ordered by. Sort tags are used
+// when present, otherwise a leading "The" is ignored.
+func (f Field) SortText(t Track) string {
+	info, ok := fields[f]
+	if ok && info.sort != nil {
+		return info.sort(&t)
+	}
+
+	return f.Text(t)
+}
+
+func artistSort(t *Track) string {
+	return sortName(t.ArtistSort, t.Artist)
+}
+
+func albumSort(t *Track) string {
+	return sortName(t.AlbumSort, t.Album)
+}
+
+func titleSort(t *Track) string {
+	return sortName(t.TitleSort, t.Title)
+}
+
+// albumArtistSort falls back to the track artist, so albums without an album
+// artist still group with the rest of that artist's albums
+func albumArtistSort(t *Track) string {
+	if t.AlbumArtistSort == "" && t.AlbumArtist == "" {
+		return artistSort(t)
+	}
+
+	return sortName(t.AlbumArtistSort, t.AlbumArtist)
+}
+
+// sortName prefers an explicit sort tag and otherwise drops a leading "The"
+func sortName(sortTag, name string) string {
+	if sortTag != "" {
+		return sortTag
+	}
+
+	if len(name) > 4 && strings.EqualFold(name[:4], "the ") {
+		return strings.TrimSpace(name[4:])
+	}
+
+	return name
+}
@@ -0,0 +1,257 @@
+package library
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FLAC metadata block types
+const (
+	flacStreamInfo    = 0
+	flacPadding       = 1
+	flacVorbisComment = 4
+	flacPicture       = 6
+
+	// flacMaxBlock is the largest metadata block a FLAC header can describe
+	flacMaxBlock = 1<<24 - 1
+
+	// flacPaddingSize is the padding added when the file has to be rewritten,
+	// so later edits can usually be written in place
+	flacPaddingSize = 4096
+)
+
+// flacBlock is a FLAC metadata block
+type flacBlock struct {
+	kind byte
+	data []byte
+}
+
+// readFLACBlocks reads the metadata blocks at the start of a FLAC file and
+// returns them with the offset where audio frames begin.
+func readFLACBlocks(r io.Reader) ([]flacBlock, int64, error) {
+	magic := make([]byte, 4)
+	_, err := io.ReadFull(r, magic)
+	if err != nil || string(magic) != "fLaC" {
+		return nil, 0, errors.New("not a flac file")
+	}
+
+	offset := int64(4)
+	blocks := []flacBlock{}
+	for {
+		header := make([]byte, 4)
+		_, err := io.ReadFull(r, header)
+		if err != nil {
+			return nil, 0, fmt.Errorf("could not read metadata block header: [%s]", err.Error())
+		}
+
+		last := header[0]&0x80 != 0
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		b := flacBlock{kind: header[0] & 0x7f, data: make([]byte, size)}
+		_, err = io.ReadFull(r, b.data)
+		if err != nil {
+			return nil, 0, fmt.Errorf("could not read metadata block: [%s]", err.Error())
+		}
+
+		blocks = append(blocks, b)
+		offset += 4 + int64(size)
+
+		if last {
+			return blocks, offset, nil
+		}
+	}
+}
+
+// encodeFLACBlocks serializes metadata blocks, including the "fLaC" marker
+func encodeFLACBlocks(blocks []flacBlock) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString("fLaC")
+
+	for i, b := range blocks {
+		if len(b.data) > flacMaxBlock {
+			return nil, fmt.Errorf("metadata block type %d is too large (%d bytes)", b.kind, len(b.data))
+		}
+
+		kind := b.kind
+		if i == len(blocks)-1 {
+			kind |= 0x80
+		}
+
+		size := len(b.data)
+		buf.Write([]byte{kind, byte(size >> 16), byte(size >> 8), byte(size)})
+		buf.Write(b.data)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeFLACComments updates the vorbis comments of a FLAC file. Other
+// metadata blocks, such as pictures, are kept as they are. When the new
+// comments fit in the existing padding only the header is rewritten.
+func writeFLACComments(path string, update func(*vorbisComments)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open file [%s]: [%s]", path, err.Error())
+	}
+	defer f.Close()
+
+	blocks, audioOffset, err := readFLACBlocks(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("could not read flac metadata [%s]: [%s]", path, err.Error())
+	}
+
+	if len(blocks) == 0 || blocks[0].kind != flacStreamInfo {
+		return fmt.Errorf("could not read flac metadata [%s]: [missing STREAMINFO]", path)
+	}
+
+	// find or create the comment block, which belongs after STREAMINFO
+	vc := &vorbisComments{vendor: vorbisVendor}
+	pos := -1
+	for i, b := range blocks {
+		if b.kind != flacVorbisComment {
+			continue
+		}
+
+		vc, err = decodeVorbisComments(b.data)
+		if err != nil {
+			return fmt.Errorf("could not read vorbis comments [%s]: [%s]", path, err.Error())
+		}
+		pos = i
+		break
+	}
+
+	update(vc)
+
+	comment := flacBlock{kind: flacVorbisComment, data: vc.encode()}
+	if pos < 0 {
+		blocks = append(blocks[:1], append([]flacBlock{comment}, blocks[1:]...)...)
+	} else {
+		blocks[pos] = comment
+	}
+
+	// drop existing padding, it is recreated at the end to fill any gap
+	padding := 0
+	kept := blocks[:0]
+	for _, b := range blocks {
+		if b.kind == flacPadding {
+			padding += 4 + len(b.data)
+			continue
+		}
+		kept = append(kept, b)
+	}
+	blocks = kept
+
+	header, err := encodeFLACBlocks(blocks)
+	if err != nil {
+		return fmt.Errorf("could not encode flac metadata [%s]: [%s]", path, err.Error())
+	}
+
+	// a padding block needs at least its 4 byte header
+	gap := audioOffset - int64(len(header))
+	if gap == 0 || gap >= 4 {
+		if gap >= 4 {
+			blocks = append(blocks, flacBlock{kind: flacPadding, data: make([]byte, gap-4)})
+			header, err = encodeFLACBlocks(blocks)
+			if err != nil {
+				return fmt.Errorf("could not encode flac metadata [%s]: [%s]", path, err.Error())
+			}
+		}
+
+		f.Close()
+		log.WithField("path", path).Debug("writing flac metadata in place")
+		return writeInPlace(path, header)
+	}
+
+	blocks = append(blocks, flacBlock{kind: flacPadding, data: make([]byte, flacPaddingSize)})
+	header, err = encodeFLACBlocks(blocks)
+	if err != nil {
+		return fmt.Errorf("could not encode flac metadata [%s]: [%s]", path, err.Error())
+	}
+
+	log.WithFields(log.Fields{
+		"path":    path,
+		"padding": padding,
+	}).Debug("rewriting flac file, metadata no longer fits")
+
+	_, err = f.Seek(audioOffset, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("could not seek to audio [%s]: [%s]", path, err.Error())
+	}
+
+	return rewriteFile(path, func(w io.Writer) error {
+		_, err := w.Write(header)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(w, f)
+		return err
+	})
+}
+
+// writeInPlace overwrites the start of a file
+func writeInPlace(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("could not open file for writing [%s]: [%s]", path, err.Error())
+	}
+
+	_, err = f.WriteAt(b, 0)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not write file [%s]: [%s]", path, err.Error())
+	}
+
+	return f.Close()
+}
+
+// rewriteFile replaces a file with the output of write. The new contents are
+// written to a temporary file next to the original and renamed over it, so a
+// failure part way through never leaves a truncated file.
+func rewriteFile(path string, write func(w io.Writer) error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("could not stat file [%s]: [%s]", path, err.Error())
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not create temp file for [%s]: [%s]", path, err.Error())
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write temp file for [%s]: [%s]", path, err.Error())
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("could not close temp file for [%s]: [%s]", path, err.Error())
+	}
+
+	err = os.Chmod(tmp.Name(), info.Mode())
+	if err != nil {
+		return fmt.Errorf("could not set permissions on [%s]: [%s]", tmp.Name(), err.Error())
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("could not replace file [%s]: [%s]", path, err.Error())
+	}
+
+	return nil
+}
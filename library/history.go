@@ -0,0 +1,204 @@
+package library
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// History is an append-only log of plays, stored as one JSON object per line
+// so a crash can at most lose the line being written.
+type History struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Play is a single entry in the listening history
+type Play struct {
+	// ID identifies the track independently of where its file lives
+	ID     string
+	Path   string
+	Artist string
+	Album  string
+	Title  string
+
+	Start time.Time
+
+	// Listened is how long the track was heard for in millis, not counting
+	// seeks
+	Listened int
+
+	// Finished is true if the track played to the end, false if it was
+	// skipped or stopped
+	Finished bool
+
+	// Speed is the playback speed when the track ended, 1 is normal
+	Speed float64
+
+	// Shuffle is true if the track was picked by shuffle
+	Shuffle bool
+}
+
+// NewPlay starts a history entry for a track
+func NewPlay(track Track, start time.Time) Play {
+	return Play{
+		ID:     trackID(track),
+		Path:   track.Path,
+		Artist: track.Artist,
+		Album:  track.Album,
+		Title:  track.Title,
+		Start:  start,
+	}
+}
+
+// NewHistory opens the history at path. The file is created on the first
+// play.
+func NewHistory(path string) *History {
+	return &History{path: path}
+}
+
+// Path returns the location of the history file
+func (h *History) Path() string {
+	return h.path
+}
+
+// Append adds a play to the end of the history
+func (h *History) Append(p Play) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	err = os.MkdirAll(filepath.Dir(h.path), 0755)
+	if err != nil {
+		return fmt.Errorf("could not create history directory [%s]: [%s]", h.path, err.Error())
+	}
+
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open history [%s]: [%s]", h.path, err.Error())
+	}
+
+	_, err = f.Write(append(b, '\n'))
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not write history [%s]: [%s]", h.path, err.Error())
+	}
+
+	return f.Close()
+}
+
+// Plays returns every play, oldest first. Lines that can not be parsed are
+// logged and skipped.
+func (h *History) Plays() ([]Play, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	plays := []Play{}
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return plays, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open history [%s]: [%s]", h.path, err.Error())
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		p := Play{}
+		err := json.Unmarshal(scanner.Bytes(), &p)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path":  h.path,
+				"line":  line,
+				"error": err,
+			}).Warn("could not parse history entry")
+			continue
+		}
+		plays = append(plays, p)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("could not read history [%s]: [%s]", h.path, err.Error())
+	}
+
+	return plays, nil
+}
+
+// Recent returns up to n of the latest plays, newest first
+func (h *History) Recent(n int) ([]Play, error) {
+	plays, err := h.Plays()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(plays) > n {
+		plays = plays[len(plays)-n:]
+	}
+
+	for i, j := 0, len(plays)-1; i < j; i, j = i+1, j-1 {
+		plays[i], plays[j] = plays[j], plays[i]
+	}
+
+	return plays, nil
+}
+
+// WriteHistoryJSON writes plays as a JSON array
+func WriteHistoryJSON(w io.Writer, plays []Play) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(plays)
+}
+
+// historyColumns is the header row of CSV exports
+var historyColumns = []string{"start", "artist", "album", "title", "listened", "finished", "speed", "shuffle", "path", "id"}
+
+// WriteHistoryCSV writes plays as CSV with a header row. Times are RFC 3339
+// and listened is in seconds.
+func WriteHistoryCSV(w io.Writer, plays []Play) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write(historyColumns)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range plays {
+		err = cw.Write([]string{
+			p.Start.Format(time.RFC3339),
+			p.Artist,
+			p.Album,
+			p.Title,
+			strconv.FormatFloat(float64(p.Listened)/1000, 'f', 3, 64),
+			strconv.FormatBool(p.Finished),
+			strconv.FormatFloat(p.Speed, 'f', -1, 64),
+			strconv.FormatBool(p.Shuffle),
+			p.Path,
+			p.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
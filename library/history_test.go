@@ -0,0 +1,58 @@
+package library_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grump", "history.jsonl")
+	h := library.NewHistory(path)
+
+	plays, err := h.Plays()
+	require.NoError(t, err)
+	assert.Empty(t, plays)
+
+	start := time.Date(2026, 10, 17, 20, 30, 0, 0, time.UTC)
+	for i, title := range []string{"Let It Happen", "Nangs", "The Moment"} {
+		p := library.NewPlay(library.Track{Artist: "Tame Impala", Album: "Currents", Title: title, Path: "/music/" + title + ".flac"}, start.Add(time.Duration(i)*time.Minute))
+		p.Listened = 61500
+		p.Finished = i != 1
+		p.Speed = 1
+		require.NoError(t, h.Append(p))
+	}
+
+	// a torn write is skipped
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	f.WriteString(`{"Title": "Yes I'm Chan`)
+	f.Close()
+
+	recent, err := h.Recent(2)
+	require.NoError(t, err)
+	require.Len(t, recent, 2)
+	assert.Equal(t, "The Moment", recent[0].Title)
+	assert.Equal(t, "Nangs", recent[1].Title)
+	assert.False(t, recent[1].Finished)
+	assert.Equal(t, "tame impala|currents|0|0|nangs", recent[1].ID)
+
+	plays, err = h.Plays()
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, library.WriteHistoryCSV(buf, plays[:1]))
+	assert.Equal(t, "start,artist,album,title,listened,finished,speed,shuffle,path,id\n"+
+		"2026-10-17T20:30:00Z,Tame Impala,Currents,Let It Happen,61.500,true,1,false,/music/Let It Happen.flac,tame impala|currents|0|0|let it happen\n",
+		buf.String())
+
+	buf.Reset()
+	require.NoError(t, library.WriteHistoryJSON(buf, plays))
+	assert.Contains(t, buf.String(), `"Title": "Nangs"`)
+}
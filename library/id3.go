@@ -0,0 +1,353 @@
+package library
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/bogem/id3v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// id3PlayCounter is the PCNT frame, a play count for the whole file
+	id3PlayCounter = "PCNT"
+
+	// id3Language is used for new comment and lyrics frames
+	id3Language = "eng"
+)
+
+// id3Track reads track metadata from an ID3v2 tag, mapping POPM ratings
+// with profile
+func id3Track(t *id3v2.Tag, profile *RatingProfile) Track {
+	trackNumber, trackTotal := parsePosition(t.GetTextFrame("TRCK").Text)
+	discNumber, discTotal := parsePosition(t.GetTextFrame("TPOS").Text)
+
+	track := Track{
+		Title:       t.Title(),
+		Artist:      t.Artist(),
+		Album:       t.Album(),
+		AlbumArtist: t.GetTextFrame("TPE2").Text,
+		Composer:    t.GetTextFrame("TCOM").Text,
+		Year:        id3Year(t),
+		Genre:       t.Genre(),
+		TrackNumber: trackNumber,
+		TrackTotal:  trackTotal,
+		DiscNumber:  discNumber,
+		DiscTotal:   discTotal,
+		Comment:     id3Comment(t),
+		Lyrics:      id3Lyrics(t),
+		PlayCount:   id3PlayCount(t),
+		RatingEmail: profile.Email,
+
+		ArtistSort:      t.GetTextFrame("TSOP").Text,
+		AlbumSort:       t.GetTextFrame("TSOA").Text,
+		AlbumArtistSort: t.GetTextFrame("TSO2").Text,
+		TitleSort:       t.GetTextFrame("TSOT").Text,
+
+		ReplayGain: id3ReplayGain(t),
+	}
+
+	popm, ok := id3Popularimeter(t, profile)
+	if ok {
+		track.Rating = profile.Rating(popm.Rating)
+		track.RatingEmail = popm.Email
+	}
+
+	return track
+}
+
+// id3Popularimeter picks the POPM frame a profile reads from a tag
+func id3Popularimeter(t *id3v2.Tag, profile *RatingProfile) (id3v2.PopularimeterFrame, bool) {
+	frames := []id3v2.PopularimeterFrame{}
+	for _, f := range t.GetFrames(t.CommonID("Popularimeter")) {
+		popm, ok := f.(id3v2.PopularimeterFrame)
+		if ok && profile.readsEmail(popm.Email) {
+			frames = append(frames, popm)
+		}
+	}
+
+	if len(frames) == 0 {
+		return id3v2.PopularimeterFrame{}, false
+	}
+
+	switch profile.Frames {
+	case PopmFirst:
+		return frames[0], true
+	case PopmLast:
+		return frames[len(frames)-1], true
+	case PopmOwn:
+		for _, popm := range frames {
+			if popm.Email == profile.Email {
+				return popm, true
+			}
+		}
+	}
+
+	highest := frames[0]
+	for _, popm := range frames[1:] {
+		if popm.Rating > highest.Rating {
+			highest = popm
+		}
+	}
+	return highest, true
+}
+
+// setID3Track copies track metadata into an ID3v2 tag. Frames grump does not
+// know about, including other players' POPM frames, are left alone.
+func setID3Track(tag *id3v2.Tag, track *Track, profile *RatingProfile) {
+	// ID3v2.3 text is written as ISO-8859-1, as UTF-16 is not written
+	// reliably by the id3v2 package. Upgrade tags that need more.
+	if tag.Version() < 4 && id3NeedsUnicode(track) {
+		log.WithField("path", track.Path).Debug("upgrading tag to ID3v2.4 for unicode text")
+		tag.SetVersion(4)
+	}
+
+	// Text Tags
+	setID3Text(tag, "TIT2", track.Title)
+	setID3Text(tag, "TALB", track.Album)
+	setID3Text(tag, "TPE1", track.Artist)
+	setID3Text(tag, "TPE2", track.AlbumArtist)
+	setID3Text(tag, "TCOM", track.Composer)
+	setID3Text(tag, "TCON", track.Genre)
+	setID3Text(tag, "TRCK", formatPosition(track.TrackNumber, track.TrackTotal))
+	setID3Text(tag, "TPOS", formatPosition(track.DiscNumber, track.DiscTotal))
+	setID3Text(tag, "TSOP", track.ArtistSort)
+	setID3Text(tag, "TSOA", track.AlbumSort)
+	setID3Text(tag, "TSO2", track.AlbumArtistSort)
+	setID3Text(tag, "TSOT", track.TitleSort)
+	setID3Year(tag, track.Year)
+	setID3Comment(tag, track.Comment)
+	setID3Lyrics(tag, track.Lyrics)
+	setID3PlayCount(tag, track.PlayCount)
+	setID3ReplayGain(tag, track.ReplayGain)
+
+	// POPM frames are unique by email, so this replaces only the profile's
+	popmFrame := id3v2.PopularimeterFrame{
+		Email:   profile.Email,
+		Rating:  profile.Byte(track.Rating),
+		Counter: big.NewInt(int64(track.PlayCount)),
+	}
+	log.WithFields(log.Fields{
+		"rating": track.Rating,
+		"byte":   popmFrame.Rating,
+		"email":  popmFrame.Email,
+		"path":   track.Path,
+	}).Debug("setting POPM")
+
+	tag.AddFrame(tag.CommonID("Popularimeter"), popmFrame)
+}
+
+// id3NeedsUnicode reports whether any text of a track is outside
+// ISO-8859-1, the only encoding ID3v2.3 has besides UTF-16
+func id3NeedsUnicode(track *Track) bool {
+	fields := []string{
+		track.Title, track.TitleSort, track.Artist, track.ArtistSort,
+		track.Album, track.AlbumSort, track.AlbumArtist, track.AlbumArtistSort,
+		track.Composer, track.Genre, track.Comment, track.Lyrics,
+	}
+
+	for _, f := range fields {
+		for _, r := range f {
+			if r > unicode.MaxLatin1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setID3Text sets a text frame, removing it when value is empty
+func setID3Text(tag *id3v2.Tag, id, value string) {
+	if value == "" {
+		tag.DeleteFrames(id)
+		return
+	}
+	tag.AddTextFrame(id, tag.DefaultEncoding(), value)
+}
+
+// id3Year returns the year of a TDRC (v2.4) or TYER (v2.3) frame, whichever
+// is present. Timestamps such as 2015-07-17 are truncated to the year.
+func id3Year(tag *id3v2.Tag) int {
+	for _, id := range []string{"TDRC", "TYER"} {
+		s := strings.TrimSpace(tag.GetTextFrame(id).Text)
+		if len(s) > 4 {
+			s = s[:4]
+		}
+
+		year, err := strconv.Atoi(s)
+		if err == nil {
+			return year
+		}
+	}
+	return 0
+}
+
+// setID3Year writes the year frame for the tag version and drops the other
+func setID3Year(tag *id3v2.Tag, year int) {
+	id, other := "TYER", "TDRC"
+	if tag.Version() == 4 {
+		id, other = other, id
+	}
+	tag.DeleteFrames(other)
+
+	// keep a full timestamp if the year has not changed
+	if year > 0 && id3Year(tag) == year && tag.GetTextFrame(id).Text != "" {
+		return
+	}
+
+	value := ""
+	if year > 0 {
+		value = strconv.Itoa(year)
+	}
+	setID3Text(tag, id, value)
+}
+
+// parsePosition parses a TRCK or TPOS value, eg: "3/12"
+func parsePosition(s string) (int, int) {
+	parts := strings.SplitN(s, "/", 2)
+	n, _ := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if len(parts) == 1 {
+		return n, 0
+	}
+
+	total, _ := strconv.Atoi(strings.TrimSpace(parts[1]))
+	return n, total
+}
+
+// formatPosition is the inverse of parsePosition. It returns an empty string
+// when both numbers are unset.
+func formatPosition(n, total int) string {
+	switch {
+	case total > 0:
+		return fmt.Sprintf("%d/%d", n, total)
+	case n > 0:
+		return strconv.Itoa(n)
+	default:
+		return ""
+	}
+}
+
+// id3Comment returns the text of the comment frame without a description.
+// Described comments are usually player data (eg: iTunNORM), not something
+// written by a person.
+func id3Comment(tag *id3v2.Tag) string {
+	for _, f := range tag.GetFrames(tag.CommonID("Comments")) {
+		cf, ok := f.(id3v2.CommentFrame)
+		if ok && cf.Description == "" {
+			return cf.Text
+		}
+	}
+	return ""
+}
+
+// setID3Comment replaces the comment frames without a description, keeping
+// their language if there is one
+func setID3Comment(tag *id3v2.Tag, text string) {
+	id := tag.CommonID("Comments")
+	frames := append([]id3v2.Framer{}, tag.GetFrames(id)...)
+	tag.DeleteFrames(id)
+
+	lang := id3Language
+	for _, f := range frames {
+		cf, ok := f.(id3v2.CommentFrame)
+		if ok && cf.Description == "" {
+			if len(cf.Language) == 3 {
+				lang = cf.Language
+			}
+			continue
+		}
+		tag.AddFrame(id, f)
+	}
+
+	if text == "" {
+		return
+	}
+
+	tag.AddCommentFrame(id3v2.CommentFrame{
+		Encoding: tag.DefaultEncoding(),
+		Language: lang,
+		Text:     text,
+	})
+}
+
+// id3Lyrics returns the unsynchronised lyrics, preferring a frame without a
+// content descriptor
+func id3Lyrics(tag *id3v2.Tag) string {
+	lyrics := ""
+	for _, f := range tag.GetFrames(tag.CommonID("Unsynchronised lyrics/text transcription")) {
+		uf, ok := f.(id3v2.UnsynchronisedLyricsFrame)
+		if !ok {
+			continue
+		}
+
+		if uf.ContentDescriptor == "" {
+			return uf.Lyrics
+		}
+
+		if lyrics == "" {
+			lyrics = uf.Lyrics
+		}
+	}
+	return lyrics
+}
+
+// setID3Lyrics replaces all unsynchronised lyrics frames, a track only has
+// one set of lyrics
+func setID3Lyrics(tag *id3v2.Tag, lyrics string) {
+	id := tag.CommonID("Unsynchronised lyrics/text transcription")
+
+	lang := id3Language
+	uf, ok := tag.GetLastFrame(id).(id3v2.UnsynchronisedLyricsFrame)
+	if ok && len(uf.Language) == 3 {
+		lang = uf.Language
+	}
+	tag.DeleteFrames(id)
+
+	if lyrics == "" {
+		return
+	}
+
+	tag.AddUnsynchronisedLyricsFrame(id3v2.UnsynchronisedLyricsFrame{
+		Encoding: tag.DefaultEncoding(),
+		Language: lang,
+		Lyrics:   lyrics,
+	})
+}
+
+// id3PlayCount reads the PCNT frame, falling back to the POPM counter
+func id3PlayCount(tag *id3v2.Tag) uint64 {
+	uf, ok := tag.GetLastFrame(id3PlayCounter).(id3v2.UnknownFrame)
+	if ok && len(uf.Body) > 0 {
+		c := new(big.Int).SetBytes(uf.Body)
+		if c.IsUint64() {
+			return c.Uint64()
+		}
+	}
+
+	popm, ok := tag.GetLastFrame(tag.CommonID("Popularimeter")).(id3v2.PopularimeterFrame)
+	if ok && popm.Counter != nil && popm.Counter.IsUint64() {
+		return popm.Counter.Uint64()
+	}
+
+	return 0
+}
+
+// setID3PlayCount writes the PCNT frame, which is at least 4 bytes
+func setID3PlayCount(tag *id3v2.Tag, count uint64) {
+	tag.DeleteFrames(id3PlayCounter)
+	if count == 0 {
+		return
+	}
+
+	body := make([]byte, 8)
+	binary.BigEndian.PutUint64(body, count)
+	if count <= 0xffffffff {
+		body = body[4:]
+	}
+
+	tag.AddFrame(id3PlayCounter, id3v2.UnknownFrame{Body: body})
+}
@@ -0,0 +1,167 @@
+package library_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/bogem/id3v2"
+	"github.com/dhowden/tag"
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var mp3Track = library.Track{
+	Title:           "Let It Happen",
+	TitleSort:       "Let It Happen",
+	Artist:          "Tame Impala",
+	ArtistSort:      "Impala, Tame",
+	Album:           "Currents",
+	AlbumSort:       "Currents",
+	AlbumArtist:     "Tame Impala",
+	AlbumArtistSort: "Impala, Tame",
+	Composer:        "Kevin Parker",
+	Genre:           "Psychedelic",
+	Comment:         "great",
+	Lyrics:          "all this running around\nwell I can't fight it much longer",
+	TrackNumber:     1,
+	TrackTotal:      13,
+	DiscNumber:      1,
+	DiscTotal:       2,
+	Year:            2015,
+	Rating:          204,
+	RatingEmail:     "grump",
+	PlayCount:       42,
+	ReplayGain:      library.ReplayGain{TrackGain: -6.5, TrackPeak: 0.988312, AlbumGain: -7.25, AlbumPeak: 1},
+	FileType:        "MP3",
+}
+
+// writeMP3 creates an mp3 file with fake audio frames and, unless version is
+// 0, an existing tag holding frames grump does not manage
+func writeMP3(t *testing.T, audio []byte, version byte, date string) string {
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	require.NoError(t, ioutil.WriteFile(path, audio, 0644))
+
+	if version == 0 {
+		return path
+	}
+
+	tg, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	require.NoError(t, err)
+	defer tg.Close()
+
+	tg.SetVersion(version)
+	tg.SetTitle("Old")
+	tg.AddTextFrame(tg.CommonID("Year"), tg.DefaultEncoding(), date)
+	tg.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+		Encoding:    tg.DefaultEncoding(),
+		Description: "CUSTOM",
+		Value:       "keep me",
+	})
+	tg.AddCommentFrame(id3v2.CommentFrame{
+		Encoding:    tg.DefaultEncoding(),
+		Language:    "eng",
+		Description: "iTunNORM",
+		Text:        "00000001",
+	})
+	tg.AddAttachedPicture(id3v2.PictureFrame{
+		Encoding:    tg.DefaultEncoding(),
+		MimeType:    "image/png",
+		PictureType: id3v2.PTFrontCover,
+		Picture:     []byte("\x89PNG"),
+	})
+	require.NoError(t, tg.Save())
+
+	return path
+}
+
+func TestSaveID3v2(t *testing.T) {
+	audio := bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x64}, 1000)
+
+	var tests = []struct {
+		name    string
+		version byte
+		date    string
+	}{
+		{"no tag", 0, ""},
+		{"v2.3", 3, "2015"},
+		{"v2.4", 4, "2015-07-17"},
+	}
+
+	h := &library.ID3v2Handler{}
+	for _, test := range tests {
+		path := writeMP3(t, audio, test.version, test.date)
+
+		track := mp3Track
+		track.Path = path
+		_, err := h.Save(context.Background(), &track)
+		require.NoError(t, err, test.name)
+
+		loaded, err := h.Load(context.Background(), path)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, track, *loaded, test.name)
+
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		assert.True(t, bytes.HasSuffix(b, audio), "%s: audio frames changed", test.name)
+
+		// check against an independent reader
+		m, err := tag.ReadFrom(bytes.NewReader(b))
+		require.NoError(t, err, test.name)
+		assert.Equal(t, track.AlbumArtist, m.AlbumArtist(), test.name)
+		assert.Equal(t, track.Lyrics, m.Lyrics(), test.name)
+		n, total := m.Track()
+		assert.Equal(t, []int{1, 13}, []int{n, total}, test.name)
+		n, total = m.Disc()
+		assert.Equal(t, []int{1, 2}, []int{n, total}, test.name)
+
+		if test.version != 0 {
+			tg, err := id3v2.Open(path, id3v2.Options{Parse: true})
+			require.NoError(t, err)
+			assert.Equal(t, test.version, tg.Version(), test.name)
+			assert.Len(t, tg.GetFrames(tg.CommonID("Attached picture")), 1, test.name)
+			// the custom frame is kept beside the four ReplayGain frames
+			assert.Len(t, tg.GetFrames("TXXX"), 5, test.name)
+			assert.Len(t, tg.GetFrames(tg.CommonID("Comments")), 2, test.name)
+
+			// a full date is kept as the year did not change
+			assert.Equal(t, test.date, tg.GetTextFrame(tg.CommonID("Year")).Text, test.name)
+			tg.Close()
+		}
+
+		// clearing fields removes their frames
+		cleared := library.Track{Path: path, FileType: "MP3", RatingEmail: "grump"}
+		_, err = h.Save(context.Background(), &cleared)
+		require.NoError(t, err, test.name)
+
+		loaded, err = h.Load(context.Background(), path)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, cleared, *loaded, test.name)
+	}
+}
+
+func TestSaveID3v2Unicode(t *testing.T) {
+	path := writeMP3(t, bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x64}, 100), 3, "2015")
+
+	track := mp3Track
+	track.Path = path
+	track.Title = "東京"
+
+	h := &library.ID3v2Handler{}
+	_, err := h.Save(context.Background(), &track)
+	require.NoError(t, err)
+
+	// ID3v2.3 can not hold the title as ISO-8859-1, so the tag is upgraded
+	tg, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	require.NoError(t, err)
+	assert.Equal(t, byte(4), tg.Version())
+	assert.Empty(t, tg.GetFrames("TYER"))
+	tg.Close()
+
+	loaded, err := h.Load(context.Background(), path)
+	require.NoError(t, err)
+	assert.Equal(t, track, *loaded)
+}
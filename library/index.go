@@ -0,0 +1,267 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// IndexVersion is the on-disk format version of the index. Bump this
+	// whenever Track or IndexEntry change in an incompatible way, old indexes
+	// are discarded and rebuilt.
+	IndexVersion = 5
+)
+
+// Index is a persistent cache of track metadata. It lets shelves skip
+// re-reading tags for files that have not changed since the last scan.
+type Index struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]IndexEntry
+	dirty   bool
+
+	// ratingProfile is the name of the profile cached ratings were read with
+	ratingProfile string
+}
+
+// IndexEntry is a cached track along with the file attributes used to detect
+// changes.
+type IndexEntry struct {
+	Size    int64
+	ModTime time.Time
+	Track   Track
+}
+
+// indexFile is the serialized form of an Index
+type indexFile struct {
+	Version       int
+	RatingProfile string
+	Entries       map[string]IndexEntry
+}
+
+// NewIndex creates an empty index that will be saved to path.
+func NewIndex(path string) *Index {
+	return &Index{
+		path:    path,
+		entries: map[string]IndexEntry{},
+	}
+}
+
+// LoadIndex reads an index from disk. A missing file or an index written by a
+// different version yields an empty index rather than an error.
+func LoadIndex(path string) (*Index, error) {
+	idx := NewIndex(path)
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.WithField("path", path).Debug("no library index found, starting fresh")
+		return idx, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read index [%s]: [%s]", path, err.Error())
+	}
+
+	f := indexFile{}
+	err = json.Unmarshal(b, &f)
+	if err != nil {
+		log.WithError(err).WithField("path", path).Warn("could not parse library index, rebuilding")
+		return idx, nil
+	}
+
+	if f.Version != IndexVersion {
+		log.WithFields(log.Fields{
+			"path":     path,
+			"version":  f.Version,
+			"expected": IndexVersion,
+		}).Info("library index version changed, rebuilding")
+		return idx, nil
+	}
+
+	if f.Entries != nil {
+		idx.entries = f.Entries
+	}
+	idx.ratingProfile = f.RatingProfile
+
+	return idx, nil
+}
+
+// SetRatingProfile sets the name of the rating profile tracks are read with.
+// Cached tracks read with another profile are discarded, as their ratings
+// were mapped differently.
+func (i *Index) SetRatingProfile(name string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.ratingProfile == name {
+		return
+	}
+
+	if len(i.entries) > 0 {
+		log.WithFields(log.Fields{
+			"path": i.path,
+			"from": i.ratingProfile,
+			"to":   name,
+		}).Info("rating profile changed, rebuilding library index")
+		i.entries = map[string]IndexEntry{}
+	}
+
+	i.ratingProfile = name
+	i.dirty = true
+}
+
+// Save writes the index to disk if it has changed since it was loaded.
+func (i *Index) Save() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !i.dirty {
+		return nil
+	}
+
+	b, err := json.Marshal(indexFile{
+		Version:       IndexVersion,
+		RatingProfile: i.ratingProfile,
+		Entries:       i.entries,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(i.path), 0755)
+	if err != nil {
+		return fmt.Errorf("could not create index directory [%s]: [%s]", i.path, err.Error())
+	}
+
+	// write to a temp file first so a crash never leaves a truncated index
+	tmp := i.path + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write index [%s]: [%s]", tmp, err.Error())
+	}
+
+	err = os.Rename(tmp, i.path)
+	if err != nil {
+		return fmt.Errorf("could not replace index [%s]: [%s]", i.path, err.Error())
+	}
+
+	i.dirty = false
+	log.WithFields(log.Fields{
+		"path":  i.path,
+		"count": len(i.entries),
+	}).Debug("saved library index")
+
+	return nil
+}
+
+// Len returns the number of tracks in the index
+func (i *Index) Len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return len(i.entries)
+}
+
+// Lookup returns a cached track if the file at path has the same size and
+// modification time as when it was indexed.
+func (i *Index) Lookup(path string, info os.FileInfo) (*Track, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	e, ok := i.entries[indexKey(path)]
+	if !ok {
+		return nil, false
+	}
+
+	if e.Size != info.Size() || !e.ModTime.Equal(info.ModTime()) {
+		return nil, false
+	}
+
+	track := e.Track
+	track.Path = path
+	return &track, true
+}
+
+// Put adds or replaces the track stored for path.
+func (i *Index) Put(path string, info os.FileInfo, track Track) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.entries[indexKey(path)] = IndexEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Track:   track,
+	}
+	i.dirty = true
+}
+
+// Remove drops the track stored for path.
+func (i *Index) Remove(path string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	key := indexKey(path)
+	if _, ok := i.entries[key]; ok {
+		delete(i.entries, key)
+		i.dirty = true
+	}
+}
+
+// Prune removes entries located under directory whose paths are not in seen.
+// It returns the number of entries removed.
+func (i *Index) Prune(directory string, seen map[string]bool) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	dir := indexKey(directory)
+	keep := map[string]bool{}
+	for p := range seen {
+		keep[indexKey(p)] = true
+	}
+
+	pruned := 0
+	for key := range i.entries {
+		if keep[key] || !withinDir(dir, key) {
+			continue
+		}
+
+		delete(i.entries, key)
+		pruned++
+	}
+
+	if pruned > 0 {
+		i.dirty = true
+	}
+
+	return pruned
+}
+
+// indexKey normalizes a path so the same file is always stored under the same
+// key regardless of the working directory.
+func indexKey(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// withinDir checks if path is dir or is located somewhere beneath it
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel == "." || (rel != ".." && !filepath.IsAbs(rel) && !startsWithParent(rel))
+}
+
+func startsWithParent(rel string) bool {
+	return len(rel) >= 3 && rel[:3] == ".."+string(filepath.Separator)
+}
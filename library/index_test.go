@@ -0,0 +1,117 @@
+package library_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexLookup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.wav")
+	require.NoError(t, ioutil.WriteFile(path, []byte("RIFF"), 0644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	idx := library.NewIndex(filepath.Join(dir, "index.json"))
+	_, ok := idx.Lookup(path, info)
+	assert.False(t, ok)
+
+	idx.Put(path, info, library.Track{Title: "cached", Path: path})
+	track, ok := idx.Lookup(path, info)
+	if assert.True(t, ok) {
+		assert.Equal(t, "cached", track.Title)
+	}
+
+	// a changed file should not be served from the index
+	require.NoError(t, ioutil.WriteFile(path, []byte("RIFF plus more"), 0644))
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	_, ok = idx.Lookup(path, info)
+	assert.False(t, ok)
+}
+
+func TestIndexSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.wav")
+	require.NoError(t, ioutil.WriteFile(path, []byte("RIFF"), 0644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	indexPath := filepath.Join(dir, "cache", "index.json")
+	idx := library.NewIndex(indexPath)
+	idx.Put(path, info, library.Track{Title: "saved", Rating: 128})
+	require.NoError(t, idx.Save())
+
+	loaded, err := library.LoadIndex(indexPath)
+	require.NoError(t, err)
+	track, ok := loaded.Lookup(path, info)
+	if assert.True(t, ok) {
+		assert.Equal(t, "saved", track.Title)
+		assert.Equal(t, uint8(128), track.Rating)
+	}
+
+	// the same rating profile keeps the index, another discards it
+	loaded.SetRatingProfile("")
+	assert.Equal(t, 1, loaded.Len())
+	loaded.SetRatingProfile("wmp")
+	assert.Equal(t, 0, loaded.Len())
+
+	// garbage on disk should be discarded rather than fail startup
+	require.NoError(t, ioutil.WriteFile(indexPath, []byte("{nope"), 0644))
+	loaded, err = library.LoadIndex(indexPath)
+	require.NoError(t, err)
+	assert.Equal(t, 0, loaded.Len())
+}
+
+func TestIndexPrune(t *testing.T) {
+	dir := t.TempDir()
+	other := t.TempDir()
+
+	idx := library.NewIndex(filepath.Join(dir, "index.json"))
+	for _, p := range []string{
+		filepath.Join(dir, "keep.wav"),
+		filepath.Join(dir, "sub", "gone.wav"),
+		filepath.Join(other, "elsewhere.wav"),
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, ioutil.WriteFile(p, []byte("RIFF"), 0644))
+		info, err := os.Stat(p)
+		require.NoError(t, err)
+		idx.Put(p, info, library.Track{Path: p})
+	}
+
+	pruned := idx.Prune(dir, map[string]bool{filepath.Join(dir, "keep.wav"): true})
+	assert.Equal(t, 1, pruned)
+	assert.Equal(t, 2, idx.Len())
+}
+
+func TestLocalAudioShelfUsesIndex(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.wav")
+	require.NoError(t, ioutil.WriteFile(path, []byte("RIFF"), 0644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	idx := library.NewIndex(filepath.Join(t.TempDir(), "index.json"))
+	idx.Put(path, info, library.Track{Title: "from index", FileType: "WAV"})
+	idx.Put(filepath.Join(dir, "deleted.wav"), info, library.Track{Title: "deleted"})
+
+	s, err := library.NewLocalAudioShelf(dir)
+	require.NoError(t, err)
+	s.SetIndex(idx)
+
+	count, err := s.LoadTracks()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+	if assert.Len(t, s.Tracks(), 1) {
+		assert.Equal(t, "from index", s.Tracks()[0].Title)
+		assert.Equal(t, path, s.Tracks()[0].Path)
+	}
+	assert.Equal(t, 1, idx.Len())
+}
@@ -1,13 +1,234 @@
 package library
 
-// Library handles metadata about your media library
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Library handles metadata about your media library. It merges the tracks of
+// all of its audio shelves and is itself an AudioShelf, routing changes to
+// whichever shelf owns a track.
 type Library struct {
 	AudioShelves []AudioShelf
+
+	progress ProgressFunc
+
+	// owners maps track paths to the shelf they were loaded from
+	mu     sync.RWMutex
+	owners map[string]AudioShelf
 }
 
 // NewLibrary creates a new library
 func NewLibrary(m []AudioShelf) (*Library, error) {
+	if len(m) == 0 {
+		return nil, errors.New("library needs at least one shelf")
+	}
+
 	return &Library{
 		AudioShelves: m,
+		owners:       map[string]AudioShelf{},
 	}, nil
 }
+
+// Tracks returns the tracks of every shelf, in shelf order
+func (l *Library) Tracks() []Track {
+	tracks := []Track{}
+	for _, shelf := range l.AudioShelves {
+		tracks = append(tracks, shelf.Tracks()...)
+	}
+
+	return tracks
+}
+
+// LoadTracks loads every shelf. A shelf that fails to load is logged and
+// skipped so one unavailable root does not hide the rest of the library.
+func (l *Library) LoadTracks() (uint64, error) {
+	var count uint64
+	var failed int
+
+	progress := make([]ScanProgress, len(l.AudioShelves))
+	for i, shelf := range l.AudioShelves {
+		i := i
+		shelf.SetProgressFunc(func(p ScanProgress) {
+			progress[i] = p
+			l.reportProgress(progress)
+		})
+
+		c, err := shelf.LoadTracks()
+		if err != nil {
+			log.WithError(err).WithField("shelf", i).Error("could not load shelf")
+			failed++
+			continue
+		}
+
+		count += c
+	}
+
+	l.rebuildOwners()
+
+	if failed == len(l.AudioShelves) {
+		return count, errors.New("could not load any shelf")
+	}
+
+	return count, nil
+}
+
+func (l *Library) reportProgress(progress []ScanProgress) {
+	if l.progress == nil {
+		return
+	}
+
+	sum := ScanProgress{}
+	for _, p := range progress {
+		sum.Scanned += p.Scanned
+		sum.Total += p.Total
+	}
+
+	l.progress(sum)
+}
+
+// SetProgressFunc registers a callback for LoadTracks progress across all
+// shelves.
+func (l *Library) SetProgressFunc(f ProgressFunc) {
+	l.progress = f
+}
+
+// LoadTrack loads a track from the shelf that owns location
+func (l *Library) LoadTrack(ctx context.Context, location string) (*Track, error) {
+	shelf, err := l.owner(location)
+	if err != nil {
+		return nil, err
+	}
+
+	return shelf.LoadTrack(ctx, location)
+}
+
+// SaveTrack saves a track using the shelf that owns it
+func (l *Library) SaveTrack(ctx context.Context, prev, track *Track) (*Track, error) {
+	shelf, err := l.owner(track.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return shelf.SaveTrack(ctx, prev, track)
+}
+
+// DeleteTrack deletes a track using the shelf that owns it
+func (l *Library) DeleteTrack(ctx context.Context, track *Track) error {
+	shelf, err := l.owner(track.Path)
+	if err != nil {
+		return err
+	}
+
+	err = shelf.DeleteTrack(ctx, track)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	delete(l.owners, track.Path)
+	l.mu.Unlock()
+
+	return nil
+}
+
+// RestoreTrack restores a deleted track to the shelf it was deleted from
+func (l *Library) RestoreTrack(ctx context.Context, entry TrashEntry) (*Track, error) {
+	for _, shelf := range l.AudioShelves {
+		track, err := shelf.RestoreTrack(ctx, entry)
+		if errors.Is(err, ErrNotOnShelf) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		l.trackOwner(shelf, TrackEvent{Type: TrackAdded, Track: *track})
+		return track, nil
+	}
+
+	return nil, fmt.Errorf("could not restore [%s]: [no shelf owns it]", entry.Path)
+}
+
+// CountPlay counts a play using the shelf that owns a track
+func (l *Library) CountPlay(ctx context.Context, track *Track) (*Track, error) {
+	shelf, err := l.owner(track.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return shelf.CountPlay(ctx, track)
+}
+
+// Watch merges the change events of every shelf
+func (l *Library) Watch(ctx context.Context) (<-chan TrackEvent, error) {
+	merged := make(chan TrackEvent)
+
+	var wg sync.WaitGroup
+	for i, shelf := range l.AudioShelves {
+		events, err := shelf.Watch(ctx)
+		if err != nil {
+			log.WithError(err).WithField("shelf", i).Warn("could not watch shelf")
+			continue
+		}
+
+		wg.Add(1)
+		go func(shelf AudioShelf, events <-chan TrackEvent) {
+			defer wg.Done()
+			for ev := range events {
+				l.trackOwner(shelf, ev)
+				emit(ctx, merged, ev)
+			}
+		}(shelf, events)
+	}
+
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	return merged, nil
+}
+
+// owner returns the shelf a track path belongs to
+func (l *Library) owner(path string) (AudioShelf, error) {
+	l.mu.RLock()
+	shelf, ok := l.owners[path]
+	l.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no shelf owns track [%s]", path)
+	}
+
+	return shelf, nil
+}
+
+// trackOwner keeps track ownership up to date as shelves change
+func (l *Library) trackOwner(shelf AudioShelf, ev TrackEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch ev.Type {
+	case TrackRemoved:
+		delete(l.owners, ev.Track.Path)
+	default:
+		l.owners[ev.Track.Path] = shelf
+	}
+}
+
+func (l *Library) rebuildOwners() {
+	owners := map[string]AudioShelf{}
+	for _, shelf := range l.AudioShelves {
+		for _, track := range shelf.Tracks() {
+			owners[track.Path] = shelf
+		}
+	}
+
+	l.mu.Lock()
+	l.owners = owners
+	l.mu.Unlock()
+}
@@ -0,0 +1,70 @@
+package library_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestShelf(t *testing.T, files ...string) (*library.LocalAudioShelf, string) {
+	dir := t.TempDir()
+	for _, f := range files {
+		p := filepath.Join(dir, f)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, ioutil.WriteFile(p, []byte("RIFF"), 0644))
+	}
+
+	s, err := library.NewLocalAudioShelf(dir)
+	require.NoError(t, err)
+	return s, dir
+}
+
+func TestLibraryMergesShelves(t *testing.T) {
+	a, _ := newTestShelf(t, "a1.wav", "a2.wav")
+	b, _ := newTestShelf(t, "b1.wav", "skip/b2.wav")
+	b.SetExcludes([]string{"skip"})
+
+	db, err := library.NewLibrary([]library.AudioShelf{a, b})
+	require.NoError(t, err)
+
+	var last library.ScanProgress
+	db.SetProgressFunc(func(p library.ScanProgress) { last = p })
+
+	count, err := db.LoadTracks()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), count)
+	assert.Len(t, db.Tracks(), 3)
+	assert.Equal(t, library.ScanProgress{Scanned: 3, Total: 3}, last)
+}
+
+func TestLibraryRoutesToOwner(t *testing.T) {
+	ctx := context.Background()
+	rw, rwDir := newTestShelf(t, "rw.wav")
+	ro, roDir := newTestShelf(t, "ro.wav")
+	ro.SetReadOnly(true)
+
+	db, err := library.NewLibrary([]library.AudioShelf{rw, ro})
+	require.NoError(t, err)
+	_, err = db.LoadTracks()
+	require.NoError(t, err)
+
+	roTrack := library.Track{Path: filepath.Join(roDir, "ro.wav")}
+	err = db.DeleteTrack(ctx, &roTrack)
+	assert.Equal(t, library.ErrReadOnly, err)
+	assert.FileExists(t, roTrack.Path)
+
+	rwTrack := library.Track{Path: filepath.Join(rwDir, "rw.wav")}
+	require.NoError(t, db.DeleteTrack(ctx, &rwTrack))
+	_, err = os.Stat(rwTrack.Path)
+	assert.True(t, os.IsNotExist(err))
+	assert.Len(t, db.Tracks(), 1)
+
+	err = db.DeleteTrack(ctx, &library.Track{Path: "/not/in/library.wav"})
+	assert.Error(t, err)
+}
@@ -4,23 +4,51 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math/big"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/bogem/id3v2"
 	"github.com/dhowden/tag"
 	log "github.com/sirupsen/logrus"
 )
 
+// DefaultScanWorkers is the number of files whose metadata is read
+// concurrently. Tag reading is mostly waiting on disk (or the network, for
+// shares), so this is deliberately higher than the number of CPUs.
+var DefaultScanWorkers = 4 * runtime.NumCPU()
+
 // LocalAudioShelf contains audio media stored in a local filesystem.
 type LocalAudioShelf struct {
 	directory   string
 	files       []string
+	stats       map[string]os.FileInfo
 	filePattern *regexp.Regexp
 	tracks      []Track
+	index       *Index
+	store       *Store
+	ratings     RatingBackend
+	precedence  RatingPrecedence
+	profile     *RatingProfile
+	workers     int
+	progress    ProgressFunc
+	readOnly    bool
+	excludes    []string
+	trash       *Trash
+	cleanup     bool
+
+	// mu guards tracks and stats, which are modified by Watch, Organize and
+	// RestoreTrack
+	mu sync.RWMutex
+
+	// saveMu makes saves one at a time, so two never write the same file at
+	// once or undo each other's changes
+	saveMu sync.Mutex
 }
 
 // NewLocalAudioShelf creates a shelf for a specific directory.
@@ -30,11 +58,94 @@ func NewLocalAudioShelf(directory string) (*LocalAudioShelf, error) {
 	l := LocalAudioShelf{
 		directory:   directory,
 		filePattern: r,
+		stats:       map[string]os.FileInfo{},
+		workers:     DefaultScanWorkers,
+		precedence:  RatingTagFirst,
 	}
 
 	return &l, nil
 }
 
+// ErrReadOnly is returned when modifying a track on a read-only shelf
+var ErrReadOnly = errors.New("shelf is read-only")
+
+// ErrNotSupported is returned when saving metadata to a file type that
+// cannot be written yet
+var ErrNotSupported = errors.New("saving metadata is not supported for this file type")
+
+// SetReadOnly prevents tracks on the shelf from being saved or deleted
+func (l *LocalAudioShelf) SetReadOnly(readOnly bool) {
+	l.readOnly = readOnly
+}
+
+// SetExcludes sets glob patterns for files and directories to skip. Patterns
+// are matched against both the base name and the path relative to the shelf
+// directory, eg: "*.tmp", "Podcasts", "incoming/*".
+func (l *LocalAudioShelf) SetExcludes(patterns []string) {
+	l.excludes = patterns
+}
+
+// Excluded checks if path matches one of the shelf's exclude patterns
+func (l *LocalAudioShelf) Excluded(path string) bool {
+	if len(l.excludes) == 0 {
+		return false
+	}
+
+	name := filepath.Base(path)
+	rel, err := filepath.Rel(l.directory, path)
+	if err != nil {
+		rel = path
+	}
+
+	for _, pattern := range l.excludes {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetWorkers sets the number of files scanned concurrently
+func (l *LocalAudioShelf) SetWorkers(n int) {
+	l.workers = n
+}
+
+// SetIndex sets a persistent index used to avoid re-reading metadata of
+// unchanged files. The index may be shared between shelves.
+func (l *LocalAudioShelf) SetIndex(index *Index) {
+	l.index = index
+}
+
+// SetStore sets where play counts that can not be written to the files
+// themselves are kept. The store may be shared between shelves.
+func (l *LocalAudioShelf) SetStore(store *Store) {
+	l.store = store
+}
+
+// SetRatings sets where ratings are kept when a file can not be written, and
+// whether they win over the rating in a file's tags. The backend may be
+// shared between shelves.
+func (l *LocalAudioShelf) SetRatings(backend RatingBackend, precedence RatingPrecedence) {
+	l.ratings = backend
+	l.precedence = precedence
+}
+
+// SetTrash moves deleted tracks into trash rather than removing them. With
+// cleanup, sidecar files left without a track and empty directories go too.
+func (l *LocalAudioShelf) SetTrash(trash *Trash, cleanup bool) {
+	l.trash = trash
+	l.cleanup = cleanup
+}
+
+// SetRatingProfile sets how ratings are mapped to and from ID3 POPM frames
+func (l *LocalAudioShelf) SetRatingProfile(profile *RatingProfile) {
+	l.profile = profile
+}
+
 // LoadTracks searches through library for files to add to the database.
 // TODO: add unit tests for this
 func (l *LocalAudioShelf) LoadTracks() (uint64, error) {
@@ -57,6 +168,8 @@ func (l *LocalAudioShelf) LoadTracks() (uint64, error) {
 // scan library directory for files
 func (l *LocalAudioShelf) pathScan() (uint64, error) {
 	var scanCount uint64
+	l.files = []string{}
+	stats := map[string]os.FileInfo{}
 
 	err := filepath.Walk(l.directory,
 		func(path string, info os.FileInfo, err error) error {
@@ -70,6 +183,10 @@ func (l *LocalAudioShelf) pathScan() (uint64, error) {
 			}
 
 			if info.IsDir() {
+				if path != l.directory && l.Excluded(path) {
+					log.WithField("path", path).Debug("skipping excluded directory")
+					return filepath.SkipDir
+				}
 				return nil
 			}
 
@@ -80,11 +197,16 @@ func (l *LocalAudioShelf) pathScan() (uint64, error) {
 
 			log.WithField("path", path).Debug("adding path to library")
 			l.files = append(l.files, path)
+			stats[path] = info
 			scanCount++
 
 			return nil
 		})
 
+	l.mu.Lock()
+	l.stats = stats
+	l.mu.Unlock()
+
 	if err != nil {
 		return scanCount, err
 	}
@@ -101,35 +223,205 @@ func (l *LocalAudioShelf) ShouldInclude(path string) bool {
 		return false
 	}
 
+	if l.Excluded(path) {
+		return false
+	}
+
 	return true
 }
 
 func (l *LocalAudioShelf) loadTracks() (uint64, error) {
-	tracks := []Track{}
 	ctx := context.Background()
+	total := uint64(len(l.files))
 
-	// TODO: scan for metadata/id3
-	var scanCount uint64
-	for _, file := range l.files {
-		track, err := l.LoadTrack(ctx, file)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"path":  file,
-				"error": err,
-			}).Error("could not load track")
+	// results are written by position so output order matches walk order no
+	// matter which worker finishes first
+	results := make([]scanResult, len(l.files))
+	jobs := make(chan int)
+	done := make(chan int)
+
+	workers := l.workers
+	if workers < 1 {
+		workers = 1
+	}
 
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = l.scanFile(ctx, l.files[i])
+				done <- i
+			}
+		}()
+	}
+
+	go func() {
+		for i := range l.files {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(done)
+	}()
+
+	l.reportProgress(0, total)
+	var scanned uint64
+	for range done {
+		scanned++
+		l.reportProgress(scanned, total)
+	}
+
+	tracks := []Track{}
+	var scanCount, cached uint64
+	for _, r := range results {
+		if r.track == nil {
 			continue
 		}
-		tracks = append(tracks, *track)
+
+		tracks = append(tracks, *r.track)
 		scanCount++
+		if r.cached {
+			cached++
+		}
+	}
+
+	if l.index != nil {
+		seen := make(map[string]bool, len(l.files))
+		for _, file := range l.files {
+			seen[file] = true
+		}
+		pruned := l.index.Prune(l.directory, seen)
+
+		log.WithFields(log.Fields{
+			"cached": cached,
+			"parsed": scanCount - cached,
+			"pruned": pruned,
+		}).Debug("library index updated")
+
+		err := l.index.Save()
+		if err != nil {
+			log.WithError(err).Error("could not save library index")
+		}
 	}
 
+	l.mu.Lock()
 	l.tracks = tracks
+	l.mu.Unlock()
+
 	return scanCount, nil
 }
 
+// scanResult is the outcome of scanning a single file
+type scanResult struct {
+	track  *Track
+	cached bool
+}
+
+// scanFile loads track metadata from the index, or from the file itself if it
+// has changed. It is safe to call from multiple goroutines.
+func (l *LocalAudioShelf) scanFile(ctx context.Context, path string) scanResult {
+	if track, ok := l.cachedTrack(path); ok {
+		l.applyStore(track)
+		return scanResult{track: track, cached: true}
+	}
+
+	track, err := l.loadTrack(ctx, path)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":  path,
+			"error": err,
+		}).Error("could not load track")
+
+		return scanResult{}
+	}
+
+	// the index holds what is in the file, the store is applied on top
+	l.indexTrack(path, *track)
+	l.applyStore(track)
+	return scanResult{track: track}
+}
+
+func (l *LocalAudioShelf) applyStore(track *Track) {
+	if l.store != nil {
+		l.store.apply(track)
+	}
+
+	if l.ratings == nil {
+		return
+	}
+
+	// a rating kept because the file could not be written wins until the
+	// file is rated again
+	rating, ok := l.ratings.Rating(*track)
+	if ok && (l.precedence == RatingStoreFirst || track.Rating == 0 || l.ratings.Overrides(*track)) {
+		track.Rating = rating
+	}
+}
+
+// SetProgressFunc registers a callback for LoadTracks progress
+func (l *LocalAudioShelf) SetProgressFunc(f ProgressFunc) {
+	l.progress = f
+}
+
+func (l *LocalAudioShelf) reportProgress(scanned, total uint64) {
+	log.WithFields(log.Fields{
+		"scanned": scanned,
+		"total":   total,
+	}).Trace("scan progress")
+
+	if l.progress == nil {
+		return
+	}
+
+	l.progress(ScanProgress{Scanned: scanned, Total: total})
+}
+
+// cachedTrack returns a track from the index if the file has not changed
+func (l *LocalAudioShelf) cachedTrack(path string) (*Track, bool) {
+	if l.index == nil {
+		return nil, false
+	}
+
+	l.mu.RLock()
+	info, ok := l.stats[path]
+	l.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	return l.index.Lookup(path, info)
+}
+
+// indexTrack stores a freshly loaded track in the index
+func (l *LocalAudioShelf) indexTrack(path string, track Track) {
+	if l.index == nil {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		log.WithError(err).WithField("path", path).Warn("could not stat file for index")
+		return
+	}
+
+	l.index.Put(path, info, track)
+}
+
 // LoadTrack reads in track metadata
 func (l *LocalAudioShelf) LoadTrack(ctx context.Context, path string) (*Track, error) {
+	track, err := l.loadTrack(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	l.applyStore(track)
+	return track, nil
+}
+
+// loadTrack reads track metadata from the file alone
+func (l *LocalAudioShelf) loadTrack(ctx context.Context, path string) (*Track, error) {
 	h, err := l.handler(ctx, path)
 	if err != nil {
 		return nil, err
@@ -138,31 +430,303 @@ func (l *LocalAudioShelf) LoadTrack(ctx context.Context, path string) (*Track, e
 	return h.Load(ctx, path)
 }
 
-// SaveTrack saves track metadata
+// SaveTrack saves track metadata. If the file can not be written and only
+// the rating, play count or ReplayGain changed, they are kept in the store
+// instead.
+//
+// Only the fields that differ between prev and track are saved, on top of
+// the shelf's current copy of the track, so saving a stale copy does not undo
+// changes made since it was taken.
 func (l *LocalAudioShelf) SaveTrack(ctx context.Context, prev, track *Track) (*Track, error) {
+	l.saveMu.Lock()
+	defer l.saveMu.Unlock()
+
+	if prev != nil {
+		if cur, ok := l.currentTrack(prev.Path); ok {
+			merged := mergeTrack(cur, *prev, *track)
+			prev, track = &cur, &merged
+		}
+	}
+
+	return l.saveTrack(ctx, prev, track)
+}
+
+// saveTrack saves track metadata, the caller holds saveMu
+func (l *LocalAudioShelf) saveTrack(ctx context.Context, prev, track *Track) (*Track, error) {
+	saved, err := l.saveFile(ctx, track)
+	if err != nil {
+		if !l.storable(prev, track) {
+			return nil, err
+		}
+
+		log.WithError(err).WithField("path", track.Path).Debug("could not save track to file, keeping it in the store")
+		return l.saveStored(prev, track)
+	}
+
+	l.indexTrack(saved.Path, *saved)
+	l.putTrack(*saved)
+
+	if l.store != nil && prev != nil {
+		l.store.Rekey(*prev, *saved)
+		l.saveStore()
+	}
+
+	// keep the backend in step so a stale rating there never shadows the
+	// file's, and so store-first ratings are kept even where files are
+	if l.ratings != nil && (prev == nil || prev.Rating != saved.Rating) {
+		_, stored := l.ratings.Rating(*saved)
+		if stored || l.precedence == RatingStoreFirst {
+			err = l.ratings.SetRating(*saved, saved.Rating)
+			if err != nil {
+				log.WithError(err).WithField("path", saved.Path).Error("could not store rating")
+			}
+		}
+	}
+
+	return saved, nil
+}
+
+// saveFile writes track metadata to its file
+func (l *LocalAudioShelf) saveFile(ctx context.Context, track *Track) (*Track, error) {
+	if l.readOnly {
+		return nil, ErrReadOnly
+	}
+
 	h, err := l.handler(ctx, track.Path)
 	if err != nil {
 		return nil, err
 	}
 
-	return h.Save(ctx, track)
+	saved, err := h.Save(ctx, track)
+	if err != nil {
+		return nil, err
+	}
+
+	if saved == nil {
+		return nil, fmt.Errorf("could not save track [%s]: [%s]", track.Path, ErrNotSupported.Error())
+	}
+
+	return saved, nil
+}
+
+// storable checks if the changes from prev to track can all be kept outside
+// of the file
+func (l *LocalAudioShelf) storable(prev, track *Track) bool {
+	if prev == nil {
+		return false
+	}
+
+	if prev.Rating != track.Rating && l.ratings == nil {
+		return false
+	}
+
+	if (prev.PlayCount != track.PlayCount || prev.ReplayGain != track.ReplayGain) && l.store == nil {
+		return false
+	}
+
+	rest := *track
+	rest.Rating, rest.RatingEmail, rest.PlayCount = prev.Rating, prev.RatingEmail, prev.PlayCount
+	rest.ReplayGain = prev.ReplayGain
+	return rest == *prev
+}
+
+// saveStored keeps a track's rating, play count and ReplayGain outside of
+// its file
+func (l *LocalAudioShelf) saveStored(prev, track *Track) (*Track, error) {
+	if prev.PlayCount != track.PlayCount {
+		l.store.Update(*track, func(e *StoreEntry) {
+			e.PlayCount = track.PlayCount
+		})
+		l.saveStore()
+	}
+
+	if prev.ReplayGain != track.ReplayGain {
+		rg := track.ReplayGain
+		l.store.Update(*track, func(e *StoreEntry) {
+			e.ReplayGain = &rg
+			if rg == (ReplayGain{}) {
+				e.ReplayGain = nil
+			}
+		})
+		l.saveStore()
+	}
+
+	if prev.Rating != track.Rating {
+		err := l.ratings.OverrideRating(*track, track.Rating, prev.Rating)
+		if err != nil {
+			return nil, fmt.Errorf("could not store rating [%s]: [%s]", track.Path, err.Error())
+		}
+	}
+
+	saved := *track
+	l.putTrack(saved)
+	return &saved, nil
 }
 
-// DeleteTrack deletes a track from local audio shelf
+// CountPlay adds a play to a track. The count is written to the file's tags
+// when possible, and otherwise kept in the shelf's store.
+func (l *LocalAudioShelf) CountPlay(ctx context.Context, track *Track) (*Track, error) {
+	l.saveMu.Lock()
+	defer l.saveMu.Unlock()
+
+	// count on the current track, which may have been saved since this
+	// copy was taken
+	cur, ok := l.currentTrack(track.Path)
+	if !ok {
+		cur = *track
+	}
+
+	counted := cur
+	counted.PlayCount++
+
+	return l.saveTrack(ctx, &cur, &counted)
+}
+
+// currentTrack returns the shelf's copy of the track at path
+func (l *LocalAudioShelf) currentTrack(path string) (Track, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, track := range l.tracks {
+		if track.Path == path {
+			return track, true
+		}
+	}
+
+	return Track{}, false
+}
+
+// mergeTrack applies the fields that differ between prev and track to cur
+func mergeTrack(cur, prev, track Track) Track {
+	c := reflect.ValueOf(&cur).Elem()
+	p := reflect.ValueOf(prev)
+	t := reflect.ValueOf(track)
+	for i := 0; i < c.NumField(); i++ {
+		if p.Field(i).Interface() != t.Field(i).Interface() {
+			c.Field(i).Set(t.Field(i))
+		}
+	}
+
+	return cur
+}
+
+func (l *LocalAudioShelf) saveStore() {
+	err := l.store.Save()
+	if err != nil {
+		log.WithError(err).Error("could not save store")
+	}
+}
+
+// DeleteTrack deletes a track from local audio shelf. It is moved to the
+// trash, if the shelf has one.
 func (l *LocalAudioShelf) DeleteTrack(ctx context.Context, track *Track) error {
+	if l.readOnly {
+		return ErrReadOnly
+	}
+
 	if track.Path == "" {
 		return errors.New("track has no path")
 	}
 
-	err := os.Remove(track.Path)
+	sidecars := []string{}
+	if l.cleanup {
+		sidecars = l.orphanedSidecars(track.Path)
+	}
 
-	if err != nil {
-		return err
+	if l.trash != nil {
+		_, err := l.trash.Put(track.Path, sidecars)
+		if err != nil {
+			return err
+		}
+	} else {
+		err := os.Remove(track.Path)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range sidecars {
+			err := os.Remove(s)
+			if err != nil {
+				log.WithError(err).WithField("path", s).Warn("could not remove sidecar file")
+			}
+		}
+	}
+
+	l.removePath(track.Path)
+
+	if l.cleanup {
+		l.removeEmptyDirs(filepath.Dir(track.Path))
 	}
 
 	return nil
 }
 
+// orphanedSidecars returns the files that belong to the track at path alone,
+// eg: its lyrics, or the cover of an album it is the last track of
+func (l *LocalAudioShelf) orphanedSidecars(path string) []string {
+	sidecars := []string{}
+	for _, ext := range sidecarExts {
+		s := strings.TrimSuffix(path, filepath.Ext(path)) + ext
+		if _, err := os.Stat(s); err == nil {
+			sidecars = append(sidecars, s)
+		}
+	}
+
+	dir := filepath.Dir(path)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return sidecars
+	}
+
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		if p != path && !e.IsDir() && l.filePattern.MatchString(strings.ToLower(e.Name())) {
+			return sidecars
+		}
+	}
+
+	return append(sidecars, folderArtworkFiles(dir)...)
+}
+
+// RestoreTrack moves a trashed track back onto the shelf
+func (l *LocalAudioShelf) RestoreTrack(ctx context.Context, entry TrashEntry) (*Track, error) {
+	if !withinDir(l.directory, entry.Path) {
+		return nil, ErrNotOnShelf
+	}
+
+	if l.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	if l.trash == nil {
+		return nil, errors.New("shelf has no trash")
+	}
+
+	err := l.trash.Restore(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(entry.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	track, err := l.LoadTrack(ctx, entry.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.stats[entry.Path] = info
+	l.mu.Unlock()
+
+	l.indexTrack(entry.Path, *track)
+	l.putTrack(*track)
+
+	return track, nil
+}
+
 // handler returns a filetype-specific track handler responsible for
 // loading/saving metadata
 func (l *LocalAudioShelf) handler(ctx context.Context, path string) (TrackHandler, error) {
@@ -170,11 +734,11 @@ func (l *LocalAudioShelf) handler(ctx context.Context, path string) (TrackHandle
 
 	switch ext {
 	case ".mp3":
-		return &ID3v2Handler{}, nil
+		return &ID3v2Handler{Profile: l.profile}, nil
 	case ".flac", ".ogg":
 		return &TagHandler{}, nil
 	case ".wav":
-		return &WAVHandler{}, nil
+		return &WAVHandler{Profile: l.profile}, nil
 	default:
 		return nil, fmt.Errorf("unsupported file extension: [%s]: %s", ext, path)
 	}
@@ -196,36 +760,81 @@ func (s *TagHandler) Load(ctx context.Context, path string) (*Track, error) {
 		return nil, fmt.Errorf("could not read metadata [%s]: [%s]", path, err.Error())
 	}
 
-	trackNumber, trackTotal := m.Track()
-	discNumber, discTotal := m.Disc()
-
-	track := Track{
-		Title:       m.Title(),
-		Artist:      m.Artist(),
-		Album:       m.Album(),
-		AlbumArtist: m.AlbumArtist(),
-		DiscNumber:  discNumber,
-		DiscTotal:   discTotal,
-		TrackNumber: trackNumber,
-		TrackTotal:  trackTotal,
-		Composer:    m.Composer(),
-		Year:        m.Year(),
-		Genre:       m.Genre(),
-		Lyrics:      m.Lyrics(),
-		Comment:     m.Comment(),
-		FileType:    string(m.FileType()),
-		Path:        path,
-	}
+	// the tag package drops totals written as 3/12, aliases and full
+	// dates, so fields are read from the raw vorbis comments instead
+	raw := m.Raw()
+	track := vorbisTrack(func(key string) string {
+		return rawString(raw, strings.ToLower(key))
+	})
+	track.FileType = string(m.FileType())
+	track.Path = path
+
+	track.ArtistSort = rawString(raw, "artistsort")
+	track.AlbumSort = rawString(raw, "albumsort")
+	track.AlbumArtistSort = rawString(raw, "albumartistsort")
+	track.TitleSort = rawString(raw, "titlesort")
+	track.Rating = vorbisRating(raw)
+	track.PlayCount = vorbisPlayCount(raw)
+	track.ReplayGain = vorbisReplayGain(raw)
+
+	loadProperties(&track)
 	return &track, nil
 }
 
-// Save track metadata
+// loadProperties reads the length and technical properties of a track. A
+// file whose stream headers can not be read is still listed.
+func loadProperties(track *Track) {
+	err := readProperties(track.Path, track)
+	if err != nil {
+		log.WithError(err).Debug("could not read audio properties")
+	}
+}
+
+// rawString returns a raw tag value if it is a string
+func rawString(raw map[string]interface{}, key string) string {
+	v, _ := raw[key].(string)
+	return v
+}
+
+// Save writes track metadata to the vorbis comments of a FLAC or Ogg Vorbis
+// file. Comments and pictures grump does not manage are preserved.
 func (s *TagHandler) Save(ctx context.Context, track *Track) (*Track, error) {
-	return nil, nil
+	log.WithFields(log.Fields{
+		"path":   track.Path,
+		"artist": track.Artist,
+		"album":  track.Album,
+		"title":  track.Title,
+		"rating": track.Rating,
+		"plays":  track.PlayCount,
+	}).Debug("saving vorbis comments")
+
+	update := func(vc *vorbisComments) {
+		vc.setTrack(track)
+	}
+
+	var err error
+	ext := strings.ToLower(filepath.Ext(track.Path))
+	switch ext {
+	case ".flac":
+		err = writeFLACComments(track.Path, update)
+	case ".ogg":
+		err = writeOggComments(track.Path, update)
+	default:
+		err = fmt.Errorf("unsupported file extension: [%s]: %s", ext, track.Path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return track, nil
 }
 
 // ID3v2Handler uses the id3v2 package
-type ID3v2Handler struct{}
+type ID3v2Handler struct {
+	// Profile maps POPM ratings, nil uses DefaultRatingProfile
+	Profile *RatingProfile
+}
 
 // Load returns metadata for for a track using id3v2 package
 func (s *ID3v2Handler) Load(ctx context.Context, path string) (*Track, error) {
@@ -235,25 +844,11 @@ func (s *ID3v2Handler) Load(ctx context.Context, path string) (*Track, error) {
 	}
 	defer t.Close()
 
-	track := Track{
-		Title:  t.Title(),
-		Artist: t.Artist(),
-		Album:  t.Album(),
-		//Year:     t.Year(),
-		Genre:       t.Genre(),
-		FileType:    "MP3",
-		Path:        path,
-		RatingEmail: "grump",
-	}
-
-	// popm
-	f := t.GetLastFrame(t.CommonID("Popularimeter"))
-	popm, ok := f.(id3v2.PopularimeterFrame)
-	if ok {
-		track.Rating = popm.Rating
-		track.RatingEmail = popm.Email
-	}
+	track := id3Track(t, ratingProfile(s.Profile))
+	track.FileType = "MP3"
+	track.Path = path
 
+	loadProperties(&track)
 	return &track, nil
 }
 
@@ -274,56 +869,48 @@ func (s *ID3v2Handler) Save(ctx context.Context, track *Track) (*Track, error) {
 	}
 	defer tag.Close()
 
-	// Text Tags
-	tag.SetTitle(track.Title)
-	tag.SetAlbum(track.Album)
-	tag.SetArtist(track.Artist)
-
-	// POPM
-	frame := tag.GetLastFrame(tag.CommonID("Popularimeter"))
-	popm, ok := frame.(id3v2.PopularimeterFrame)
-	if ok {
-		log.WithFields(log.Fields{
-			"prevRating": popm.Rating,
-			"prevEmail":  popm.Email,
-			"path":       track.Path,
-		}).Debug("POPM already set")
-	}
-	log.WithFields(log.Fields{
-		"rating": track.Rating,
-		"email":  track.RatingEmail,
-		"path":   track.Path,
-	}).Debug("setting POPM")
-
-	popmFrame := id3v2.PopularimeterFrame{
-		Email:   track.RatingEmail,
-		Rating:  track.Rating,
-		Counter: big.NewInt(int64(track.PlayCount)),
-	}
-	tag.AddFrame(tag.CommonID("Popularimeter"), popmFrame)
+	setID3Track(tag, track, ratingProfile(s.Profile))
 
 	return track, tag.Save()
 }
 
-// WAVHandler scans wav metadata
-type WAVHandler struct{}
+// WAVHandler reads and writes wav metadata from RIFF INFO and id3 chunks
+type WAVHandler struct {
+	// Profile maps POPM ratings in the id3 chunk, nil uses
+	// DefaultRatingProfile
+	Profile *RatingProfile
+}
 
 // Load scans wav metadata
 func (s *WAVHandler) Load(ctx context.Context, path string) (*Track, error) {
-	track := Track{
-		FileType: "WAV",
-		Path:     path,
-	}
-	return &track, nil
+	return loadWAV(path, ratingProfile(s.Profile))
 }
 
 // Save track metadata
 func (s *WAVHandler) Save(ctx context.Context, track *Track) (*Track, error) {
-	return nil, nil
+	log.WithFields(log.Fields{
+		"path":   track.Path,
+		"artist": track.Artist,
+		"album":  track.Album,
+		"title":  track.Title,
+		"rating": track.Rating,
+	}).Debug("saving wav metadata")
+
+	err := saveWAV(track, ratingProfile(s.Profile))
+	if err != nil {
+		return nil, err
+	}
+
+	return track, nil
 }
 
 // Tracks returns playable audio tracks on the shelf
 // TODO scan this
 func (l *LocalAudioShelf) Tracks() []Track {
-	return l.tracks
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	tracks := make([]Track, len(l.tracks))
+	copy(tracks, l.tracks)
+	return tracks
 }
@@ -0,0 +1,438 @@
+package library
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ReplayGainReference is the loudness ReplayGain 2.0 plays tracks at, in
+// LUFS
+const ReplayGainReference = -18.0
+
+const (
+	// loudnessAbsoluteGate ignores gating blocks quieter than this, in LUFS
+	loudnessAbsoluteGate = -70.0
+
+	// loudnessRelativeGate ignores gating blocks this much quieter than the
+	// rest, in LU
+	loudnessRelativeGate = -10.0
+
+	// loudnessSubBlocks is the number of 100ms steps in a 400ms gating
+	// block, which overlap by 75%
+	loudnessSubBlocks = 4
+
+	// truePeakOversampling is how many times samples are oversampled to find
+	// peaks between them, for sample rates below 96kHz
+	truePeakOversampling = 4
+
+	// truePeakTaps is the number of samples each interpolated value is
+	// computed from
+	truePeakTaps = 12
+)
+
+// Loudness is the loudness of a track or album as measured by EBU R 128
+// (ITU-R BS.1770)
+type Loudness struct {
+	// Integrated loudness in LUFS, -Inf for silence
+	Integrated float64
+
+	// Peak is the true peak, where 1 is full scale
+	Peak float64
+
+	// blocks are the power of each gating block, kept to measure albums
+	blocks []float64
+}
+
+// Gain returns the ReplayGain to play l at the reference loudness, in dB.
+// Silence has no gain.
+func (l Loudness) Gain() float64 {
+	if math.IsInf(l.Integrated, 0) {
+		return 0
+	}
+	return ReplayGainReference - l.Integrated
+}
+
+// ReplayGain returns the ReplayGain of a track, within album unless it is
+// nil. Values are rounded as they are written to tags.
+func (l Loudness) ReplayGain(album *Loudness) ReplayGain {
+	r := ReplayGain{
+		TrackGain: math.Round(l.Gain()*100) / 100,
+		TrackPeak: math.Round(l.Peak*1e6) / 1e6,
+	}
+
+	if album != nil {
+		r.AlbumGain = math.Round(album.Gain()*100) / 100
+		r.AlbumPeak = math.Round(album.Peak*1e6) / 1e6
+	}
+
+	return r
+}
+
+// AlbumLoudness measures an album from the loudness of its tracks. Like the
+// spec asks, this gates every block of the album at once rather than
+// averaging its tracks.
+func AlbumLoudness(tracks []Loudness) Loudness {
+	album := Loudness{}
+	for _, t := range tracks {
+		album.blocks = append(album.blocks, t.blocks...)
+		album.Peak = math.Max(album.Peak, t.Peak)
+	}
+
+	album.Integrated = integratedLoudness(album.blocks)
+	return album
+}
+
+// MeasureLoudness decodes a track and measures its loudness
+func MeasureLoudness(ctx context.Context, track Track) (Loudness, error) {
+	s, format, err := OpenAudio(track)
+	if err != nil {
+		return Loudness{}, fmt.Errorf("could not open audio [%s]: [%s]", track.Path, err.Error())
+	}
+	defer s.Close()
+
+	m := newLoudnessMeter(int(format.SampleRate), format.NumChannels)
+	buf := make([][2]float64, 4096)
+	for {
+		if err := ctx.Err(); err != nil {
+			return Loudness{}, err
+		}
+
+		n, ok := s.Stream(buf)
+		m.write(buf[:n])
+		if !ok {
+			break
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return Loudness{}, fmt.Errorf("could not decode audio [%s]: [%s]", track.Path, err.Error())
+	}
+
+	return m.loudness(), nil
+}
+
+// ScanLoudness measures tracks and returns them with their ReplayGain set.
+// Tracks in the same directory with the same album tag also get an album
+// gain. done is called as each track is measured, never concurrently.
+// Tracks that could not be measured are left out.
+func ScanLoudness(ctx context.Context, tracks []Track, workers int, done func(track Track, err error)) []Track {
+	type result struct {
+		i        int
+		loudness Loudness
+		err      error
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan int)
+	results := make(chan result)
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range jobs {
+				l, err := MeasureLoudness(ctx, tracks[i])
+				results <- result{i: i, loudness: l, err: err}
+			}
+		}()
+	}
+
+	// once ctx is done the remaining tracks fail right away
+	go func() {
+		defer close(jobs)
+		for i := range tracks {
+			jobs <- i
+		}
+	}()
+
+	measured := map[int]Loudness{}
+	for range tracks {
+		r := <-results
+		if r.err == nil {
+			measured[r.i] = r.loudness
+		}
+		if done != nil {
+			done(tracks[r.i], r.err)
+		}
+	}
+
+	albums := map[string][]Loudness{}
+	for i, l := range measured {
+		if key := albumKey(tracks[i]); key != "" {
+			albums[key] = append(albums[key], l)
+		}
+	}
+
+	scanned := []Track{}
+	for i, track := range tracks {
+		l, ok := measured[i]
+		if !ok {
+			continue
+		}
+
+		var album *Loudness
+		if key := albumKey(track); key != "" {
+			a := AlbumLoudness(albums[key])
+			album = &a
+		}
+
+		track.ReplayGain = l.ReplayGain(album)
+		scanned = append(scanned, track)
+	}
+
+	sort.SliceStable(scanned, func(i, j int) bool { return scanned[i].Path < scanned[j].Path })
+	return scanned
+}
+
+// albumKey groups the tracks of an album for measuring, or is empty for
+// tracks without an album tag
+func albumKey(track Track) string {
+	if track.Album == "" {
+		return ""
+	}
+	return filepath.Dir(track.Path) + "\x00" + strings.ToLower(track.Album)
+}
+
+// AlbumTracks returns every track of tracks' albums, so adding a track to an
+// album gets the whole album measured again
+func AlbumTracks(all, tracks []Track) []Track {
+	keys := map[string]bool{}
+	paths := map[string]bool{}
+	for _, track := range tracks {
+		paths[track.Path] = true
+		if key := albumKey(track); key != "" {
+			keys[key] = true
+		}
+	}
+
+	albums := []Track{}
+	for _, track := range all {
+		if paths[track.Path] || keys[albumKey(track)] {
+			albums = append(albums, track)
+		}
+	}
+	return albums
+}
+
+// integratedLoudness gates blocks, first absolutely and then relative to
+// the blocks that are left, and returns the loudness of the rest
+func integratedLoudness(blocks []float64) float64 {
+	gated := func(threshold float64) (float64, int) {
+		sum, n := 0.0, 0
+		for _, b := range blocks {
+			if blockLoudness(b) > threshold {
+				sum += b
+				n++
+			}
+		}
+
+		if n == 0 {
+			return 0, 0
+		}
+		return sum / float64(n), n
+	}
+
+	power, n := gated(loudnessAbsoluteGate)
+	if n == 0 {
+		return math.Inf(-1)
+	}
+
+	power, n = gated(math.Max(loudnessAbsoluteGate, blockLoudness(power)+loudnessRelativeGate))
+	if n == 0 {
+		return math.Inf(-1)
+	}
+
+	return blockLoudness(power)
+}
+
+// blockLoudness converts the power of a block to LUFS
+func blockLoudness(power float64) float64 {
+	return -0.691 + 10*math.Log10(power)
+}
+
+// loudnessMeter measures the loudness of a stream of samples
+type loudnessMeter struct {
+	channels int
+	filters  [][2]biquad
+	truePeak *truePeakMeter
+	peak     float64
+
+	// the power of each 100ms step, and of the step in progress
+	stepLen int
+	count   int
+	sum     float64
+	steps   []float64
+}
+
+func newLoudnessMeter(rate, channels int) *loudnessMeter {
+	if channels < 1 || channels > 2 {
+		channels = 2
+	}
+
+	m := &loudnessMeter{
+		channels: channels,
+		filters:  make([][2]biquad, channels),
+		stepLen:  rate / 10,
+	}
+
+	for c := range m.filters {
+		m.filters[c] = kWeighting(float64(rate))
+	}
+
+	if rate < 96000 {
+		m.truePeak = newTruePeakMeter(channels)
+	}
+
+	return m
+}
+
+// write measures samples. Mono streams are measured from the first channel
+// alone.
+func (m *loudnessMeter) write(samples [][2]float64) {
+	for _, s := range samples {
+		for c := 0; c < m.channels; c++ {
+			x := s[c]
+			m.peak = math.Max(m.peak, math.Abs(x))
+			if m.truePeak != nil {
+				m.peak = math.Max(m.peak, m.truePeak.push(c, x))
+			}
+
+			y := m.filters[c][1].process(m.filters[c][0].process(x))
+			m.sum += y * y
+		}
+
+		m.count++
+		if m.count == m.stepLen {
+			m.steps = append(m.steps, m.sum/float64(m.stepLen))
+			m.count, m.sum = 0, 0
+		}
+	}
+}
+
+// loudness returns the loudness of everything written so far
+func (m *loudnessMeter) loudness() Loudness {
+	blocks := []float64{}
+	for i := 0; i+loudnessSubBlocks <= len(m.steps); i++ {
+		sum := 0.0
+		for _, s := range m.steps[i : i+loudnessSubBlocks] {
+			sum += s
+		}
+		blocks = append(blocks, sum/loudnessSubBlocks)
+	}
+
+	// a stream shorter than a block is measured as one
+	if len(blocks) == 0 && m.count+len(m.steps) > 0 {
+		sum, n := m.sum, m.count
+		for _, s := range m.steps {
+			sum += s * float64(m.stepLen)
+			n += m.stepLen
+		}
+		blocks = append(blocks, sum/float64(n))
+	}
+
+	return Loudness{
+		Integrated: integratedLoudness(blocks),
+		Peak:       m.peak,
+		blocks:     blocks,
+	}
+}
+
+// biquad is a second order IIR filter
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns the two filters of the BS.1770 K-weighting curve, a high
+// shelf for the head followed by a high pass, designed for any sample rate
+// the same way as libebur128
+func kWeighting(rate float64) [2]biquad {
+	f0, g, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / rate)
+	vh := math.Pow(10, g/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / rate)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	return [2]biquad{shelf, highPass}
+}
+
+// truePeakMeter finds peaks between samples by interpolating them with a
+// windowed sinc
+type truePeakMeter struct {
+	coefs   [][]float64
+	history [][]float64
+}
+
+func newTruePeakMeter(channels int) *truePeakMeter {
+	m := &truePeakMeter{history: make([][]float64, channels)}
+	for c := range m.history {
+		m.history[c] = make([]float64, truePeakTaps)
+	}
+
+	// history[i] is the sample i-center before the interpolated point
+	center := float64(truePeakTaps/2 - 1)
+	for p := 1; p < truePeakOversampling; p++ {
+		coefs := make([]float64, truePeakTaps)
+		for i := range coefs {
+			t := float64(p)/truePeakOversampling - (float64(i) - center)
+			coefs[i] = sinc(t) * 0.5 * (1 + math.Cos(math.Pi*t/(truePeakTaps/2)))
+		}
+		m.coefs = append(m.coefs, coefs)
+	}
+
+	return m
+}
+
+// push adds a sample of a channel and returns the largest value interpolated
+// since the previous one
+func (m *truePeakMeter) push(channel int, x float64) float64 {
+	h := m.history[channel]
+	copy(h, h[1:])
+	h[len(h)-1] = x
+
+	peak := 0.0
+	for _, coefs := range m.coefs {
+		y := 0.0
+		for i, c := range coefs {
+			y += h[i] * c
+		}
+		peak = math.Max(peak, math.Abs(y))
+	}
+	return peak
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
@@ -0,0 +1,164 @@
+package library_test
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/wav"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSine writes a stereo 48kHz wav of a 997Hz sine at a level in dBFS
+func writeSine(t *testing.T, path string, level float64, seconds int) library.Track {
+	format := beep.Format{SampleRate: 48000, NumChannels: 2, Precision: 2}
+	amplitude := math.Pow(10, level/20)
+
+	n := 0
+	sine := beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for i := range samples {
+			v := amplitude * math.Sin(2*math.Pi*997*float64(n)/float64(format.SampleRate))
+			samples[i] = [2]float64{v, v}
+			n++
+		}
+		return len(samples), true
+	})
+
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	s := beep.Take(int(format.SampleRate)*seconds, sine)
+	require.NoError(t, wav.Encode(f, s, format))
+
+	return library.Track{Path: path, FileType: "WAV"}
+}
+
+func TestMeasureLoudness(t *testing.T) {
+	tests := []struct {
+		name       string
+		level      float64
+		integrated float64
+		gain       float64
+	}{
+		{"reference", -23, -23, 5},
+		{"quiet", -40, -40, 22},
+		{"silence", math.Inf(-1), math.Inf(-1), 0},
+	}
+
+	for _, test := range tests {
+		track := writeSine(t, filepath.Join(t.TempDir(), "sine.wav"), test.level, 5)
+
+		l, err := library.MeasureLoudness(context.Background(), track)
+		require.NoError(t, err, test.name)
+
+		if math.IsInf(test.integrated, -1) {
+			assert.True(t, math.IsInf(l.Integrated, -1), test.name)
+			assert.Equal(t, 0.0, l.Peak, test.name)
+		} else {
+			assert.InDelta(t, test.integrated, l.Integrated, 0.1, test.name)
+			assert.InDelta(t, math.Pow(10, test.level/20), l.Peak, 0.001, test.name)
+		}
+		assert.InDelta(t, test.gain, l.Gain(), 0.1, test.name)
+	}
+}
+
+func TestScanLoudness(t *testing.T) {
+	dir := t.TempDir()
+	loud := writeSine(t, filepath.Join(dir, "01.wav"), -23, 3)
+	loud.Album = "Currents"
+	quiet := writeSine(t, filepath.Join(dir, "02.wav"), -33, 3)
+	quiet.Album = "currents"
+	single := writeSine(t, filepath.Join(dir, "03.wav"), -23, 3)
+	missing := library.Track{Path: filepath.Join(dir, "04.wav"), FileType: "WAV"}
+
+	failed := 0
+	scanned := library.ScanLoudness(context.Background(), []library.Track{single, quiet, missing, loud}, 2, func(track library.Track, err error) {
+		if err != nil {
+			failed++
+		}
+	})
+
+	assert.Equal(t, 1, failed)
+	require.Len(t, scanned, 3)
+	assert.Equal(t, []string{loud.Path, quiet.Path, single.Path}, []string{scanned[0].Path, scanned[1].Path, scanned[2].Path})
+
+	// the album is measured as a whole, between its loudest and quietest
+	// tracks, and both tracks share its gain
+	assert.InDelta(t, 5, scanned[0].ReplayGain.TrackGain, 0.1)
+	assert.InDelta(t, 15, scanned[1].ReplayGain.TrackGain, 0.1)
+	assert.Equal(t, scanned[0].ReplayGain.AlbumGain, scanned[1].ReplayGain.AlbumGain)
+	assert.Equal(t, scanned[0].ReplayGain.TrackPeak, scanned[1].ReplayGain.AlbumPeak)
+	assert.Greater(t, scanned[0].ReplayGain.AlbumGain, 5.0)
+	assert.Less(t, scanned[0].ReplayGain.AlbumGain, 15.0)
+
+	// tracks without an album have no album gain
+	assert.InDelta(t, 5, scanned[2].ReplayGain.TrackGain, 0.1)
+	assert.False(t, scanned[2].ReplayGain.HasAlbum())
+}
+
+func TestSaveLoudness(t *testing.T) {
+	ctx := context.Background()
+	comments := []string{"TITLE=Let It Happen", "TRACKNUMBER=3/12", "DATE=2015-07-17", "CUSTOM=keep me"}
+	path := writeFLAC(t, nil,
+		flacBlock(0, false, make([]byte, 34)),
+		flacBlock(4, true, vorbisComment(comments...)),
+	)
+
+	s, err := library.NewLocalAudioShelf(filepath.Dir(path))
+	require.NoError(t, err)
+	_, err = s.LoadTracks()
+	require.NoError(t, err)
+
+	// the gain is saved the way the loudness command does, measured from a
+	// stand in as there is no flac encoder
+	prev := s.Tracks()[0]
+	measured := writeSine(t, filepath.Join(t.TempDir(), "sine.wav"), -23, 3)
+	scanned := library.ScanLoudness(ctx, []library.Track{measured}, 1, nil)
+	require.Len(t, scanned, 1)
+
+	track := prev
+	track.ReplayGain = scanned[0].ReplayGain
+	_, err = s.SaveTrack(ctx, &prev, &track)
+	require.NoError(t, err)
+
+	loaded, err := s.LoadTrack(ctx, path)
+	require.NoError(t, err)
+	assert.Equal(t, track, *loaded)
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	for _, c := range comments {
+		assert.Contains(t, string(b), c)
+	}
+	assert.Contains(t, string(b), "REPLAYGAIN_TRACK_GAIN=")
+}
+
+func TestReplayGainScale(t *testing.T) {
+	rg := library.ReplayGain{TrackGain: 6, TrackPeak: 0.25, AlbumGain: -6, AlbumPeak: 0.5}
+	tests := []struct {
+		name   string
+		rg     library.ReplayGain
+		mode   library.ReplayGainMode
+		preamp float64
+		scale  float64
+	}{
+		{"off", rg, library.ReplayGainOff, 0, 1},
+		{"track", rg, library.ReplayGainTrack, 0, math.Pow(10, 6.0/20)},
+		{"album", rg, library.ReplayGainAlbum, 0, math.Pow(10, -6.0/20)},
+		{"preamp", rg, library.ReplayGainAlbum, 3, math.Pow(10, -3.0/20)},
+		{"clipping", rg, library.ReplayGainTrack, 9, 4},
+		{"album falls back to track", library.ReplayGain{TrackGain: -3, TrackPeak: 1}, library.ReplayGainAlbum, 0, math.Pow(10, -3.0/20)},
+		{"no gain", library.ReplayGain{}, library.ReplayGainTrack, 6, 1},
+	}
+
+	for _, test := range tests {
+		assert.InDelta(t, test.scale, test.rg.Scale(test.mode, test.preamp), 1e-9, test.name)
+	}
+}
@@ -23,14 +23,36 @@ func (l *MockAudioLibrary) LoadTracks() (uint64, error) {
 	return uint64(len(l.tracks)), nil
 }
 
+func (l *MockAudioLibrary) SetProgressFunc(f ProgressFunc) {}
+
 func (l *MockAudioLibrary) LoadTrack(ctx context.Context, location string) (*Track, error) {
 	return nil, nil
 }
 
 func (l *MockAudioLibrary) SaveTrack(ctx context.Context, prev, track *Track) (*Track, error) {
-	return nil, nil
+	return track, nil
 }
 
 func (l *MockAudioLibrary) DeleteTrack(ctx context.Context, track *Track) error {
 	return nil
 }
+
+func (l *MockAudioLibrary) RestoreTrack(ctx context.Context, entry TrashEntry) (*Track, error) {
+	return &Track{Path: entry.Path}, nil
+}
+
+func (l *MockAudioLibrary) CountPlay(ctx context.Context, track *Track) (*Track, error) {
+	counted := *track
+	counted.PlayCount++
+	return &counted, nil
+}
+
+func (l *MockAudioLibrary) Watch(ctx context.Context) (<-chan TrackEvent, error) {
+	events := make(chan TrackEvent)
+	go func() {
+		<-ctx.Done()
+		close(events)
+	}()
+
+	return events, nil
+}
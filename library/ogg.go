@@ -0,0 +1,298 @@
+package library
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// ogg page header flags
+	oggContinued = 0x01
+	oggFirst     = 0x02
+
+	// oggMaxSegments is the most lacing values a page can hold
+	oggMaxSegments = 255
+
+	// oggNoGranule marks a page on which no packet ends
+	oggNoGranule = ^uint64(0)
+)
+
+var (
+	vorbisCommentHeader = []byte("\x03vorbis")
+	vorbisSetupHeader   = []byte("\x05vorbis")
+)
+
+// oggPage is a single page of an ogg bitstream
+type oggPage struct {
+	flags    byte
+	granule  uint64
+	serial   uint32
+	sequence uint32
+	segments []byte
+	data     []byte
+}
+
+// readOggPage reads the next page of an ogg bitstream
+func readOggPage(r io.Reader) (*oggPage, error) {
+	header := make([]byte, 27)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(header[:4]) != "OggS" {
+		return nil, errors.New("missing ogg page marker")
+	}
+
+	p := &oggPage{
+		flags:    header[5],
+		granule:  binary.LittleEndian.Uint64(header[6:14]),
+		serial:   binary.LittleEndian.Uint32(header[14:18]),
+		sequence: binary.LittleEndian.Uint32(header[18:22]),
+		segments: make([]byte, header[26]),
+	}
+
+	_, err = io.ReadFull(r, p.segments)
+	if err != nil {
+		return nil, err
+	}
+
+	size := 0
+	for _, s := range p.segments {
+		size += int(s)
+	}
+
+	p.data = make([]byte, size)
+	_, err = io.ReadFull(r, p.data)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// encode serializes a page, computing its checksum
+func (p *oggPage) encode() []byte {
+	b := make([]byte, 27, 27+len(p.segments)+len(p.data))
+	copy(b, "OggS")
+	b[5] = p.flags
+	binary.LittleEndian.PutUint64(b[6:14], p.granule)
+	binary.LittleEndian.PutUint32(b[14:18], p.serial)
+	binary.LittleEndian.PutUint32(b[18:22], p.sequence)
+	b[26] = byte(len(p.segments))
+	b = append(b, p.segments...)
+	b = append(b, p.data...)
+
+	binary.LittleEndian.PutUint32(b[22:26], oggCRC(b))
+	return b
+}
+
+// packets splits page data into packets. The last packet is incomplete if
+// the page ends with a 255 lacing value.
+func (p *oggPage) packets() ([][]byte, bool) {
+	packets := [][]byte{}
+	start, end := 0, 0
+	complete := true
+	for _, s := range p.segments {
+		end += int(s)
+		complete = s < 255
+		if complete {
+			packets = append(packets, p.data[start:end])
+			start = end
+		}
+	}
+
+	if !complete {
+		packets = append(packets, p.data[start:end])
+	}
+
+	return packets, complete
+}
+
+// paginate lays packets out over as few pages as possible, starting with
+// sequence number seq
+func paginate(packets [][]byte, serial, seq uint32) []*oggPage {
+	pages := []*oggPage{}
+	p := &oggPage{serial: serial, sequence: seq, granule: oggNoGranule}
+
+	for _, packet := range packets {
+		rest := packet
+		for {
+			if len(p.segments) == oggMaxSegments {
+				pages = append(pages, p)
+				seq++
+				p = &oggPage{serial: serial, sequence: seq, granule: oggNoGranule}
+
+				// flag pages that start part way through a packet
+				if len(rest) < len(packet) {
+					p.flags = oggContinued
+				}
+			}
+
+			n := len(rest)
+			if n > 255 {
+				n = 255
+			}
+			p.segments = append(p.segments, byte(n))
+			p.data = append(p.data, rest[:n]...)
+			rest = rest[n:]
+
+			// a packet ends with a lacing value under 255, which may be 0
+			if n < 255 {
+				p.granule = 0
+				break
+			}
+		}
+	}
+
+	return append(pages, p)
+}
+
+// readOggHeaders reads the identification page of an Ogg Vorbis stream and
+// the comment and setup header packets that follow it. It returns the first
+// page, the two packets and how many pages they took up.
+func readOggHeaders(r io.Reader) (*oggPage, [][]byte, int, error) {
+	first, err := readOggPage(r)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("could not read ogg page: [%s]", err.Error())
+	}
+
+	ident, complete := first.packets()
+	if first.flags&oggFirst == 0 || len(ident) != 1 || !complete || !bytes.HasPrefix(ident[0], []byte("\x01vorbis")) {
+		return nil, nil, 0, errors.New("not a vorbis stream")
+	}
+
+	// collect the comment and setup headers, which may span several pages
+	headers := [][]byte{}
+	partial := []byte(nil)
+	headerPages := 0
+	for len(headers) < 2 {
+		p, err := readOggPage(r)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("could not read ogg header page: [%s]", err.Error())
+		}
+		headerPages++
+
+		if p.serial != first.serial {
+			return nil, nil, 0, errors.New("multiplexed streams are not supported")
+		}
+
+		packets, complete := p.packets()
+		for i, packet := range packets {
+			partial = append(partial, packet...)
+			if i == len(packets)-1 && !complete {
+				break
+			}
+			headers = append(headers, partial)
+			partial = nil
+		}
+
+		if len(headers) > 2 || (len(headers) == 2 && partial != nil) {
+			return nil, nil, 0, errors.New("audio shares a page with the headers")
+		}
+	}
+
+	if !bytes.HasPrefix(headers[0], vorbisCommentHeader) || !bytes.HasPrefix(headers[1], vorbisSetupHeader) {
+		return nil, nil, 0, errors.New("unexpected header packets")
+	}
+
+	return first, headers, headerPages, nil
+}
+
+// writeOggComments updates the comment header of an Ogg Vorbis file. The
+// header pages are rebuilt and the remaining pages renumbered to match.
+func writeOggComments(path string, update func(*vorbisComments)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open file [%s]: [%s]", path, err.Error())
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	first, headers, headerPages, err := readOggHeaders(r)
+	if err != nil {
+		return fmt.Errorf("could not read ogg vorbis header [%s]: [%s]", path, err.Error())
+	}
+
+	vc, err := decodeVorbisComments(headers[0][len(vorbisCommentHeader):])
+	if err != nil {
+		return fmt.Errorf("could not read vorbis comments [%s]: [%s]", path, err.Error())
+	}
+
+	update(vc)
+
+	// the comment header ends with a framing bit
+	comment := append(append([]byte{}, vorbisCommentHeader...), vc.encode()...)
+	comment = append(comment, 1)
+
+	pages := paginate([][]byte{comment, headers[1]}, first.serial, first.sequence+1)
+	shift := uint32(len(pages) - headerPages)
+
+	return rewriteFile(path, func(w io.Writer) error {
+		_, err := w.Write(first.encode())
+		if err != nil {
+			return err
+		}
+
+		for _, p := range pages {
+			_, err = w.Write(p.encode())
+			if err != nil {
+				return err
+			}
+		}
+
+		// renumber the rest of the stream. chained streams that follow have
+		// their own serial and numbering.
+		for {
+			p, err := readOggPage(r)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if p.serial == first.serial {
+				p.sequence += shift
+			}
+
+			_, err = w.Write(p.encode())
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// oggCRCTable is the lookup table for the ogg page checksum, a CRC-32 with
+// polynomial 0x04c11db7 that is not bit-reflected.
+var oggCRCTable = func() [256]uint32 {
+	var t [256]uint32
+	for i := range t {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return t
+}()
+
+// oggCRC computes the checksum of an encoded page whose checksum field is 0
+func oggCRC(b []byte) uint32 {
+	var crc uint32
+	for _, c := range b {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^c]
+	}
+	return crc
+}
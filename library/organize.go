@@ -0,0 +1,476 @@
+package library
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultPathTemplate is the layout used when none is configured
+const DefaultPathTemplate = "{albumartist|artist}/{year} - {album}/{disc}-{track:02} {title}.{ext}"
+
+// sidecarExts are files moved along with a track of the same name
+var sidecarExts = []string{".lrc", ".cue"}
+
+// PathTemplate builds a relative file path from track tags, eg:
+// "{albumartist}/{year} - {album}/{track:02} {title}.{ext}". A field can
+// give alternatives to use when it is empty (eg: "{albumartist|artist}") and
+// numbers can be zero padded (eg: "{track:02}"). "{ext}" is the file's
+// extension.
+type PathTemplate struct {
+	parts []templatePart
+}
+
+// templatePart is either literal text or a field
+type templatePart struct {
+	text   string
+	fields []Field
+	ext    bool
+	width  int
+}
+
+// ParsePathTemplate parses a path template
+func ParsePathTemplate(s string) (*PathTemplate, error) {
+	t := &PathTemplate{}
+	for s != "" {
+		open := strings.IndexByte(s, '{')
+		if open < 0 {
+			t.parts = append(t.parts, templatePart{text: s})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, templatePart{text: s[:open]})
+		}
+
+		end := strings.IndexByte(s[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("could not parse path template [%s]: [unclosed {]", s)
+		}
+
+		p, err := parseTemplateField(s[open+1 : open+end])
+		if err != nil {
+			return nil, fmt.Errorf("could not parse path template [%s]: [%s]", s, err.Error())
+		}
+		t.parts = append(t.parts, p)
+		s = s[open+end+1:]
+	}
+
+	if len(t.parts) == 0 {
+		return nil, fmt.Errorf("could not parse path template: [empty]")
+	}
+
+	return t, nil
+}
+
+// parseTemplateField parses the inside of a {field}
+func parseTemplateField(s string) (templatePart, error) {
+	p := templatePart{}
+	name, width, ok := strings.Cut(s, ":")
+	if ok {
+		w, err := strconv.Atoi(width)
+		if err != nil || w < 0 {
+			return p, fmt.Errorf("invalid width [%s]", width)
+		}
+		p.width = w
+	}
+
+	if strings.EqualFold(name, "ext") {
+		p.ext = true
+		return p, nil
+	}
+
+	for _, alt := range strings.Split(name, "|") {
+		f, err := ParseField(strings.TrimSpace(alt))
+		if err != nil {
+			return p, err
+		}
+		p.fields = append(p.fields, f)
+	}
+
+	return p, nil
+}
+
+// Path builds the relative path of a track
+func (t *PathTemplate) Path(track Track) string {
+	b := strings.Builder{}
+	for _, p := range t.parts {
+		switch {
+		case p.ext:
+			b.WriteString(strings.TrimPrefix(strings.ToLower(filepath.Ext(track.Path)), "."))
+		case len(p.fields) > 0:
+			b.WriteString(cleanPathValue(p.value(track)))
+		default:
+			b.WriteString(p.text)
+		}
+	}
+
+	// template text may use either separator, values never contain one
+	segments := strings.FieldsFunc(b.String(), func(r rune) bool { return r == '/' || r == '\\' })
+	for i, s := range segments {
+		segments[i] = cleanSegment(s)
+	}
+
+	return filepath.Join(segments...)
+}
+
+// value returns the first field with a value
+func (p templatePart) value(track Track) string {
+	for _, f := range p.fields {
+		if f.Numeric() {
+			n := f.Number(track)
+			if n == 0 {
+				continue
+			}
+			return fmt.Sprintf("%0*d", p.width, n)
+		}
+
+		if v := f.Text(track); v != "" {
+			return v
+		}
+	}
+
+	if p.fields[0].Numeric() {
+		return fmt.Sprintf("%0*d", p.width, 0)
+	}
+	name := string(p.fields[0])
+	return "Unknown " + strings.ToUpper(name[:1]) + name[1:]
+}
+
+// cleanPathValue strips characters that are illegal in file names on any
+// common filesystem, including separators so a value never adds a directory
+func cleanPathValue(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return -1
+		}
+		return r
+	}, s)
+
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// cleanSegment trims what Windows does not allow at the ends of a name
+func cleanSegment(s string) string {
+	s = strings.Trim(s, " .")
+	if s == "" {
+		return "_"
+	}
+	return s
+}
+
+// Move renames a track, and the files that belong with it, to a new path
+type Move struct {
+	Track Track
+	From  string
+	To    string
+
+	// Sidecars are lyrics, cue sheets and cover images moved along with the
+	// track
+	Sidecars []Sidecar
+}
+
+// Sidecar is a file moved along with a track
+type Sidecar struct {
+	From string
+	To   string
+}
+
+// PlanOrganize works out where each track on the shelf would move to under
+// template, without touching any files. Tracks already in place are left
+// out. Paths that would collide get a number, eg: "Title (2).mp3".
+func (l *LocalAudioShelf) PlanOrganize(template *PathTemplate) []Move {
+	tracks := l.Tracks()
+	sort.Slice(tracks, func(i, j int) bool { return tracks[i].Path < tracks[j].Path })
+
+	// tracks that stay put keep their paths
+	claimed := map[string]bool{}
+	targets := make([]string, len(tracks))
+	for i, track := range tracks {
+		targets[i] = filepath.Join(l.directory, template.Path(track))
+		if inPlace(track.Path, targets[i]) {
+			claimed[pathClaim(track.Path)] = true
+		}
+	}
+
+	moves := []Move{}
+	dirs := map[string]map[string]bool{}
+	for i, track := range tracks {
+		src := filepath.Dir(track.Path)
+		if dirs[src] == nil {
+			dirs[src] = map[string]bool{}
+		}
+
+		if inPlace(track.Path, targets[i]) {
+			dirs[src][src] = true
+			continue
+		}
+
+		to := freePath(targets[i], claimed)
+		claimed[pathClaim(to)] = true
+		dirs[src][filepath.Dir(to)] = true
+
+		move := Move{Track: track, From: track.Path, To: to}
+		for _, ext := range sidecarExts {
+			from := strings.TrimSuffix(track.Path, filepath.Ext(track.Path)) + ext
+			if _, err := os.Stat(from); err == nil {
+				move.Sidecars = append(move.Sidecars, Sidecar{
+					From: from,
+					To:   strings.TrimSuffix(to, filepath.Ext(to)) + ext,
+				})
+			}
+		}
+		moves = append(moves, move)
+	}
+
+	// cover images follow an album only if all of it moves to one place
+	for i, move := range moves {
+		src := filepath.Dir(move.From)
+		if len(dirs[src]) != 1 || dirs[src][src] {
+			continue
+		}
+		delete(dirs, src)
+
+		for _, cover := range folderArtworkFiles(src) {
+			to := filepath.Join(filepath.Dir(move.To), filepath.Base(cover))
+			if _, err := os.Stat(to); err == nil {
+				continue
+			}
+			moves[i].Sidecars = append(moves[i].Sidecars, Sidecar{From: cover, To: to})
+		}
+	}
+
+	return moves
+}
+
+// inPlace checks if path is target, or a numbered copy of it from an earlier
+// collision
+func inPlace(path, target string) bool {
+	if path == target {
+		return true
+	}
+
+	ext := filepath.Ext(target)
+	prefix := strings.TrimSuffix(target, ext) + " ("
+	suffix := ")" + ext
+	if !strings.HasPrefix(path, prefix) || !strings.HasSuffix(path, suffix) || len(path) <= len(prefix)+len(suffix) {
+		return false
+	}
+
+	_, err := strconv.Atoi(path[len(prefix) : len(path)-len(suffix)])
+	return err == nil
+}
+
+// pathClaim is the key a path is reserved under. Case is ignored, as some
+// filesystems do.
+func pathClaim(path string) string {
+	return strings.ToLower(path)
+}
+
+// freePath returns path, or path with a number added if it already exists or
+// has been claimed
+func freePath(path string, claimed map[string]bool) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	p := path
+	for n := 2; ; n++ {
+		_, err := os.Stat(p)
+		if !claimed[pathClaim(p)] && os.IsNotExist(err) {
+			return p
+		}
+		p = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+}
+
+// folderArtworkFiles lists the cover images in dir
+func folderArtworkFiles(dir string) []string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	covers := []string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		name := strings.ToLower(strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())))
+		if containsString(folderArtworkExts, ext) && containsString(folderArtworkNames, name) {
+			covers = append(covers, filepath.Join(dir, e.Name()))
+		}
+	}
+	return covers
+}
+
+func containsString(s []string, x string) bool {
+	for _, y := range s {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
+
+// Organize applies moves from PlanOrganize. Existing files are never
+// overwritten. The shelf, its index and store follow each track to its new
+// path, and directories left empty are removed. It returns the number of
+// tracks moved, and an error describing any that could not be.
+func (l *LocalAudioShelf) Organize(moves []Move) (int, error) {
+	if l.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	moved := 0
+	failed := []string{}
+	dirs := map[string]bool{}
+	for _, move := range moves {
+		err := moveFile(move.From, move.To)
+		if err != nil {
+			log.WithError(err).WithField("path", move.From).Error("could not move track")
+			failed = append(failed, err.Error())
+			continue
+		}
+
+		moved++
+		dirs[filepath.Dir(move.From)] = true
+		l.moveTrack(move.Track, move.To)
+
+		for _, s := range move.Sidecars {
+			err := moveFile(s.From, s.To)
+			if err != nil {
+				log.WithError(err).WithField("path", s.From).Warn("could not move sidecar file")
+				continue
+			}
+			dirs[filepath.Dir(s.From)] = true
+		}
+	}
+
+	if l.store != nil {
+		l.saveStore()
+	}
+
+	for dir := range dirs {
+		l.removeEmptyDirs(dir)
+	}
+
+	if len(failed) > 0 {
+		return moved, fmt.Errorf("could not move %d of %d tracks: [%s]", len(failed), len(moves), strings.Join(failed, "; "))
+	}
+	return moved, nil
+}
+
+// moveFile renames from to to, creating directories as needed
+func moveFile(from, to string) error {
+	if _, err := os.Stat(to); err == nil {
+		return fmt.Errorf("could not move [%s]: [%s already exists]", from, to)
+	}
+
+	err := os.MkdirAll(filepath.Dir(to), 0755)
+	if err != nil {
+		return fmt.Errorf("could not create directory [%s]: [%s]", filepath.Dir(to), err.Error())
+	}
+
+	err = os.Rename(from, to)
+	if err != nil {
+		return fmt.Errorf("could not move [%s]: [%s]", from, err.Error())
+	}
+	return nil
+}
+
+// moveTrack points a moved track at its new path
+func (l *LocalAudioShelf) moveTrack(track Track, to string) {
+	moved := track
+	moved.Path = to
+
+	info, err := os.Stat(to)
+	if err != nil {
+		log.WithError(err).WithField("path", to).Warn("could not stat moved track")
+	}
+
+	l.mu.Lock()
+	for i := range l.tracks {
+		if l.tracks[i].Path == track.Path {
+			l.tracks[i] = moved
+		}
+	}
+	delete(l.stats, track.Path)
+	if info != nil {
+		l.stats[to] = info
+	}
+	l.mu.Unlock()
+
+	// renaming keeps the size and modification time, so the cached entry
+	// is still good
+	if l.index != nil {
+		if cached, ok := l.index.Lookup(track.Path, info); info != nil && ok {
+			l.index.Put(to, info, *cached)
+		}
+		l.index.Remove(track.Path)
+	}
+
+	// tracks without tags are stored by path
+	if l.store != nil {
+		l.store.Rekey(track, moved)
+	}
+}
+
+// removeEmptyDirs removes dir and its parents while they are empty, stopping
+// at the shelf directory
+func (l *LocalAudioShelf) removeEmptyDirs(dir string) {
+	root := filepath.Clean(l.directory)
+	for dir = filepath.Clean(dir); dir != root && withinDir(root, dir); dir = filepath.Dir(dir) {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			return
+		}
+
+		err = os.Remove(dir)
+		if err != nil {
+			log.WithError(err).WithField("path", dir).Warn("could not remove empty directory")
+			return
+		}
+		log.WithField("path", dir).Debug("removed empty directory")
+	}
+}
+
+// WriteMoves describes moves as a diff of paths relative to dir
+func WriteMoves(w io.Writer, dir string, moves []Move) error {
+	rel := func(p string) string {
+		r, err := filepath.Rel(dir, p)
+		if err != nil {
+			return p
+		}
+		return r
+	}
+
+	for _, m := range moves {
+		_, err := fmt.Fprintf(w, "- %s\n+ %s\n", rel(m.From), rel(m.To))
+		if err != nil {
+			return err
+		}
+
+		for _, s := range m.Sidecars {
+			_, err := fmt.Fprintf(w, "  - %s\n  + %s\n", rel(s.From), rel(s.To))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Directory returns the directory the shelf was created for
+func (l *LocalAudioShelf) Directory() string {
+	return l.directory
+}
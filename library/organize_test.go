@@ -0,0 +1,129 @@
+package library_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathTemplate(t *testing.T) {
+	track := library.Track{
+		Path:        "/music/x.FLAC",
+		Artist:      "Tame Impala",
+		Album:       "Currents",
+		Title:       "What/Is: This?",
+		Year:        2015,
+		DiscNumber:  1,
+		TrackNumber: 3,
+	}
+
+	var tests = []struct {
+		template string
+		want     string
+	}{
+		{library.DefaultPathTemplate, "Tame Impala/2015 - Currents/1-03 WhatIs This.flac"},
+		{"{albumartist}/{album}.{ext}", "Unknown Albumartist/Currents.flac"},
+		{"{genre|artist}/...{title} .{ext}", "Tame Impala/WhatIs This .flac"},
+	}
+
+	for _, test := range tests {
+		tmpl, err := library.ParsePathTemplate(test.template)
+		require.NoError(t, err, test.template)
+		assert.Equal(t, filepath.FromSlash(test.want), tmpl.Path(track), test.template)
+	}
+
+	for _, bad := range []string{"", "{artist", "{bogus}", "{track:x}"} {
+		_, err := library.ParsePathTemplate(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestOrganize(t *testing.T) {
+	dir := t.TempDir()
+	incoming := filepath.Join(dir, "incoming")
+	require.NoError(t, os.Mkdir(incoming, 0755))
+
+	flac := func(name string, comments ...string) {
+		b, err := ioutil.ReadFile(writeFLAC(t, nil,
+			flacBlock(0, false, make([]byte, 34)),
+			flacBlock(4, true, vorbisComment(comments...)),
+		))
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(incoming, name), b, 0644))
+	}
+	flac("a.flac", "ARTIST=Tame Impala", "ALBUM=Currents", "DATE=2015", "TRACKNUMBER=1", "TITLE=Let It Happen")
+	flac("b.flac", "ARTIST=Tame Impala", "ALBUM=Currents", "DATE=2015", "TRACKNUMBER=1", "TITLE=Let It Happen")
+	flac("c.flac", "ARTIST=Tame Impala", "ALBUM=Currents", "DATE=2015", "TRACKNUMBER=2", "TITLE=Nangs")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(incoming, "a.lrc"), []byte("[00:00]"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(incoming, "Cover.jpg"), []byte("jpg"), 0644))
+
+	index := library.NewIndex(filepath.Join(t.TempDir(), "index.json"))
+	s, err := library.NewLocalAudioShelf(dir)
+	require.NoError(t, err)
+	s.SetIndex(index)
+	_, err = s.LoadTracks()
+	require.NoError(t, err)
+
+	tmpl, err := library.ParsePathTemplate("{artist}/{year} - {album}/{track:02} {title}.{ext}")
+	require.NoError(t, err)
+
+	album := filepath.Join(dir, "Tame Impala", "2015 - Currents")
+	moves := s.PlanOrganize(tmpl)
+	require.Len(t, moves, 3)
+
+	// planning does not touch any files
+	_, err = os.Stat(album)
+	assert.True(t, os.IsNotExist(err))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, library.WriteMoves(buf, dir, moves))
+	assert.Contains(t, buf.String(), filepath.FromSlash("- incoming/b.flac\n+ Tame Impala/2015 - Currents/01 Let It Happen (2).flac\n"))
+
+	moved, err := s.Organize(moves)
+	require.NoError(t, err)
+	assert.Equal(t, 3, moved)
+
+	want := []string{"01 Let It Happen (2).flac", "01 Let It Happen.flac", "01 Let It Happen.lrc", "02 Nangs.flac", "Cover.jpg"}
+	entries, err := ioutil.ReadDir(album)
+	require.NoError(t, err)
+	got := []string{}
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	assert.Equal(t, want, got)
+
+	// the emptied directory is removed, the shelf directory is not
+	_, err = os.Stat(incoming)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(dir)
+	assert.NoError(t, err)
+
+	// the shelf and its index follow the files
+	paths := []string{}
+	for _, track := range s.Tracks() {
+		paths = append(paths, track.Path)
+
+		info, err := os.Stat(track.Path)
+		require.NoError(t, err)
+		cached, ok := index.Lookup(track.Path, info)
+		assert.True(t, ok, track.Path)
+		assert.Equal(t, track.Title, cached.Title)
+	}
+	sort.Strings(paths)
+	assert.Equal(t, []string{
+		filepath.Join(album, "01 Let It Happen (2).flac"),
+		filepath.Join(album, "01 Let It Happen.flac"),
+		filepath.Join(album, "02 Nangs.flac"),
+	}, paths)
+	assert.Equal(t, 3, index.Len())
+
+	// organizing again has nothing to do
+	assert.Empty(t, s.PlanOrganize(tmpl))
+}
@@ -0,0 +1,135 @@
+package library
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultPathPattern is used to read tags from paths when none is configured
+const DefaultPathPattern = "{artist}/{album}/{track} - {title}"
+
+// PathPattern reads tags from a file path, the reverse of a PathTemplate, eg:
+// "{artist}/{album}/{track} - {title}". It is matched against the end of the
+// path without the extension, so it only needs to cover the directories that
+// hold tags. "{_}" matches text that is ignored.
+type PathPattern struct {
+	re     *regexp.Regexp
+	fields []Field
+}
+
+// ParsePathPattern parses a path pattern
+func ParsePathPattern(s string) (*PathPattern, error) {
+	p := &PathPattern{}
+	expr := strings.Builder{}
+	expr.WriteString(`(?:^|/)`)
+
+	rest := s
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			expr.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		expr.WriteString(regexp.QuoteMeta(rest[:open]))
+
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("could not parse path pattern [%s]: [unclosed {]", s)
+		}
+
+		name := strings.TrimSpace(rest[open+1 : open+end])
+		rest = rest[open+end+1:]
+
+		if name == "_" {
+			expr.WriteString(`[^/]*?`)
+			continue
+		}
+
+		f, err := ParseField(name)
+		if err != nil || !f.Settable() {
+			return nil, fmt.Errorf("could not parse path pattern [%s]: [%s is not a tag]", s, name)
+		}
+
+		p.fields = append(p.fields, f)
+		if f.Numeric() {
+			expr.WriteString(`0*(\d+)`)
+		} else {
+			expr.WriteString(`([^/]+?)`)
+		}
+	}
+
+	if len(p.fields) == 0 {
+		return nil, fmt.Errorf("could not parse path pattern [%s]: [no fields]", s)
+	}
+
+	expr.WriteString(`$`)
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("could not parse path pattern [%s]: [%s]", s, err.Error())
+	}
+	p.re = re
+
+	return p, nil
+}
+
+// Fields returns the fields the pattern reads, in order
+func (p *PathPattern) Fields() []Field {
+	return p.fields
+}
+
+// Match reads tag values from path. Values are trimmed and underscores read
+// as spaces, eg: "01_-_let_it_happen".
+func (p *PathPattern) Match(path string) (map[Field]string, bool) {
+	path = filepath.ToSlash(strings.TrimSuffix(path, filepath.Ext(path)))
+
+	m := p.re.FindStringSubmatch(path)
+	if m == nil {
+		return nil, false
+	}
+
+	values := map[Field]string{}
+	for i, f := range p.fields {
+		v := strings.TrimSpace(strings.ReplaceAll(m[i+1], "_", " "))
+		if v != "" {
+			values[f] = v
+		}
+	}
+
+	return values, true
+}
+
+// Propose fills in the tags of track that are empty from its path. It returns
+// the updated track and the fields that changed, if any. Existing tags are
+// never replaced.
+func (p *PathPattern) Propose(track Track) (Track, []Field) {
+	values, ok := p.Match(track.Path)
+	if !ok {
+		return track, nil
+	}
+
+	changed := []Field{}
+	for _, f := range p.fields {
+		v, ok := values[f]
+		if !ok || hasValue(f, track) {
+			continue
+		}
+
+		err := f.Set(&track, v)
+		if err != nil {
+			continue
+		}
+		changed = append(changed, f)
+	}
+
+	return track, changed
+}
+
+// hasValue checks if a field of track is set
+func hasValue(f Field, track Track) bool {
+	if f.Numeric() {
+		return f.Number(track) != 0
+	}
+	return f.Text(track) != ""
+}
@@ -0,0 +1,52 @@
+package library_test
+
+import (
+	"testing"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathPattern(t *testing.T) {
+	var tests = []struct {
+		pattern string
+		track   library.Track
+		want    library.Track
+		changed []library.Field
+	}{
+		{
+			library.DefaultPathPattern,
+			library.Track{Path: "/music/Tame Impala/Currents/01 - Let It Happen.flac"},
+			library.Track{Path: "/music/Tame Impala/Currents/01 - Let It Happen.flac", Artist: "Tame Impala", Album: "Currents", TrackNumber: 1, Title: "Let It Happen"},
+			[]library.Field{library.FieldArtist, library.FieldAlbum, library.FieldTrackNumber, library.FieldTitle},
+		},
+		{
+			// existing tags are kept
+			"{artist}/{year} - {album}/{_}_{title}",
+			library.Track{Path: "/music/tame_impala/2015 - Currents/a1_let_it_happen.mp3", Artist: "Tame Impala"},
+			library.Track{Path: "/music/tame_impala/2015 - Currents/a1_let_it_happen.mp3", Artist: "Tame Impala", Year: 2015, Album: "Currents", Title: "let it happen"},
+			[]library.Field{library.FieldYear, library.FieldAlbum, library.FieldTitle},
+		},
+		{
+			library.DefaultPathPattern,
+			library.Track{Path: "/music/loose.mp3"},
+			library.Track{Path: "/music/loose.mp3"},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		p, err := library.ParsePathPattern(test.pattern)
+		require.NoError(t, err, test.pattern)
+
+		got, changed := p.Propose(test.track)
+		assert.Equal(t, test.want, got, test.pattern)
+		assert.Equal(t, test.changed, changed, test.pattern)
+	}
+
+	for _, bad := range []string{"", "{artist", "{length}/{title}", "just text"} {
+		_, err := library.ParsePathPattern(bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,406 @@
+package library
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// mp3ScanSize is how far past the id3 tag to look for the first frame
+	mp3ScanSize = 64 * 1024
+
+	// oggScanSize is how far from the end of the file to look for the last
+	// page, which holds the total sample count. Pages are at most 64KB.
+	oggScanSize = 64 * 1024
+)
+
+// readProperties fills in the length and technical properties of a track
+// from its stream headers, without decoding any audio.
+func readProperties(path string, track *Track) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open file [%s]: [%s]", path, err.Error())
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat file [%s]: [%s]", path, err.Error())
+	}
+
+	p := Track{}
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".mp3":
+		err = mp3Properties(f, info.Size(), &p)
+	case ".flac":
+		err = flacProperties(f, info.Size(), &p)
+	case ".ogg":
+		err = oggProperties(f, info.Size(), &p)
+	case ".wav":
+		err = wavProperties(f, &p)
+	default:
+		err = fmt.Errorf("unsupported file extension: [%s]", ext)
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not read audio properties [%s]: [%s]", path, err.Error())
+	}
+
+	track.Length = p.Length
+	track.MimeType = p.MimeType
+	track.BitDepth = p.BitDepth
+	track.Bitrate = p.Bitrate
+	track.Channels = p.Channels
+	track.SampleRate = p.SampleRate
+	return nil
+}
+
+// averageBitrate returns the bitrate in kbps of size bytes played over millis
+func averageBitrate(size int64, millis int) int {
+	if millis <= 0 {
+		return 0
+	}
+
+	// bits per milli is kbps
+	return int(size * 8 / int64(millis))
+}
+
+// flacProperties reads STREAMINFO
+func flacProperties(f *os.File, size int64, p *Track) error {
+	blocks, audioOffset, err := readFLACBlocks(bufio.NewReader(f))
+	if err != nil {
+		return err
+	}
+
+	if len(blocks) == 0 || blocks[0].kind != flacStreamInfo || len(blocks[0].data) < 18 {
+		return errors.New("missing STREAMINFO")
+	}
+
+	// 20 bits sample rate, 3 bits channels - 1, 5 bits bits per sample - 1
+	// and 36 bits total samples
+	v := binary.BigEndian.Uint64(blocks[0].data[10:18])
+	p.SampleRate = int(v >> 44)
+	p.Channels = int(v>>41&0x7) + 1
+	p.BitDepth = int(v>>36&0x1f) + 1
+	samples := v & (1<<36 - 1)
+
+	if p.SampleRate == 0 {
+		return errors.New("invalid sample rate")
+	}
+
+	p.MimeType = "audio/flac"
+	p.Length = int(samples * 1000 / uint64(p.SampleRate))
+	p.Bitrate = averageBitrate(size-audioOffset, p.Length)
+	return nil
+}
+
+// oggProperties reads the vorbis identification header, and the granule
+// position of the last page for the length
+func oggProperties(f *os.File, size int64, p *Track) error {
+	first, err := readOggPage(bufio.NewReader(f))
+	if err != nil {
+		return err
+	}
+
+	ident := first.data
+	if len(ident) < 30 || !bytes.HasPrefix(ident, []byte("\x01vorbis")) {
+		return errors.New("not a vorbis stream")
+	}
+
+	p.Channels = int(ident[11])
+	p.SampleRate = int(binary.LittleEndian.Uint32(ident[12:16]))
+	if p.SampleRate == 0 {
+		return errors.New("invalid sample rate")
+	}
+
+	start := size - oggScanSize
+	if start < 0 {
+		start = 0
+	}
+
+	tail := make([]byte, size-start)
+	_, err = f.ReadAt(tail, start)
+	if err != nil {
+		return err
+	}
+
+	// the last page of the stream that finishes a packet
+	granule := uint64(0)
+	for i := bytes.LastIndex(tail, []byte("OggS")); i >= 0; i = bytes.LastIndex(tail[:i], []byte("OggS")) {
+		if len(tail)-i < 27 {
+			continue
+		}
+
+		g := binary.LittleEndian.Uint64(tail[i+6 : i+14])
+		serial := binary.LittleEndian.Uint32(tail[i+14 : i+18])
+		if serial == first.serial && g != oggNoGranule {
+			granule = g
+			break
+		}
+	}
+
+	p.MimeType = "audio/ogg"
+	p.Length = int(granule * 1000 / uint64(p.SampleRate))
+	p.Bitrate = averageBitrate(size, p.Length)
+	return nil
+}
+
+// wavProperties reads the fmt chunk and the size of the data chunk
+func wavProperties(f *os.File, p *Track) error {
+	chunks, err := readRIFFChunks(f)
+	if err != nil {
+		return err
+	}
+
+	var format []byte
+	var dataSize int64 = -1
+	for _, c := range chunks {
+		switch c.id {
+		case riffFormat:
+			format = c.data
+		case "data":
+			dataSize = c.size
+		}
+	}
+
+	if len(format) < 16 || dataSize < 0 {
+		return errors.New("missing fmt or data chunk")
+	}
+
+	p.Channels = int(binary.LittleEndian.Uint16(format[2:4]))
+	p.SampleRate = int(binary.LittleEndian.Uint32(format[4:8]))
+	byteRate := int64(binary.LittleEndian.Uint32(format[8:12]))
+	p.BitDepth = int(binary.LittleEndian.Uint16(format[14:16]))
+
+	if p.SampleRate == 0 || byteRate == 0 {
+		return errors.New("invalid sample rate")
+	}
+
+	p.MimeType = "audio/wav"
+	p.Length = int(dataSize * 1000 / byteRate)
+	p.Bitrate = int(byteRate * 8 / 1000)
+	return nil
+}
+
+// mp3 frame header tables
+var (
+	// mp3Bitrates in kbps, indexed by MPEG 1 or MPEG 2/2.5, layer and
+	// bitrate index
+	mp3Bitrates = [2][3][15]int{
+		{
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+		{
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+	}
+
+	// mp3SampleRates is indexed by the version bits of the header
+	mp3SampleRates = [4][3]int{
+		{11025, 12000, 8000},  // MPEG 2.5
+		{},                    // reserved
+		{22050, 24000, 16000}, // MPEG 2
+		{44100, 48000, 32000}, // MPEG 1
+	}
+)
+
+// mp3Frame is a parsed MPEG audio frame header
+type mp3Frame struct {
+	mpeg1      bool
+	layer      int
+	bitrate    int
+	sampleRate int
+	channels   int
+	samples    int
+	size       int
+}
+
+// parseMP3Frame parses a 4 byte frame header
+func parseMP3Frame(b []byte) (mp3Frame, bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return mp3Frame{}, false
+	}
+
+	version := int(b[1] >> 3 & 0x3)
+	layerBits := int(b[1] >> 1 & 0x3)
+	bitrateIndex := int(b[2] >> 4)
+	rateIndex := int(b[2] >> 2 & 0x3)
+	padding := int(b[2] >> 1 & 0x1)
+
+	// reserved or free format values
+	if version == 1 || layerBits == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return mp3Frame{}, false
+	}
+
+	fr := mp3Frame{
+		mpeg1:      version == 3,
+		layer:      4 - layerBits,
+		sampleRate: mp3SampleRates[version][rateIndex],
+		channels:   2,
+	}
+
+	class := 1
+	if fr.mpeg1 {
+		class = 0
+	}
+	fr.bitrate = mp3Bitrates[class][fr.layer-1][bitrateIndex]
+
+	if b[3]>>6 == 3 {
+		fr.channels = 1
+	}
+
+	switch {
+	case fr.layer == 1:
+		fr.samples = 384
+		fr.size = (12*fr.bitrate*1000/fr.sampleRate + padding) * 4
+	case fr.layer == 3 && !fr.mpeg1:
+		fr.samples = 576
+		fr.size = 72*fr.bitrate*1000/fr.sampleRate + padding
+	default:
+		fr.samples = 1152
+		fr.size = 144*fr.bitrate*1000/fr.sampleRate + padding
+	}
+
+	return fr, true
+}
+
+// sideInfoSize is the size of the layer III side information that follows
+// the header, which is where a Xing header would be
+func (fr mp3Frame) sideInfoSize() int {
+	switch {
+	case fr.mpeg1 && fr.channels == 1:
+		return 17
+	case fr.mpeg1:
+		return 32
+	case fr.channels == 1:
+		return 9
+	default:
+		return 17
+	}
+}
+
+// mp3Properties finds the first frame after the id3 tag. The length comes
+// from a Xing/Info or VBRI header if the file has one, otherwise the file is
+// assumed to be constant bitrate.
+func mp3Properties(f *os.File, size int64, p *Track) error {
+	start := int64(0)
+	header := make([]byte, 10)
+	_, err := f.ReadAt(header, 0)
+	if err == nil && string(header[:3]) == "ID3" {
+		// synchsafe size, plus an optional footer
+		start = 10 + (int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9]))
+		if header[5]&0x10 != 0 {
+			start += 10
+		}
+	}
+
+	// an id3v1 tag sits at the very end
+	end := size
+	tag := make([]byte, 3)
+	_, err = f.ReadAt(tag, size-128)
+	if err == nil && string(tag) == "TAG" {
+		end -= 128
+	}
+
+	if start >= end {
+		return errors.New("no audio frames")
+	}
+
+	n := end - start
+	if n > mp3ScanSize {
+		n = mp3ScanSize
+	}
+
+	buf := make([]byte, n)
+	_, err = f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	for i := 0; i+4 <= len(buf); i++ {
+		fr, ok := parseMP3Frame(buf[i:])
+		if !ok {
+			continue
+		}
+
+		// make sure this is not a stray sync word by checking the next frame
+		// follows on, or that this frame ends the audio
+		next := i + fr.size
+		if next+4 <= len(buf) {
+			if _, ok := parseMP3Frame(buf[next:]); !ok {
+				continue
+			}
+		} else if start+int64(next) != end && int64(len(buf)) == end-start {
+			continue
+		}
+
+		frameStart := start + int64(i)
+		p.MimeType = "audio/mpeg"
+		p.SampleRate = fr.sampleRate
+		p.Channels = fr.channels
+
+		frames, vbrSize := mp3VBRHeader(buf[i:], fr)
+		audioSize := end - frameStart
+		if vbrSize > 0 {
+			audioSize = vbrSize
+		}
+
+		if frames > 0 {
+			p.Length = int(frames * int64(fr.samples) * 1000 / int64(fr.sampleRate))
+			p.Bitrate = averageBitrate(audioSize, p.Length)
+			return nil
+		}
+
+		p.Bitrate = fr.bitrate
+		p.Length = int(audioSize * 8 / int64(fr.bitrate))
+		return nil
+	}
+
+	return errors.New("no audio frames")
+}
+
+// mp3VBRHeader returns the frame and byte counts of a Xing/Info or VBRI
+// header in the first frame, if there is one
+func mp3VBRHeader(b []byte, fr mp3Frame) (int64, int64) {
+	if len(b) > fr.size {
+		b = b[:fr.size]
+	}
+
+	// Xing (vbr) or Info (cbr) follows the side information
+	x := 4 + fr.sideInfoSize()
+	if len(b) >= x+8 && (string(b[x:x+4]) == "Xing" || string(b[x:x+4]) == "Info") {
+		flags := binary.BigEndian.Uint32(b[x+4 : x+8])
+		x += 8
+
+		var frames, size int64
+		if flags&0x1 != 0 && len(b) >= x+4 {
+			frames = int64(binary.BigEndian.Uint32(b[x : x+4]))
+			x += 4
+		}
+		if flags&0x2 != 0 && len(b) >= x+4 {
+			size = int64(binary.BigEndian.Uint32(b[x : x+4]))
+		}
+		return frames, size
+	}
+
+	// VBRI is always 32 bytes after the header
+	if len(b) >= 36+18 && string(b[36:40]) == "VBRI" {
+		size := int64(binary.BigEndian.Uint32(b[46:50]))
+		frames := int64(binary.BigEndian.Uint32(b[50:54]))
+		return frames, size
+	}
+
+	return 0, 0
+}
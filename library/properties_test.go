@@ -0,0 +1,135 @@
+package library_test
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mp3Frames builds count frames of size bytes, the first holding extra data
+// after the header (eg: a Xing header)
+func mp3Frames(header []byte, size, count int, first []byte) []byte {
+	b := []byte{}
+	for i := 0; i < count; i++ {
+		frame := make([]byte, size)
+		copy(frame, header)
+		if i == 0 {
+			copy(frame[4:], first)
+		}
+		b = append(b, frame...)
+	}
+	return b
+}
+
+func xingHeader(offset int, frames, size uint32) []byte {
+	b := make([]byte, offset)
+	b = append(b, "Xing\x00\x00\x00\x03"...)
+	b = binary.BigEndian.AppendUint32(b, frames)
+	return binary.BigEndian.AppendUint32(b, size)
+}
+
+func writeFile(t *testing.T, name string, b []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, ioutil.WriteFile(path, b, 0644))
+	return path
+}
+
+func TestLoadProperties(t *testing.T) {
+	// MPEG 1 layer III, 128kbps, 44.1kHz, joint stereo
+	cbr := []byte{0xff, 0xfb, 0x90, 0x64}
+	// MPEG 2 layer III, 64kbps, 22.05kHz, mono
+	mono := []byte{0xff, 0xf3, 0x80, 0xc0}
+
+	emptyID3 := []byte("ID3\x04\x00\x00\x00\x00\x00\x0a")
+	emptyID3 = append(emptyID3, make([]byte, 10)...)
+
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint64(streamInfo[10:18], 44100<<44|1<<41|15<<36|441000)
+
+	ident := []byte("\x01vorbis\x00\x00\x00\x00\x02")
+	ident = binary.LittleEndian.AppendUint32(ident, 44100)
+	ident = append(ident, make([]byte, 14)...)
+	comment := append(append([]byte("\x03vorbis"), vorbisComment()...), 1)
+	setup := []byte("\x05vorbis")
+
+	ogg := oggPage{flags: 0x02, segments: lacing(len(ident)), data: ident}.encode()
+	ogg = append(ogg, oggPage{sequence: 1, segments: append(lacing(len(comment)), lacing(len(setup))...), data: append(comment, setup...)}.encode()...)
+	ogg = append(ogg, oggPage{flags: 0x04, granule: 88200, sequence: 2, segments: lacing(100), data: make([]byte, 100)}.encode()...)
+
+	format := []byte{1, 0, 2, 0}
+	format = binary.LittleEndian.AppendUint32(format, 44100)
+	format = binary.LittleEndian.AppendUint32(format, 176400)
+	format = append(format, 4, 0, 16, 0)
+
+	var tests = []struct {
+		name     string
+		path     string
+		expected library.Track
+	}{
+		{
+			"mp3 cbr",
+			writeFile(t, "cbr.mp3", append(emptyID3, mp3Frames(cbr, 417, 100, nil)...)),
+			library.Track{Length: 2606, MimeType: "audio/mpeg", Bitrate: 128, Channels: 2, SampleRate: 44100},
+		},
+		{
+			"mp3 xing",
+			writeFile(t, "xing.mp3", mp3Frames(cbr, 417, 2, xingHeader(32, 1000, 500000))),
+			library.Track{Length: 26122, MimeType: "audio/mpeg", Bitrate: 153, Channels: 2, SampleRate: 44100},
+		},
+		{
+			"mp3 mono mpeg 2",
+			writeFile(t, "mono.mp3", mp3Frames(mono, 208, 2, xingHeader(9, 100, 20800))),
+			library.Track{Length: 2612, MimeType: "audio/mpeg", Bitrate: 63, Channels: 1, SampleRate: 22050},
+		},
+		{
+			"flac",
+			writeFLAC(t, make([]byte, 10000), flacBlock(0, true, streamInfo)),
+			library.Track{Length: 10000, MimeType: "audio/flac", Bitrate: 8, BitDepth: 16, Channels: 2, SampleRate: 44100},
+		},
+		{
+			"ogg",
+			writeFile(t, "track.ogg", ogg),
+			library.Track{Length: 2000, MimeType: "audio/ogg", Bitrate: len(ogg) * 8 / 2000, Channels: 2, SampleRate: 44100},
+		},
+		{
+			"wav",
+			writeWAV(t, riffChunk("fmt ", format), riffChunk("data", make([]byte, 17640))),
+			library.Track{Length: 100, MimeType: "audio/wav", Bitrate: 1411, BitDepth: 16, Channels: 2, SampleRate: 44100},
+		},
+	}
+
+	s, err := library.NewLocalAudioShelf(t.TempDir())
+	require.NoError(t, err)
+
+	for _, test := range tests {
+		track, err := s.LoadTrack(context.Background(), test.path)
+		require.NoError(t, err, test.name)
+
+		actual := library.Track{
+			Length:     track.Length,
+			MimeType:   track.MimeType,
+			Bitrate:    track.Bitrate,
+			BitDepth:   track.BitDepth,
+			Channels:   track.Channels,
+			SampleRate: track.SampleRate,
+		}
+		assert.Equal(t, test.expected, actual, test.name)
+	}
+}
+
+func TestLoadPropertiesStraySync(t *testing.T) {
+	// a sync word in the junk after the tag is not mistaken for audio
+	b := []byte("ID3\x04\x00\x00\x00\x00\x00\x00\xff\xfb\x90\x64\x00\x00")
+	b = append(b, mp3Frames([]byte{0xff, 0xfb, 0x90, 0x64}, 417, 10, nil)...)
+
+	track, err := (&library.ID3v2Handler{}).Load(context.Background(), writeFile(t, "stray.mp3", b))
+	require.NoError(t, err)
+	assert.Equal(t, 44100, track.SampleRate)
+	assert.Equal(t, 4170*8/128, track.Length)
+}
@@ -0,0 +1,267 @@
+package library
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Predicate reports whether a track matches some condition
+type Predicate func(t Track) bool
+
+// Op is a comparison operator used by Compare
+type Op int
+
+// Comparison operators. Text fields are compared case-insensitively.
+const (
+	OpEqual Op = iota
+	OpNotEqual
+	OpLess
+	OpLessOrEqual
+	OpGreater
+	OpGreaterOrEqual
+	OpContains
+)
+
+func (o Op) String() string {
+	switch o {
+	case OpEqual:
+		return "="
+	case OpNotEqual:
+		return "!="
+	case OpLess:
+		return "<"
+	case OpLessOrEqual:
+		return "<="
+	case OpGreater:
+		return ">"
+	case OpGreaterOrEqual:
+		return ">="
+	case OpContains:
+		return "~"
+	default:
+		return "?"
+	}
+}
+
+// All matches every track
+func All() Predicate {
+	return func(t Track) bool { return true }
+}
+
+// And matches tracks that match every predicate
+func And(ps ...Predicate) Predicate {
+	return func(t Track) bool {
+		for _, p := range ps {
+			if !p(t) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or matches tracks that match at least one predicate
+func Or(ps ...Predicate) Predicate {
+	return func(t Track) bool {
+		for _, p := range ps {
+			if p(t) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not inverts a predicate
+func Not(p Predicate) Predicate {
+	return func(t Track) bool { return !p(t) }
+}
+
+// Compare builds a predicate comparing a track field to value. Numeric fields
+// require a numeric value and do not support OpContains.
+func Compare(field Field, op Op, value string) (Predicate, error) {
+	if _, ok := fields[field]; !ok {
+		return nil, fmt.Errorf("unknown field [%s]", field)
+	}
+
+	if field.Numeric() {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("field [%s] needs a number, got [%s]", field, value)
+		}
+		return CompareNumber(field, op, n)
+	}
+
+	v := strings.ToLower(value)
+	if op == OpContains {
+		return func(t Track) bool {
+			return strings.Contains(strings.ToLower(field.Text(t)), v)
+		}, nil
+	}
+
+	return func(t Track) bool {
+		return compareResult(op, strings.Compare(strings.ToLower(field.Text(t)), v))
+	}, nil
+}
+
+// CompareNumber builds a predicate comparing a numeric track field to n
+func CompareNumber(field Field, op Op, n int64) (Predicate, error) {
+	if !field.Numeric() {
+		return nil, fmt.Errorf("field [%s] is not numeric", field)
+	}
+
+	if op == OpContains {
+		return nil, fmt.Errorf("operator [%s] is not supported on numeric field [%s]", op, field)
+	}
+
+	return func(t Track) bool {
+		v := field.Number(t)
+		c := 0
+		switch {
+		case v < n:
+			c = -1
+		case v > n:
+			c = 1
+		}
+		return compareResult(op, c)
+	}, nil
+}
+
+// compareResult checks a three-way comparison result against an operator
+func compareResult(op Op, c int) bool {
+	switch op {
+	case OpEqual:
+		return c == 0
+	case OpNotEqual:
+		return c != 0
+	case OpLess:
+		return c < 0
+	case OpLessOrEqual:
+		return c <= 0
+	case OpGreater:
+		return c > 0
+	case OpGreaterOrEqual:
+		return c >= 0
+	default:
+		return false
+	}
+}
+
+// SortKey orders tracks by a single field
+type SortKey struct {
+	Field      Field
+	Descending bool
+}
+
+// Query selects, orders and pages tracks.
+type Query struct {
+	// Where filters tracks. nil matches everything.
+	Where Predicate
+
+	// Sort orders results by each key in turn. Ties keep their original
+	// order. Text fields honour sort tags and ignore a leading "The".
+	Sort []SortKey
+
+	// Offset skips this many results, Limit caps the number returned. A
+	// Limit of 0 means no limit.
+	Offset int
+	Limit  int
+}
+
+// Apply runs the query against a list of tracks. The input is not modified.
+func (q Query) Apply(tracks []Track) []Track {
+	results := []Track{}
+	for _, t := range tracks {
+		if q.Where == nil || q.Where(t) {
+			results = append(results, t)
+		}
+	}
+
+	if len(q.Sort) > 0 {
+		SortTracks(results, q.Sort...)
+	}
+
+	if q.Offset > 0 {
+		if q.Offset >= len(results) {
+			return []Track{}
+		}
+		results = results[q.Offset:]
+	}
+
+	if q.Limit > 0 && q.Limit < len(results) {
+		results = results[:q.Limit]
+	}
+
+	return results
+}
+
+// Query returns tracks from every shelf that match q
+func (l *Library) Query(q Query) []Track {
+	return q.Apply(l.Tracks())
+}
+
+// SortTracks stably sorts tracks in place by each key in turn
+func SortTracks(tracks []Track, keys ...SortKey) {
+	sort.SliceStable(tracks, func(i, j int) bool {
+		for _, k := range keys {
+			c := compareField(k.Field, tracks[i], tracks[j])
+			if c == 0 {
+				continue
+			}
+
+			if k.Descending {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// compareField performs a three-way comparison of a field on two tracks
+func compareField(f Field, a, b Track) int {
+	if f.Numeric() {
+		x, y := f.Number(a), f.Number(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return strings.Compare(strings.ToLower(f.SortText(a)), strings.ToLower(f.SortText(b)))
+}
+
+// ParseSortKeys parses sort keys written as field names, with a leading "-"
+// for descending order, eg: ["albumartist", "-year", "disc", "track"].
+func ParseSortKeys(specs []string) ([]SortKey, error) {
+	keys := []SortKey{}
+	for _, spec := range specs {
+		k := SortKey{}
+		if strings.HasPrefix(spec, "-") {
+			k.Descending = true
+			spec = spec[1:]
+		}
+
+		f, err := ParseField(spec)
+		if err != nil {
+			return nil, err
+		}
+		k.Field = f
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+func (k SortKey) String() string {
+	if k.Descending {
+		return "-" + string(k.Field)
+	}
+	return string(k.Field)
+}
@@ -0,0 +1,150 @@
+package library_test
+
+import (
+	"testing"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var queryTracks = []library.Track{
+	{Path: "1", Artist: "Tame Impala", Album: "Currents", Title: "Let It Happen", Year: 2015, TrackNumber: 1, Rating: 255},
+	{Path: "2", Artist: "Tame Impala", Album: "Lonerism", Title: "Elephant", Year: 2012, TrackNumber: 7, Rating: 196},
+	{Path: "3", Artist: "Pond", Album: "Hobo Rocket", Title: "Whatever Happened", Year: 2013, TrackNumber: 2, Rating: 128},
+	{Path: "4", Artist: "Tame Impala", Album: "Currents", Title: "Eventually", Year: 2015, TrackNumber: 8, Rating: 0},
+	{Path: "5", Artist: "King Gizzard", Album: "Nonagon Infinity", Title: "Robot Stop", Year: 2016, TrackNumber: 1, Rating: 196},
+}
+
+func paths(tracks []library.Track) []string {
+	p := []string{}
+	for _, t := range tracks {
+		p = append(p, t.Path)
+	}
+	return p
+}
+
+func mustCompare(t *testing.T, f library.Field, op library.Op, v string) library.Predicate {
+	p, err := library.Compare(f, op, v)
+	require.NoError(t, err)
+	return p
+}
+
+func TestQueryWhere(t *testing.T) {
+	var tests = []struct {
+		name     string
+		where    library.Predicate
+		expected []string
+	}{
+		{"nil", nil, []string{"1", "2", "3", "4", "5"}},
+		{"all", library.All(), []string{"1", "2", "3", "4", "5"}},
+		{"equal ignores case", mustCompare(t, library.FieldArtist, library.OpEqual, "tame impala"), []string{"1", "2", "4"}},
+		{"contains", mustCompare(t, library.FieldTitle, library.OpContains, "happen"), []string{"1", "3"}},
+		{"numeric", mustCompare(t, library.FieldYear, library.OpGreaterOrEqual, "2015"), []string{"1", "4", "5"}},
+		{"not equal", mustCompare(t, library.FieldRating, library.OpNotEqual, "0"), []string{"1", "2", "3", "5"}},
+		{"and", library.And(
+			mustCompare(t, library.FieldArtist, library.OpEqual, "Tame Impala"),
+			mustCompare(t, library.FieldYear, library.OpLess, "2015"),
+		), []string{"2"}},
+		{"or", library.Or(
+			mustCompare(t, library.FieldArtist, library.OpEqual, "Pond"),
+			mustCompare(t, library.FieldRating, library.OpEqual, "255"),
+		), []string{"1", "3"}},
+		{"not", library.Not(mustCompare(t, library.FieldAlbum, library.OpEqual, "currents")), []string{"2", "3", "5"}},
+	}
+
+	for _, test := range tests {
+		res := library.Query{Where: test.where}.Apply(queryTracks)
+		assert.Equal(t, test.expected, paths(res), test.name)
+	}
+}
+
+func TestQuerySortAndPage(t *testing.T) {
+	var tests = []struct {
+		name     string
+		query    library.Query
+		expected []string
+	}{
+		{"single key", library.Query{Sort: []library.SortKey{{Field: library.FieldTitle}}}, []string{"2", "4", "1", "5", "3"}},
+		{"descending", library.Query{Sort: []library.SortKey{{Field: library.FieldYear, Descending: true}}}, []string{"5", "1", "4", "3", "2"}},
+		{"multi key", library.Query{Sort: []library.SortKey{
+			{Field: library.FieldArtist},
+			{Field: library.FieldYear},
+			{Field: library.FieldTrackNumber},
+		}}, []string{"5", "3", "2", "1", "4"}},
+		{"limit", library.Query{Limit: 2}, []string{"1", "2"}},
+		{"offset", library.Query{Offset: 3}, []string{"4", "5"}},
+		{"offset past end", library.Query{Offset: 10}, []string{}},
+		{"offset and limit", library.Query{Offset: 1, Limit: 2, Sort: []library.SortKey{{Field: library.FieldRating, Descending: true}}}, []string{"2", "5"}},
+	}
+
+	for _, test := range tests {
+		res := test.query.Apply(queryTracks)
+		assert.Equal(t, test.expected, paths(res), test.name)
+	}
+}
+
+func TestCompareErrors(t *testing.T) {
+	_, err := library.Compare("nope", library.OpEqual, "x")
+	assert.Error(t, err)
+
+	_, err = library.Compare(library.FieldYear, library.OpEqual, "last year")
+	assert.Error(t, err)
+
+	_, err = library.Compare(library.FieldYear, library.OpContains, "20")
+	assert.Error(t, err)
+}
+
+func TestLibraryQuery(t *testing.T) {
+	a := library.NewMockAudioLibrary(queryTracks[:2])
+	b := library.NewMockAudioLibrary(queryTracks[2:])
+	db, err := library.NewLibrary([]library.AudioShelf{a, b})
+	require.NoError(t, err)
+
+	res := db.Query(library.Query{
+		Where: mustCompare(t, library.FieldAlbum, library.OpEqual, "currents"),
+		Sort:  []library.SortKey{{Field: library.FieldTrackNumber, Descending: true}},
+	})
+	assert.Equal(t, []string{"4", "1"}, paths(res))
+}
+
+func TestSortTracksSortNames(t *testing.T) {
+	tracks := []library.Track{
+		{Path: "1", Artist: "The Beatles"},
+		{Path: "2", Artist: "Beck"},
+		{Path: "3", Artist: "Aphex Twin", ArtistSort: "Twin, Aphex"},
+		{Path: "4", Artist: "Theo Parrish"},
+		{Path: "5", Artist: "the black keys"},
+	}
+
+	library.SortTracks(tracks, library.SortKey{Field: library.FieldArtist})
+	assert.Equal(t, []string{"1", "2", "5", "4", "3"}, paths(tracks))
+}
+
+func TestSortTracksAlbumArtist(t *testing.T) {
+	tracks := []library.Track{
+		{Path: "1", Artist: "Pond", Year: 2013, DiscNumber: 1, TrackNumber: 2},
+		{Path: "2", AlbumArtist: "Various", Artist: "Pond", Year: 2010, DiscNumber: 1, TrackNumber: 1},
+		{Path: "3", Artist: "Pond", Year: 2013, DiscNumber: 1, TrackNumber: 1},
+		{Path: "4", Artist: "Pond", Year: 2012, DiscNumber: 2, TrackNumber: 1},
+		{Path: "5", Artist: "Pond", Year: 2012, DiscNumber: 1, TrackNumber: 9},
+	}
+
+	keys, err := library.ParseSortKeys([]string{"albumartist", "year", "disc", "track"})
+	require.NoError(t, err)
+
+	library.SortTracks(tracks, keys...)
+	assert.Equal(t, []string{"5", "4", "3", "1", "2"}, paths(tracks))
+}
+
+func TestParseSortKeys(t *testing.T) {
+	keys, err := library.ParseSortKeys([]string{"Artist", "-year"})
+	require.NoError(t, err)
+	assert.Equal(t, []library.SortKey{
+		{Field: library.FieldArtist},
+		{Field: library.FieldYear, Descending: true},
+	}, keys)
+
+	_, err = library.ParseSortKeys([]string{"-nope"})
+	assert.Error(t, err)
+}
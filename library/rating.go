@@ -0,0 +1,233 @@
+package library
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// RatingPrecedence decides whether a file's tags or the rating backend win
+// when both hold a rating for a track
+type RatingPrecedence string
+
+const (
+	// RatingTagFirst uses the rating in the file's tags, falling back to the
+	// backend for files without one
+	RatingTagFirst RatingPrecedence = "tag"
+
+	// RatingStoreFirst uses the backend's rating, falling back to the file's
+	// tags for tracks it has none for
+	RatingStoreFirst RatingPrecedence = "store"
+)
+
+// ParseRatingPrecedence parses a configured precedence. Empty means tag first.
+func ParseRatingPrecedence(s string) (RatingPrecedence, error) {
+	switch p := RatingPrecedence(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return RatingTagFirst, nil
+	case RatingTagFirst, RatingStoreFirst:
+		return p, nil
+	default:
+		return RatingTagFirst, fmt.Errorf("unknown rating precedence [%s], expected [%s] or [%s]", s, RatingTagFirst, RatingStoreFirst)
+	}
+}
+
+// RatingBackend keeps ratings outside of a track's tags, for files that can
+// not hold one or can not be written
+type RatingBackend interface {
+	// Rating returns the rating kept for a track. 0 with ok set means the
+	// track was explicitly unrated.
+	Rating(track Track) (rating uint8, ok bool)
+
+	// SetRating keeps a rating for a track
+	SetRating(track Track, rating uint8) error
+
+	// OverrideRating keeps a rating for a track whose file could not be
+	// written. It wins over the file's own rating, tagged, for as long as
+	// the file still has it.
+	OverrideRating(track Track, rating, tagged uint8) error
+
+	// Overrides checks if the kept rating wins over the one in track's tags
+	Overrides(track Track) bool
+}
+
+// StarsRating converts a 0-5 star score to a rating, the inverse of
+// LinearStars
+func StarsRating(stars float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(stars, 5)) / 5 * math.MaxUint8))
+}
+
+// PopmFrames decides which POPM frame is read when a file has several
+type PopmFrames string
+
+const (
+	// PopmOwn reads the frame with the profile's email, otherwise the
+	// highest rated one
+	PopmOwn PopmFrames = "own"
+
+	// PopmHighest reads the highest rated frame
+	PopmHighest PopmFrames = "highest"
+
+	// PopmFirst and PopmLast read the first or last frame in the file
+	PopmFirst PopmFrames = "first"
+	PopmLast  PopmFrames = "last"
+)
+
+// RatingStep maps a star score to and from a POPM rating byte
+type RatingStep struct {
+	Stars float64
+
+	// Byte is written for this score
+	Byte uint8
+
+	// Min is the lowest byte read as this score. A byte is read as the step
+	// with the highest Min at or below it.
+	Min uint8
+}
+
+// RatingProfile describes how a player stores ratings in ID3 POPM frames.
+// POPM has no standard scale, so each player picks its own bytes and email.
+type RatingProfile struct {
+	Name string
+
+	// Email is written to the POPM frame grump owns
+	Email string
+
+	// ReadEmails limits which frames are read. Empty reads every frame.
+	ReadEmails []string
+
+	Frames PopmFrames
+	Steps  []RatingStep
+}
+
+// halfStarSteps is the scale grump has always written, shared by
+// MediaMonkey and MusicBee. 1 star sits below half a star.
+var halfStarSteps = []RatingStep{
+	{Stars: 1, Byte: 1, Min: 1},
+	{Stars: 0.5, Byte: 13, Min: 2},
+	{Stars: 1.5, Byte: 54, Min: 14},
+	{Stars: 2, Byte: 64, Min: 55},
+	{Stars: 2.5, Byte: 118, Min: 65},
+	{Stars: 3, Byte: 128, Min: 119},
+	{Stars: 3.5, Byte: 186, Min: 129},
+	{Stars: 4, Byte: 196, Min: 187},
+	{Stars: 4.5, Byte: 242, Min: 197},
+	{Stars: 5, Byte: 255, Min: 243},
+}
+
+// wholeStarSteps is the Windows Media Player scale, which has no half stars
+var wholeStarSteps = []RatingStep{
+	{Stars: 1, Byte: 1, Min: 1},
+	{Stars: 2, Byte: 64, Min: 32},
+	{Stars: 3, Byte: 128, Min: 96},
+	{Stars: 4, Byte: 196, Min: 160},
+	{Stars: 5, Byte: 255, Min: 224},
+}
+
+// wmpEmail is the POPM email of Windows Media Player
+const wmpEmail = "Windows Media Player 9 Series"
+
+// RatingProfiles are the built-in profiles, by name
+var RatingProfiles = map[string]RatingProfile{
+	"grump":       {Name: "grump", Email: "grump", Frames: PopmOwn, Steps: halfStarSteps},
+	"mediamonkey": {Name: "mediamonkey", Email: "no@email", Frames: PopmOwn, Steps: halfStarSteps},
+	"musicbee":    {Name: "musicbee", Email: "MusicBee", Frames: PopmOwn, Steps: halfStarSteps},
+	"wmp":         {Name: "wmp", Email: wmpEmail, Frames: PopmOwn, Steps: wholeStarSteps},
+	// foobar2000 reads and writes the Windows Media Player frame
+	"foobar2000": {Name: "foobar2000", Email: wmpEmail, Frames: PopmOwn, Steps: wholeStarSteps},
+}
+
+// DefaultRatingProfile is used when no profile is configured
+var DefaultRatingProfile = RatingProfiles["grump"]
+
+// ratingProfile returns profile, or the default if it is nil
+func ratingProfile(profile *RatingProfile) *RatingProfile {
+	if profile == nil {
+		return &DefaultRatingProfile
+	}
+	return profile
+}
+
+// Validate checks a profile can map every rating
+func (p *RatingProfile) Validate() error {
+	if p.Email == "" {
+		return fmt.Errorf("rating profile [%s] has no email", p.Name)
+	}
+
+	switch p.Frames {
+	case PopmOwn, PopmHighest, PopmFirst, PopmLast:
+	default:
+		return fmt.Errorf("rating profile [%s] has unknown frames [%s], expected own, highest, first or last", p.Name, p.Frames)
+	}
+
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("rating profile [%s] has no steps", p.Name)
+	}
+
+	for _, s := range p.Steps {
+		if s.Stars <= 0 || s.Stars > 5 || s.Stars*2 != math.Trunc(s.Stars*2) {
+			return fmt.Errorf("rating profile [%s] has invalid stars [%g], expected 0.5 - 5 in half steps", p.Name, s.Stars)
+		}
+		if s.Byte == 0 || s.Min == 0 {
+			return fmt.Errorf("rating profile [%s] uses byte 0 for [%g] stars, which means unrated", p.Name, s.Stars)
+		}
+	}
+
+	return nil
+}
+
+// Rating converts a POPM byte to a rating
+func (p *RatingProfile) Rating(b uint8) uint8 {
+	if b == 0 || len(p.Steps) == 0 {
+		return 0
+	}
+
+	// bytes below every step's Min read as the lowest step
+	match := p.Steps[0]
+	for _, s := range p.Steps {
+		if s.Min < match.Min {
+			match = s
+		}
+	}
+
+	for _, s := range p.Steps {
+		if s.Min <= b && s.Min >= match.Min {
+			match = s
+		}
+	}
+
+	return StarsRating(match.Stars)
+}
+
+// Byte converts a rating to a POPM byte, using the step closest to its score
+func (p *RatingProfile) Byte(rating uint8) uint8 {
+	if rating == 0 || len(p.Steps) == 0 {
+		return 0
+	}
+
+	stars := math.Max(LinearStars(rating), 0.5)
+	match := p.Steps[0]
+	for _, s := range p.Steps[1:] {
+		d, best := math.Abs(s.Stars-stars), math.Abs(match.Stars-stars)
+		// ties round up, eg: 1.5 stars is 2 on a whole star scale
+		if d < best || (d == best && s.Stars > match.Stars) {
+			match = s
+		}
+	}
+
+	return match.Byte
+}
+
+// readsEmail checks if frames with email are read
+func (p *RatingProfile) readsEmail(email string) bool {
+	if len(p.ReadEmails) == 0 {
+		return true
+	}
+
+	for _, e := range p.ReadEmails {
+		if strings.EqualFold(e, email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package library_test
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/bogem/id3v2"
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRatingProfile(t *testing.T) {
+	grump := library.RatingProfiles["grump"]
+	wmp := library.RatingProfiles["wmp"]
+
+	var tests = []struct {
+		profile library.RatingProfile
+		b       uint8
+		stars   float64
+	}{
+		{grump, 0, 0},
+		{grump, 1, 1},
+		{grump, 13, 0.5},
+		{grump, 54, 1.5},
+		{grump, 196, 4},
+		{grump, 200, 4.5},
+		{grump, 255, 5},
+		{wmp, 1, 1},
+		{wmp, 31, 1},
+		{wmp, 32, 2},
+		{wmp, 128, 3},
+		{wmp, 224, 5},
+	}
+
+	for _, test := range tests {
+		rating := test.profile.Rating(test.b)
+		assert.Equal(t, test.stars, library.LinearStars(rating), "%s %d", test.profile.Name, test.b)
+	}
+
+	// writing uses the closest step, half stars round up on a whole scale
+	assert.Equal(t, uint8(13), grump.Byte(library.StarsRating(0.5)))
+	assert.Equal(t, uint8(1), grump.Byte(library.StarsRating(1)))
+	assert.Equal(t, uint8(64), wmp.Byte(library.StarsRating(1.5)))
+	assert.Equal(t, uint8(0), wmp.Byte(0))
+
+	assert.NoError(t, wmp.Validate())
+	bad := library.RatingProfile{Name: "bad", Email: "me", Frames: library.PopmOwn, Steps: []library.RatingStep{{Stars: 1.2, Byte: 1, Min: 1}}}
+	assert.Error(t, bad.Validate())
+}
+
+func TestPopularimeterFrames(t *testing.T) {
+	path := writeMP3(t, bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x64}, 1000), 4, "2015")
+	tg, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	require.NoError(t, err)
+	for _, popm := range []id3v2.PopularimeterFrame{
+		{Email: "no@email", Rating: 64, Counter: big.NewInt(0)},
+		{Email: "Windows Media Player 9 Series", Rating: 255, Counter: big.NewInt(0)},
+		{Email: "grump", Rating: 13, Counter: big.NewInt(0)},
+	} {
+		tg.AddFrame(tg.CommonID("Popularimeter"), popm)
+	}
+	require.NoError(t, tg.Save())
+	tg.Close()
+
+	profile := func(name string, frames library.PopmFrames, emails ...string) *library.RatingProfile {
+		p := library.RatingProfiles[name]
+		p.Frames = frames
+		p.ReadEmails = emails
+		return &p
+	}
+
+	var tests = []struct {
+		profile *library.RatingProfile
+		stars   float64
+		email   string
+	}{
+		{profile("grump", library.PopmOwn), 0.5, "grump"},
+		{profile("mediamonkey", library.PopmOwn), 2, "no@email"},
+		{profile("grump", library.PopmHighest), 5, "Windows Media Player 9 Series"},
+		{profile("grump", library.PopmFirst), 2, "no@email"},
+		{profile("wmp", library.PopmOwn, "Windows Media Player 9 Series"), 5, "Windows Media Player 9 Series"},
+		{profile("grump", library.PopmHighest, "no@email", "grump"), 2, "no@email"},
+	}
+
+	ctx := context.Background()
+	for _, test := range tests {
+		track, err := (&library.ID3v2Handler{Profile: test.profile}).Load(ctx, path)
+		require.NoError(t, err)
+		assert.Equal(t, test.stars, library.LinearStars(track.Rating), "%s %s", test.profile.Name, test.profile.Frames)
+		assert.Equal(t, test.email, track.RatingEmail, "%s %s", test.profile.Name, test.profile.Frames)
+	}
+
+	// saving only replaces the profile's own frame
+	h := &library.ID3v2Handler{Profile: profile("wmp", library.PopmOwn)}
+	track, err := h.Load(ctx, path)
+	require.NoError(t, err)
+	track.Rating = library.StarsRating(3)
+	_, err = h.Save(ctx, track)
+	require.NoError(t, err)
+
+	tg, err = id3v2.Open(path, id3v2.Options{Parse: true})
+	require.NoError(t, err)
+	defer tg.Close()
+
+	ratings := map[string]uint8{}
+	for _, f := range tg.GetFrames(tg.CommonID("Popularimeter")) {
+		popm := f.(id3v2.PopularimeterFrame)
+		ratings[popm.Email] = popm.Rating
+	}
+	assert.Equal(t, map[string]uint8{"no@email": 64, "Windows Media Player 9 Series": 128, "grump": 13}, ratings)
+}
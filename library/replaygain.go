@@ -0,0 +1,208 @@
+package library
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bogem/id3v2"
+)
+
+// ReplayGain tag names, shared by ID3 TXXX frames and vorbis comments
+const (
+	replayGainTrackGainKey = "REPLAYGAIN_TRACK_GAIN"
+	replayGainTrackPeakKey = "REPLAYGAIN_TRACK_PEAK"
+	replayGainAlbumGainKey = "REPLAYGAIN_ALBUM_GAIN"
+	replayGainAlbumPeakKey = "REPLAYGAIN_ALBUM_PEAK"
+)
+
+// replayGainKeys are every ReplayGain tag, in the order they are written
+var replayGainKeys = []string{
+	replayGainTrackGainKey,
+	replayGainTrackPeakKey,
+	replayGainAlbumGainKey,
+	replayGainAlbumPeakKey,
+}
+
+// ReplayGain holds the values used to play tracks at the same loudness, see
+// https://wiki.hydrogenaud.io/index.php?title=ReplayGain_2.0_specification
+// Gains are in dB and peaks are linear, where 1 is full scale. A gain is
+// only set if its peak is, a gain read without a peak gets a peak of 1.
+type ReplayGain struct {
+	TrackGain float64 `json:",omitempty"`
+	TrackPeak float64 `json:",omitempty"`
+	AlbumGain float64 `json:",omitempty"`
+	AlbumPeak float64 `json:",omitempty"`
+}
+
+// HasTrack checks if the track gain is set
+func (r ReplayGain) HasTrack() bool {
+	return r.TrackPeak > 0
+}
+
+// HasAlbum checks if the album gain is set
+func (r ReplayGain) HasAlbum() bool {
+	return r.AlbumPeak > 0
+}
+
+// ReplayGainMode is which gain is applied when playing a track
+type ReplayGainMode string
+
+const (
+	// ReplayGainOff plays tracks as they are
+	ReplayGainOff ReplayGainMode = "off"
+	// ReplayGainTrack plays every track at the same loudness
+	ReplayGainTrack ReplayGainMode = "track"
+	// ReplayGainAlbum keeps the loudness of tracks within an album, falling
+	// back to the track gain
+	ReplayGainAlbum ReplayGainMode = "album"
+)
+
+// ParseReplayGainMode parses a ReplayGain mode, defaulting to off
+func ParseReplayGainMode(s string) (ReplayGainMode, error) {
+	switch m := ReplayGainMode(strings.ToLower(s)); m {
+	case "", ReplayGainOff:
+		return ReplayGainOff, nil
+	case ReplayGainTrack, ReplayGainAlbum:
+		return m, nil
+	default:
+		return ReplayGainOff, fmt.Errorf("could not parse replay gain mode [%s]: [unknown mode]", s)
+	}
+}
+
+// Scale returns the factor to multiply samples by to apply a gain in mode,
+// plus preamp dB. It is lowered if needed so the peak does not clip. Tracks
+// without a gain play as they are.
+func (r ReplayGain) Scale(mode ReplayGainMode, preamp float64) float64 {
+	gain, peak := 0.0, 0.0
+	switch {
+	case mode == ReplayGainAlbum && r.HasAlbum():
+		gain, peak = r.AlbumGain, r.AlbumPeak
+	case mode != ReplayGainOff && r.HasTrack():
+		gain, peak = r.TrackGain, r.TrackPeak
+	default:
+		return 1
+	}
+
+	scale := math.Pow(10, (gain+preamp)/20)
+	if scale*peak > 1 {
+		scale = 1 / peak
+	}
+	return scale
+}
+
+// parseReplayGain reads ReplayGain values with get, which returns the value
+// of a tag or an empty string
+func parseReplayGain(get func(key string) string) ReplayGain {
+	r := ReplayGain{}
+
+	gain, ok := parseReplayGainValue(get(replayGainTrackGainKey))
+	if ok {
+		r.TrackGain, r.TrackPeak = gain, 1
+		if peak, ok := parseReplayGainValue(get(replayGainTrackPeakKey)); ok && peak > 0 {
+			r.TrackPeak = peak
+		}
+	}
+
+	gain, ok = parseReplayGainValue(get(replayGainAlbumGainKey))
+	if ok {
+		r.AlbumGain, r.AlbumPeak = gain, 1
+		if peak, ok := parseReplayGainValue(get(replayGainAlbumPeakKey)); ok && peak > 0 {
+			r.AlbumPeak = peak
+		}
+	}
+
+	return r
+}
+
+// parseReplayGainValue parses a gain (eg: "-6.50 dB") or peak
+func parseReplayGainValue(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && strings.EqualFold(s[len(s)-2:], "db") {
+		s = strings.TrimSpace(s[:len(s)-2])
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// formatReplayGain returns the tag values of r. Gains that are not set are
+// empty, so their tags are removed.
+func formatReplayGain(r ReplayGain) map[string]string {
+	values := map[string]string{}
+	for _, key := range replayGainKeys {
+		values[key] = ""
+	}
+
+	if r.HasTrack() {
+		values[replayGainTrackGainKey] = fmt.Sprintf("%.2f dB", r.TrackGain)
+		values[replayGainTrackPeakKey] = fmt.Sprintf("%.6f", r.TrackPeak)
+	}
+
+	if r.HasAlbum() {
+		values[replayGainAlbumGainKey] = fmt.Sprintf("%.2f dB", r.AlbumGain)
+		values[replayGainAlbumPeakKey] = fmt.Sprintf("%.6f", r.AlbumPeak)
+	}
+
+	return values
+}
+
+// id3ReplayGain reads ReplayGain from TXXX frames. Descriptions are matched
+// without case, as some taggers write them in lowercase.
+func id3ReplayGain(tag *id3v2.Tag) ReplayGain {
+	return parseReplayGain(func(key string) string {
+		for _, f := range tag.GetFrames("TXXX") {
+			udf, ok := f.(id3v2.UserDefinedTextFrame)
+			if ok && strings.EqualFold(udf.Description, key) {
+				return udf.Value
+			}
+		}
+		return ""
+	})
+}
+
+// setID3ReplayGain replaces the ReplayGain TXXX frames, keeping others
+func setID3ReplayGain(tag *id3v2.Tag, r ReplayGain) {
+	frames := append([]id3v2.Framer{}, tag.GetFrames("TXXX")...)
+	tag.DeleteFrames("TXXX")
+
+	for _, f := range frames {
+		udf, ok := f.(id3v2.UserDefinedTextFrame)
+		if ok && containsFold(replayGainKeys, udf.Description) {
+			continue
+		}
+		tag.AddFrame("TXXX", f)
+	}
+
+	values := formatReplayGain(r)
+	for _, key := range replayGainKeys {
+		if values[key] == "" {
+			continue
+		}
+
+		tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    tag.DefaultEncoding(),
+			Description: key,
+			Value:       values[key],
+		})
+	}
+}
+
+// vorbisReplayGain reads ReplayGain from raw vorbis comments
+func vorbisReplayGain(raw map[string]interface{}) ReplayGain {
+	return parseReplayGain(func(key string) string {
+		return rawString(raw, strings.ToLower(key))
+	})
+}
+
+// setReplayGain replaces the ReplayGain comments
+func (vc *vorbisComments) setReplayGain(r ReplayGain) {
+	values := formatReplayGain(r)
+	for _, key := range replayGainKeys {
+		vc.set(key, values[key])
+	}
+}
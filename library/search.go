@@ -0,0 +1,414 @@
+package library
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SearchOptions controls how search queries are interpreted
+type SearchOptions struct {
+	// Stars converts a track rating into a 0-5 star score in half-star
+	// steps. Rating filters in queries are written in stars. Defaults to
+	// LinearStars.
+	Stars func(rating uint8) float64
+
+	// DefaultFields are matched by terms that do not name a field. Defaults
+	// to artist, album and title.
+	DefaultFields []Field
+
+	// Fuzzy makes terms without a field match when their characters appear
+	// in order in a default field (eg: "tmimp" matches "Tame Impala"), rather
+	// than requiring an exact substring.
+	Fuzzy bool
+}
+
+// LinearStars spreads 0-255 ratings evenly over 0-5 stars
+func LinearStars(rating uint8) float64 {
+	return math.Round(float64(rating)/255*10) / 2
+}
+
+// FuzzyMatch reports whether every character of pattern appears in text in
+// the same order, ignoring case.
+func FuzzyMatch(pattern, text string) bool {
+	text = strings.ToLower(text)
+	for _, r := range strings.ToLower(pattern) {
+		i := strings.IndexRune(text, r)
+		if i < 0 {
+			return false
+		}
+		text = text[i+len(string(r)):]
+	}
+
+	return true
+}
+
+func fuzzyPredicate(field Field, pattern string) Predicate {
+	return func(t Track) bool {
+		return FuzzyMatch(pattern, field.Text(t))
+	}
+}
+
+// SearchError describes why a search query could not be parsed
+type SearchError struct {
+	// Pos is the byte offset of the problem in the query
+	Pos int
+	Msg string
+}
+
+func (e *SearchError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Pos+1, e.Msg)
+}
+
+// ParseSearch turns a search query into a predicate. Queries look like:
+//
+//	artist:"tame impala" rating>=4 year:2010..2015 genre:psych -album:live
+//
+// Terms are ANDed together unless separated by OR, and can be grouped with
+// parentheses. A leading - negates a term. field:value matches text fields
+// containing value, and numeric fields equal to value or within an inclusive
+// a..b range (either end may be left open). =, !=, <, <=, > and >= compare
+// fields directly. Terms without a field match any of the default fields.
+func ParseSearch(query string, opts SearchOptions) (Predicate, error) {
+	if opts.Stars == nil {
+		opts.Stars = LinearStars
+	}
+	if len(opts.DefaultFields) == 0 {
+		opts.DefaultFields = []Field{FieldArtist, FieldAlbum, FieldTitle}
+	}
+
+	p := &searchParser{query: query, opts: opts}
+	p.skipSpace()
+	if p.eof() {
+		return All(), nil
+	}
+
+	pred, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.query[p.pos])
+	}
+
+	return pred, nil
+}
+
+type searchParser struct {
+	query string
+	pos   int
+	opts  SearchOptions
+}
+
+func (p *searchParser) errorf(format string, args ...interface{}) error {
+	return &SearchError{Pos: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *searchParser) eof() bool {
+	return p.pos >= len(p.query)
+}
+
+func (p *searchParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.query[p.pos]
+}
+
+func (p *searchParser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(rune(p.query[p.pos])) {
+		p.pos++
+	}
+}
+
+// atOr checks for an OR keyword at the current position
+func (p *searchParser) atOr() bool {
+	rest := p.query[p.pos:]
+	if !strings.HasPrefix(rest, "OR") {
+		return false
+	}
+	return len(rest) == 2 || unicode.IsSpace(rune(rest[2])) || rest[2] == '('
+}
+
+// parseOr := and ("OR" and)*
+func (p *searchParser) parseOr() (Predicate, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	preds := []Predicate{first}
+	for p.atOr() {
+		p.pos += 2
+		p.skipSpace()
+		if p.eof() || p.peek() == ')' {
+			return nil, p.errorf("expected a term after OR")
+		}
+
+		next, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, next)
+	}
+
+	if len(preds) == 1 {
+		return first, nil
+	}
+	return Or(preds...), nil
+}
+
+// parseAnd := unary+
+func (p *searchParser) parseAnd() (Predicate, error) {
+	preds := []Predicate{}
+	for !p.eof() && p.peek() != ')' && !p.atOr() {
+		pred, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+		p.skipSpace()
+	}
+
+	if len(preds) == 0 {
+		if p.atOr() {
+			return nil, p.errorf("expected a term before OR")
+		}
+		return nil, p.errorf("expected a term")
+	}
+
+	if len(preds) == 1 {
+		return preds[0], nil
+	}
+	return And(preds...), nil
+}
+
+// parseUnary := "-" unary | "(" or ")" | term
+func (p *searchParser) parseUnary() (Predicate, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		if p.eof() || unicode.IsSpace(rune(p.peek())) {
+			return nil, p.errorf("expected a term after -")
+		}
+		pred, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(pred), nil
+	case '(':
+		start := p.pos
+		p.pos++
+		p.skipSpace()
+		pred, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, &SearchError{Pos: start, Msg: "unclosed ("}
+		}
+		p.pos++
+		return pred, nil
+	case ')':
+		return nil, p.errorf("unexpected )")
+	}
+
+	return p.parseTerm()
+}
+
+// parseTerm := [field op] value
+func (p *searchParser) parseTerm() (Predicate, error) {
+	start := p.pos
+
+	// look for a field name followed by an operator
+	i := p.pos
+	for i < len(p.query) && (unicode.IsLetter(rune(p.query[i])) || p.query[i] == '_') {
+		i++
+	}
+	if i > p.pos && i < len(p.query) {
+		if op, n := searchOp(p.query[i:]); n > 0 {
+			name := p.query[p.pos:i]
+			field, err := ParseField(strings.ReplaceAll(name, "_", ""))
+			if err != nil {
+				return nil, p.errorf("unknown field %q", name)
+			}
+
+			p.pos = i + n
+			valuePos := p.pos
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			if value == "" {
+				return nil, &SearchError{Pos: valuePos, Msg: fmt.Sprintf("expected a value after %q", p.query[start:valuePos])}
+			}
+
+			return p.fieldPredicate(field, op, value, valuePos)
+		}
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, p.errorf("expected a term")
+	}
+
+	preds := []Predicate{}
+	for _, f := range p.opts.DefaultFields {
+		if p.opts.Fuzzy {
+			preds = append(preds, fuzzyPredicate(f, value))
+			continue
+		}
+
+		pred, err := Compare(f, OpContains, value)
+		if err != nil {
+			return nil, &SearchError{Pos: start, Msg: err.Error()}
+		}
+		preds = append(preds, pred)
+	}
+	return Or(preds...), nil
+}
+
+// searchOp recognizes an operator at the start of s, returning the operator
+// and its length. ":" is returned as OpContains.
+func searchOp(s string) (Op, int) {
+	switch {
+	case strings.HasPrefix(s, ">="):
+		return OpGreaterOrEqual, 2
+	case strings.HasPrefix(s, "<="):
+		return OpLessOrEqual, 2
+	case strings.HasPrefix(s, "!="):
+		return OpNotEqual, 2
+	case strings.HasPrefix(s, ">"):
+		return OpGreater, 1
+	case strings.HasPrefix(s, "<"):
+		return OpLess, 1
+	case strings.HasPrefix(s, "="):
+		return OpEqual, 1
+	case strings.HasPrefix(s, ":"):
+		return OpContains, 1
+	default:
+		return 0, 0
+	}
+}
+
+// parseValue reads a quoted string or a bare word
+func (p *searchParser) parseValue() (string, error) {
+	if p.peek() == '"' {
+		start := p.pos
+		p.pos++
+		var b strings.Builder
+		for !p.eof() {
+			c := p.query[p.pos]
+			switch {
+			case c == '\\' && p.pos+1 < len(p.query):
+				b.WriteByte(p.query[p.pos+1])
+				p.pos += 2
+			case c == '"':
+				p.pos++
+				return b.String(), nil
+			default:
+				b.WriteByte(c)
+				p.pos++
+			}
+		}
+		return "", &SearchError{Pos: start, Msg: "unterminated quote"}
+	}
+
+	start := p.pos
+	for !p.eof() {
+		c := p.query[p.pos]
+		if unicode.IsSpace(rune(c)) || c == '(' || c == ')' {
+			break
+		}
+		p.pos++
+	}
+	return p.query[start:p.pos], nil
+}
+
+// fieldPredicate builds the predicate for a field term
+func (p *searchParser) fieldPredicate(field Field, op Op, value string, pos int) (Predicate, error) {
+	wrap := func(err error) error {
+		if err == nil {
+			return nil
+		}
+		return &SearchError{Pos: pos, Msg: err.Error()}
+	}
+
+	// ranges, eg: year:2010..2015
+	if op == OpContains {
+		if lo, hi, ok := strings.Cut(value, ".."); ok {
+			if !field.Numeric() {
+				return nil, wrap(fmt.Errorf("ranges are only supported on numeric fields, not [%s]", field))
+			}
+			if lo == "" && hi == "" {
+				return nil, wrap(fmt.Errorf("range needs at least one end"))
+			}
+
+			preds := []Predicate{}
+			if lo != "" {
+				pred, err := p.numberPredicate(field, OpGreaterOrEqual, lo)
+				if err != nil {
+					return nil, wrap(err)
+				}
+				preds = append(preds, pred)
+			}
+			if hi != "" {
+				pred, err := p.numberPredicate(field, OpLessOrEqual, hi)
+				if err != nil {
+					return nil, wrap(err)
+				}
+				preds = append(preds, pred)
+			}
+			return And(preds...), nil
+		}
+
+		if field.Numeric() {
+			op = OpEqual
+		}
+	}
+
+	if field.Numeric() {
+		pred, err := p.numberPredicate(field, op, value)
+		return pred, wrap(err)
+	}
+
+	pred, err := Compare(field, op, value)
+	return pred, wrap(err)
+}
+
+// numberPredicate compares numeric fields, interpreting ratings as stars
+func (p *searchParser) numberPredicate(field Field, op Op, value string) (Predicate, error) {
+	if field != FieldRating {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("field [%s] needs a whole number, got [%s]", field, value)
+		}
+		return CompareNumber(field, op, n)
+	}
+
+	stars, err := strconv.ParseFloat(value, 64)
+	if err != nil || stars < 0 || stars > 5 || math.Mod(stars*2, 1) != 0 {
+		return nil, fmt.Errorf("rating must be 0-5 stars in steps of 0.5, got [%s]", value)
+	}
+
+	// compare in half stars to avoid float equality problems
+	want := int64(stars * 2)
+	starsFunc := p.opts.Stars
+	return func(t Track) bool {
+		have := int64(math.Round(starsFunc(t.Rating) * 2))
+		c := 0
+		switch {
+		case have < want:
+			c = -1
+		case have > want:
+			c = 1
+		}
+		return compareResult(op, c)
+	}, nil
+}
@@ -0,0 +1,199 @@
+package library_test
+
+import (
+	"testing"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+)
+
+var searchTracks = []library.Track{
+	{Path: "1", Artist: "Tame Impala", Album: "Currents", Title: "Let It Happen", Genre: "Psychedelic", Year: 2015, TrackNumber: 1, Rating: 255},
+	{Path: "2", Artist: "Tame Impala", Album: "Live Versions", Title: "Elephant", Genre: "Psychedelic", Year: 2014, TrackNumber: 7, Rating: 204},
+	{Path: "3", Artist: "Pond", Album: "Hobo Rocket", Title: "Whatever Happened", Genre: "Psych Rock", Year: 2013, TrackNumber: 2, Rating: 128},
+	{Path: "4", Artist: "Tame Impala", Album: "Innerspeaker", Title: "Alter Ego", Genre: "Psychedelic", Year: 2010, TrackNumber: 2, Rating: 0},
+	{Path: "5", Artist: "King Gizzard", Album: "Nonagon Infinity", Title: "Robot Stop", Genre: "Garage", Year: 2016, TrackNumber: 1, Rating: 153},
+}
+
+func TestParseSearch(t *testing.T) {
+	var tests = []struct {
+		query    string
+		expected []string
+	}{
+		// bare terms
+		{"", []string{"1", "2", "3", "4", "5"}},
+		{"   ", []string{"1", "2", "3", "4", "5"}},
+		{"impala", []string{"1", "2", "4"}},
+		{"HAPPEN", []string{"1", "3"}},
+		{`"robot stop"`, []string{"5"}},
+		{"tame happen", []string{"1"}},
+
+		// text fields
+		{"artist:pond", []string{"3"}},
+		{`artist:"tame impala"`, []string{"1", "2", "4"}},
+		{"artist:impala", []string{"1", "2", "4"}},
+		{"artist=impala", []string{}},
+		{`artist="TAME IMPALA"`, []string{"1", "2", "4"}},
+		{"artist!=pond", []string{"1", "2", "4", "5"}},
+		{"genre:psych", []string{"1", "2", "3", "4"}},
+		{"album_artist:x", []string{}},
+		{"Title:elephant", []string{"2"}},
+
+		// numeric fields
+		{"year:2015", []string{"1"}},
+		{"year>2014", []string{"1", "5"}},
+		{"year>=2014", []string{"1", "2", "5"}},
+		{"year<2013", []string{"4"}},
+		{"year<=2013", []string{"3", "4"}},
+		{"year!=2015", []string{"2", "3", "4", "5"}},
+		{"year:2010..2014", []string{"2", "3", "4"}},
+		{"year:2015..", []string{"1", "5"}},
+		{"year:..2010", []string{"4"}},
+		{"track:1", []string{"1", "5"}},
+
+		// ratings are in stars
+		{"rating:5", []string{"1"}},
+		{"rating>=4", []string{"1", "2"}},
+		{"rating<3", []string{"3", "4"}},
+		{"rating:2.5..3", []string{"3", "5"}},
+		{"rating:0", []string{"4"}},
+
+		// negation
+		{"-album:live", []string{"1", "3", "4", "5"}},
+		{"-impala", []string{"3", "5"}},
+		{"-(artist:pond OR artist:king)", []string{"1", "2", "4"}},
+
+		// or and grouping
+		{"artist:pond OR artist:king", []string{"3", "5"}},
+		{"year:2015 OR year:2016 OR year:2010", []string{"1", "4", "5"}},
+		{"impala year<2015 OR pond", []string{"2", "3", "4"}},
+		{"impala (year<2011 OR year>2014)", []string{"1", "4"}},
+		{"(artist:pond)", []string{"3"}},
+		{"or", []string{}},
+
+		// the example from the docs
+		{`artist:"tame impala" rating>=4 year:2010..2015 genre:psych -album:live`, []string{"1"}},
+	}
+
+	for _, test := range tests {
+		pred, err := library.ParseSearch(test.query, library.SearchOptions{})
+		if !assert.NoError(t, err, test.query) {
+			continue
+		}
+
+		res := library.Query{Where: pred}.Apply(searchTracks)
+		assert.Equal(t, test.expected, paths(res), test.query)
+	}
+}
+
+func TestParseSearchErrors(t *testing.T) {
+	var tests = []struct {
+		query string
+		pos   int
+		msg   string
+	}{
+		{"colour:red", 0, `unknown field "colour"`},
+		{"artist:", 7, `expected a value after "artist:"`},
+		{`artist:"tame`, 7, "unterminated quote"},
+		{"year:abc", 5, "field [year] needs a whole number, got [abc]"},
+		{"year>20.5", 5, "field [year] needs a whole number, got [20.5]"},
+		{"year:..", 5, "range needs at least one end"},
+		{"title:a..b", 6, "ranges are only supported on numeric fields, not [title]"},
+		{"rating>=6", 8, "rating must be 0-5 stars in steps of 0.5, got [6]"},
+		{"rating:4.2", 7, "rating must be 0-5 stars in steps of 0.5, got [4.2]"},
+		{"(artist:pond", 0, "unclosed ("},
+		{"artist:pond)", 11, "unexpected ')'"},
+		{")", 0, "expected a term"},
+		{"pond OR", 7, "expected a term after OR"},
+		{"OR pond", 0, "expected a term before OR"},
+		{"- pond", 1, "expected a term after -"},
+		{"()", 1, "expected a term"},
+	}
+
+	for _, test := range tests {
+		_, err := library.ParseSearch(test.query, library.SearchOptions{})
+		if !assert.Error(t, err, test.query) {
+			continue
+		}
+
+		serr, ok := err.(*library.SearchError)
+		if assert.True(t, ok, test.query) {
+			assert.Equal(t, test.pos, serr.Pos, test.query)
+			assert.Equal(t, test.msg, serr.Msg, test.query)
+		}
+	}
+}
+
+func TestParseSearchOptions(t *testing.T) {
+	// a rating scale where anything rated at all is 5 stars
+	opts := library.SearchOptions{
+		Stars: func(rating uint8) float64 {
+			if rating > 0 {
+				return 5
+			}
+			return 0
+		},
+		DefaultFields: []library.Field{library.FieldGenre},
+	}
+
+	pred, err := library.ParseSearch("rating:5", opts)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"1", "2", "3", "5"}, paths(library.Query{Where: pred}.Apply(searchTracks)))
+	}
+
+	pred, err = library.ParseSearch("garage", opts)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"5"}, paths(library.Query{Where: pred}.Apply(searchTracks)))
+	}
+}
+
+func TestLinearStars(t *testing.T) {
+	var tests = []struct {
+		rating uint8
+		stars  float64
+	}{
+		{0, 0},
+		{25, 0.5},
+		{128, 2.5},
+		{204, 4},
+		{255, 5},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.stars, library.LinearStars(test.rating), test.rating)
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	var tests = []struct {
+		pattern  string
+		text     string
+		expected bool
+	}{
+		{"", "anything", true},
+		{"tame", "Tame Impala", true},
+		{"tmimp", "Tame Impala", true},
+		{"TMIMP", "tame impala", true},
+		{"impt", "Tame Impala", false},
+		{"x", "", false},
+		{"bjrk", "Björk", true},
+		{"björk", "BJÖRK", true},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, library.FuzzyMatch(test.pattern, test.text), "%s in %s", test.pattern, test.text)
+	}
+}
+
+func TestParseSearchFuzzy(t *testing.T) {
+	pred, err := library.ParseSearch("tmimp crnts", library.SearchOptions{Fuzzy: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"1"}, paths(library.Query{Where: pred}.Apply(searchTracks)))
+	}
+
+	// field terms are not fuzzy
+	pred, err = library.ParseSearch("artist:tmimp", library.SearchOptions{Fuzzy: true})
+	if assert.NoError(t, err) {
+		assert.Empty(t, paths(library.Query{Where: pred}.Apply(searchTracks)))
+	}
+}
@@ -0,0 +1,267 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// StoreVersion is the on-disk format version of the store. Version 1 kept
+// ratings as grump's POPM bytes, they are migrated when loaded.
+const StoreVersion = 2
+
+// Store keeps track data grump manages itself, for files that can not hold
+// it (eg: on read-only shelves). Unlike the index it is not a cache, so it is
+// never discarded and entries follow a track when it is retagged or moved.
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]StoreEntry
+	dirty   bool
+}
+
+// StoreEntry is the data stored for a single track
+type StoreEntry struct {
+	PlayCount uint64 `json:",omitempty"`
+
+	// Rating is nil if the track has no stored rating, so that unrating a
+	// track can be told apart from never rating it
+	Rating *uint8 `json:",omitempty"`
+
+	// TagRating is the file's rating when Rating was kept in its place
+	// because the file could not be written
+	TagRating *uint8 `json:",omitempty"`
+
+	// ReplayGain is set by loudness scans of files that can not be tagged
+	ReplayGain *ReplayGain `json:",omitempty"`
+}
+
+// storeFile is the serialized form of a Store
+type storeFile struct {
+	Version int
+	Tracks  map[string]StoreEntry
+}
+
+// NewStore creates an empty store that will be saved to path.
+func NewStore(path string) *Store {
+	return &Store{
+		path:    path,
+		entries: map[string]StoreEntry{},
+	}
+}
+
+// LoadStore reads a store from disk. A missing file yields an empty store,
+// but one that can not be parsed is an error so it is never overwritten.
+func LoadStore(path string) (*Store, error) {
+	s := NewStore(path)
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.WithField("path", path).Debug("no store found, starting fresh")
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read store [%s]: [%s]", path, err.Error())
+	}
+
+	f := storeFile{}
+	err = json.Unmarshal(b, &f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse store [%s]: [%s]", path, err.Error())
+	}
+
+	if f.Version > StoreVersion {
+		return nil, fmt.Errorf("could not load store [%s]: [version %d is newer than %d]", path, f.Version, StoreVersion)
+	}
+
+	if f.Tracks != nil {
+		s.entries = f.Tracks
+	}
+
+	if f.Version < StoreVersion {
+		s.migrate(f.Version)
+	}
+
+	return s, nil
+}
+
+// migrate converts entries written by an older version of the store. They
+// are saved in the new format along with the next change.
+func (s *Store) migrate(version int) {
+	if version < 2 {
+		for id, e := range s.entries {
+			if e.Rating != nil {
+				rating := DefaultRatingProfile.Rating(*e.Rating)
+				e.Rating = &rating
+			}
+			s.entries[id] = e
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"path":    s.path,
+		"version": version,
+	}).Info("migrated store")
+	s.dirty = true
+}
+
+// Save writes the store to disk if it has changed
+func (s *Store) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(storeFile{
+		Version: StoreVersion,
+		Tracks:  s.entries,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0755)
+	if err != nil {
+		return fmt.Errorf("could not create store directory [%s]: [%s]", s.path, err.Error())
+	}
+
+	// write to a temp file first so a crash never loses the store
+	tmp := s.path + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write store [%s]: [%s]", tmp, err.Error())
+	}
+
+	err = os.Rename(tmp, s.path)
+	if err != nil {
+		return fmt.Errorf("could not replace store [%s]: [%s]", s.path, err.Error())
+	}
+
+	s.dirty = false
+	return nil
+}
+
+// Get returns the entry stored for a track
+func (s *Store) Get(track Track) (StoreEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[trackID(track)]
+	return e, ok
+}
+
+// Update changes the entry stored for a track, creating it if needed
+func (s *Store) Update(track Track, update func(e *StoreEntry)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := trackID(track)
+	e := s.entries[id]
+	update(&e)
+
+	if e == (StoreEntry{}) {
+		delete(s.entries, id)
+	} else {
+		s.entries[id] = e
+	}
+	s.dirty = true
+}
+
+// Rekey moves the entry of prev to track, if saving changed its identity
+func (s *Store) Rekey(prev, track Track) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, to := trackID(prev), trackID(track)
+	e, ok := s.entries[from]
+	if !ok || from == to {
+		return
+	}
+
+	delete(s.entries, from)
+	s.entries[to] = e
+	s.dirty = true
+}
+
+// Rating returns the rating stored for a track
+func (s *Store) Rating(track Track) (uint8, bool) {
+	e, ok := s.Get(track)
+	if !ok || e.Rating == nil {
+		return 0, false
+	}
+	return *e.Rating, true
+}
+
+// SetRating stores a rating for a track and saves the store
+func (s *Store) SetRating(track Track, rating uint8) error {
+	s.Update(track, func(e *StoreEntry) {
+		e.Rating = &rating
+		e.TagRating = nil
+	})
+	return s.Save()
+}
+
+// OverrideRating stores a rating in place of tagged, the rating in a file
+// that could not be written, and saves the store
+func (s *Store) OverrideRating(track Track, rating, tagged uint8) error {
+	s.Update(track, func(e *StoreEntry) {
+		e.Rating = &rating
+		e.TagRating = &tagged
+	})
+	return s.Save()
+}
+
+// Overrides checks if the stored rating was kept in place of track's. Once
+// the file is rated something else, eg: by another player, it wins again.
+func (s *Store) Overrides(track Track) bool {
+	e, ok := s.Get(track)
+	return ok && e.Rating != nil && e.TagRating != nil && *e.TagRating == track.Rating
+}
+
+// apply copies stored data onto a freshly loaded track. Play counts only go
+// up, so whichever of the file and the store has counted more wins.
+func (s *Store) apply(track *Track) {
+	e, ok := s.Get(*track)
+	if !ok {
+		return
+	}
+
+	if e.PlayCount > track.PlayCount {
+		track.PlayCount = e.PlayCount
+	}
+
+	// a gain in the file's tags is newer than a stored one
+	if e.ReplayGain != nil && !track.ReplayGain.HasTrack() {
+		track.ReplayGain = *e.ReplayGain
+	}
+}
+
+// trackID identifies a track by its tags so it survives being moved or
+// renamed. Tracks without an artist and title fall back to their path.
+func trackID(track Track) string {
+	artist := track.AlbumArtist
+	if artist == "" {
+		artist = track.Artist
+	}
+
+	if artist == "" || track.Title == "" {
+		return "path:" + indexKey(track.Path)
+	}
+
+	return strings.ToLower(strings.Join([]string{
+		artist,
+		track.Album,
+		strconv.Itoa(track.DiscNumber),
+		strconv.Itoa(track.TrackNumber),
+		track.Title,
+	}, "|"))
+}
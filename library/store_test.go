@@ -0,0 +1,259 @@
+package library_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountPlay(t *testing.T) {
+	var tests = []struct {
+		name     string
+		readOnly bool
+	}{
+		{"writable", false},
+		{"read-only", true},
+	}
+
+	ctx := context.Background()
+	for _, test := range tests {
+		path := writeFLAC(t, nil,
+			flacBlock(0, false, make([]byte, 34)),
+			flacBlock(4, true, vorbisComment("ARTIST=Tame Impala", "TITLE=Let It Happen", "FMPS_PLAYCOUNT=2")),
+		)
+		before, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+
+		storeFile := filepath.Join(t.TempDir(), "store.json")
+		shelf := func() *library.LocalAudioShelf {
+			store, err := library.LoadStore(storeFile)
+			require.NoError(t, err, test.name)
+
+			s, err := library.NewLocalAudioShelf(filepath.Dir(path))
+			require.NoError(t, err, test.name)
+			s.SetReadOnly(test.readOnly)
+			s.SetStore(store)
+			_, err = s.LoadTracks()
+			require.NoError(t, err, test.name)
+			return s
+		}
+
+		s := shelf()
+		track := s.Tracks()[0]
+		assert.Equal(t, uint64(2), track.PlayCount, test.name)
+
+		counted, err := s.CountPlay(ctx, &track)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, uint64(3), counted.PlayCount, test.name)
+		assert.Equal(t, uint64(3), s.Tracks()[0].PlayCount, test.name)
+
+		// the count survives a restart, from the file or the store
+		assert.Equal(t, uint64(3), shelf().Tracks()[0].PlayCount, test.name)
+
+		after, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		if test.readOnly {
+			assert.Equal(t, before, after, test.name)
+		} else {
+			assert.Contains(t, string(after), "FMPS_PLAYCOUNT=3", test.name)
+		}
+	}
+}
+
+func TestSaveStaleTrack(t *testing.T) {
+	ctx := context.Background()
+	path := writeFLAC(t, nil,
+		flacBlock(0, false, make([]byte, 34)),
+		flacBlock(4, true, vorbisComment("ARTIST=Tame Impala", "TITLE=Let It Happen", "FMPS_PLAYCOUNT=2")),
+	)
+
+	s, err := library.NewLocalAudioShelf(filepath.Dir(path))
+	require.NoError(t, err)
+	_, err = s.LoadTracks()
+	require.NoError(t, err)
+
+	// both copies are taken before either is saved
+	stale := s.Tracks()[0]
+	rated := stale
+	rated.Rating = library.StarsRating(4)
+	_, err = s.SaveTrack(ctx, &stale, &rated)
+	require.NoError(t, err)
+
+	// plays counted at once from the stale copy all count, and keep the rating
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.CountPlay(ctx, &stale)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// an edit from the stale copy only changes what was edited
+	titled := stale
+	titled.Title = "Let It Happen (Live)"
+	saved, err := s.SaveTrack(ctx, &stale, &titled)
+	require.NoError(t, err)
+
+	assert.Equal(t, library.StarsRating(4), saved.Rating)
+	assert.Equal(t, uint64(5), saved.PlayCount)
+	assert.Equal(t, "Let It Happen (Live)", saved.Title)
+
+	loaded, err := s.LoadTrack(ctx, path)
+	require.NoError(t, err)
+	assert.Equal(t, *saved, *loaded)
+}
+
+func TestStoreRekey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	store := library.NewStore(path)
+
+	prev := library.Track{Artist: "Tame Impala", Title: "Let It Hapen", Path: "/music/a.flac"}
+	store.Update(prev, func(e *library.StoreEntry) { e.PlayCount = 5 })
+
+	// fixing a typo keeps the count, moving the file does not matter
+	track := prev
+	track.Title = "Let It Happen"
+	store.Rekey(prev, track)
+	require.NoError(t, store.Save())
+
+	loaded, err := library.LoadStore(path)
+	require.NoError(t, err)
+
+	track.Path = "/music/moved.flac"
+	e, ok := loaded.Get(track)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(5), e.PlayCount)
+
+	_, ok = loaded.Get(prev)
+	assert.False(t, ok)
+
+	// a corrupt store is an error rather than silently replaced
+	require.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+	_, err = library.LoadStore(path)
+	assert.Error(t, err)
+}
+
+func TestSaveRating(t *testing.T) {
+	var tests = []struct {
+		name       string
+		comments   []string
+		readOnly   bool
+		precedence library.RatingPrecedence
+		loaded     uint8
+		restarted  uint8
+		written    []string
+	}{
+		{"writable", []string{"RATING=80"}, false, library.RatingTagFirst, 204, 255, []string{"FMPS_RATING=1", "RATING=100"}},
+		{"read-only unrated", nil, true, library.RatingTagFirst, 0, 255, nil},
+		{"read-only tag first", []string{"FMPS_RATING=0.6"}, true, library.RatingTagFirst, 153, 255, nil},
+		{"read-only store first", []string{"FMPS_RATING=0.6"}, true, library.RatingStoreFirst, 153, 255, nil},
+	}
+
+	ctx := context.Background()
+	for _, test := range tests {
+		comments := append([]string{"ARTIST=Tame Impala", "TITLE=Let It Happen"}, test.comments...)
+		path := writeFLAC(t, nil,
+			flacBlock(0, false, make([]byte, 34)),
+			flacBlock(4, true, vorbisComment(comments...)),
+		)
+		before, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+
+		storeFile := filepath.Join(t.TempDir(), "store.json")
+		shelf := func() *library.LocalAudioShelf {
+			store, err := library.LoadStore(storeFile)
+			require.NoError(t, err, test.name)
+
+			s, err := library.NewLocalAudioShelf(filepath.Dir(path))
+			require.NoError(t, err, test.name)
+			s.SetReadOnly(test.readOnly)
+			s.SetStore(store)
+			s.SetRatings(store, test.precedence)
+			_, err = s.LoadTracks()
+			require.NoError(t, err, test.name)
+			return s
+		}
+
+		s := shelf()
+		track := s.Tracks()[0]
+		assert.Equal(t, test.loaded, track.Rating, test.name)
+
+		rated := track
+		rated.Rating = 255
+		saved, err := s.SaveTrack(ctx, &track, &rated)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, uint8(255), saved.Rating, test.name)
+
+		assert.Equal(t, test.restarted, shelf().Tracks()[0].Rating, test.name)
+
+		after, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		if test.readOnly {
+			assert.Equal(t, before, after, test.name)
+		}
+		for _, c := range test.written {
+			assert.Contains(t, string(after), c, test.name)
+		}
+	}
+
+	// only ratings and play counts can be kept outside of a read-only file
+	s, err := library.NewLocalAudioShelf(t.TempDir())
+	require.NoError(t, err)
+	s.SetReadOnly(true)
+	store := library.NewStore(filepath.Join(t.TempDir(), "store.json"))
+	s.SetRatings(store, library.RatingTagFirst)
+
+	prev := library.Track{Artist: "Tame Impala", Title: "Let It Happen", Path: "/music/a.flac"}
+	track := prev
+	track.Title = "Let It Happen (Edit)"
+	track.Rating = 255
+	_, err = s.SaveTrack(ctx, &prev, &track)
+	assert.Equal(t, library.ErrReadOnly, err)
+}
+
+func TestStoreOverridesRating(t *testing.T) {
+	store := library.NewStore(filepath.Join(t.TempDir(), "store.json"))
+	track := library.Track{Artist: "Tame Impala", Title: "Let It Happen", Rating: 153}
+	require.NoError(t, store.OverrideRating(track, 255, track.Rating))
+	assert.True(t, store.Overrides(track))
+
+	// once the file is rated elsewhere its rating wins again
+	rerated := track
+	rerated.Rating = 51
+	assert.False(t, store.Overrides(rerated))
+
+	// a rating kept in step with the file does not override it
+	require.NoError(t, store.SetRating(track, 255))
+	assert.False(t, store.Overrides(track))
+}
+
+func TestStoreMigratesRatings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	track := library.Track{Artist: "Tame Impala", Title: "Let It Happen"}
+
+	// version 1 kept grump's POPM bytes, 1 star was 1 and half a star 13
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"Version": 1, "Tracks": {
+		"tame impala||0|0|let it happen": {"Rating": 1}
+	}}`), 0644))
+
+	store, err := library.LoadStore(path)
+	require.NoError(t, err)
+	rating, ok := store.Rating(track)
+	assert.True(t, ok)
+	assert.Equal(t, library.StarsRating(1), rating)
+
+	// the migrated store is saved in the new format
+	require.NoError(t, store.Save())
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"Version": 2`)
+}
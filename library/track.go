@@ -4,13 +4,19 @@ package library
 type Track struct {
 	Album       string
 	AlbumArtist string
-	Artist      string
-	Comment     string
-	Composer    string
-	DiscNumber  int
-	DiscTotal   int
-	FileType    string
-	Genre       string
+	// AlbumArtistSort, AlbumSort, ArtistSort and TitleSort come from sort
+	// tags (eg: ARTISTSORT, TSOP) and override the order of their field when
+	// sorting, eg: "Beatles, The"
+	AlbumArtistSort string
+	AlbumSort       string
+	Artist          string
+	ArtistSort      string
+	Comment         string
+	Composer        string
+	DiscNumber      int
+	DiscTotal       int
+	FileType        string
+	Genre           string
 
 	// Length is length of track in millis
 	Length      int
@@ -21,9 +27,20 @@ type Track struct {
 	Rating      uint8
 	RatingEmail string
 	Title       string
+	TitleSort   string
 	TrackNumber int
 	TrackTotal  int
 	Year        int
+
+	// ReplayGain is read from REPLAYGAIN_* tags, or set by a loudness scan
+	ReplayGain ReplayGain
+
+	// technical properties read from the stream headers. BitDepth is 0 for
+	// lossy formats, Bitrate is the average in kbps.
+	BitDepth   int
+	Bitrate    int
+	Channels   int
+	SampleRate int
 }
 
 func (t Track) String() string {
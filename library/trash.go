@@ -0,0 +1,370 @@
+package library
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// trashInfoExt is the extension of files describing trashed files
+	trashInfoExt = ".trashinfo"
+
+	// trashDateFormat is how deletion dates are written, in local time
+	trashDateFormat = "2006-01-02T15:04:05"
+
+	// trashSidecarsKey lists the sidecar files trashed with a track. It also
+	// marks the entries grump trashed, as the trash may be shared with other
+	// programs.
+	trashSidecarsKey = "X-Grump-Sidecars"
+)
+
+// ErrNotOnShelf is returned when restoring a track that belongs to another
+// shelf
+var ErrNotOnShelf = errors.New("track is not on this shelf")
+
+// Trash holds deleted files so they can be restored. It uses the
+// freedesktop.org trash layout, so it can be the user's own trash (eg:
+// ~/.local/share/Trash): files/ holds trashed files and info/ a .trashinfo
+// file for each with its original path and when it was deleted.
+type Trash struct {
+	dir string
+}
+
+// TrashEntry is a track in the trash, along with its sidecar files
+type TrashEntry struct {
+	// Name is the file's name in the trash
+	Name string
+
+	// Path is where the file was deleted from
+	Path string
+
+	Deleted  time.Time
+	Sidecars []TrashEntry
+}
+
+// NewTrash creates a trash in dir. Its directories are created when the
+// first file is trashed.
+func NewTrash(dir string) *Trash {
+	return &Trash{dir: dir}
+}
+
+// Dir returns the trash directory
+func (t *Trash) Dir() string {
+	return t.dir
+}
+
+func (t *Trash) filePath(name string) string {
+	return filepath.Join(t.dir, "files", name)
+}
+
+func (t *Trash) infoPath(name string) string {
+	return filepath.Join(t.dir, "info", name+trashInfoExt)
+}
+
+// Put moves a track and its sidecar files into the trash. Sidecars that can
+// not be trashed are logged and left in place.
+func (t *Trash) Put(path string, sidecars []string) (TrashEntry, error) {
+	for _, sub := range []string{"files", "info"} {
+		err := os.MkdirAll(filepath.Join(t.dir, sub), 0700)
+		if err != nil {
+			return TrashEntry{}, fmt.Errorf("could not create trash [%s]: [%s]", t.dir, err.Error())
+		}
+	}
+
+	entry, err := t.put(path)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+
+	for _, s := range sidecars {
+		sidecar, err := t.put(s)
+		if err != nil {
+			log.WithError(err).WithField("path", s).Warn("could not trash sidecar file")
+			continue
+		}
+		entry.Sidecars = append(entry.Sidecars, sidecar)
+	}
+
+	return entry, t.writeInfo(entry, true)
+}
+
+// put moves one file into the trash. Its name is reserved by creating its
+// info file first, as the spec asks, so two programs never pick the same one.
+func (t *Trash) put(path string) (TrashEntry, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return TrashEntry{}, fmt.Errorf("could not trash [%s]: [%s]", path, err.Error())
+	}
+
+	entry := TrashEntry{Path: abs, Deleted: time.Now()}
+	ext := filepath.Ext(abs)
+	base := strings.TrimSuffix(filepath.Base(abs), ext)
+	for n := 1; ; n++ {
+		entry.Name = base + ext
+		if n > 1 {
+			entry.Name = fmt.Sprintf("%s (%d)%s", base, n, ext)
+		}
+
+		f, err := os.OpenFile(t.infoPath(entry.Name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return TrashEntry{}, fmt.Errorf("could not trash [%s]: [%s]", path, err.Error())
+		}
+		f.Close()
+
+		if _, err := os.Lstat(t.filePath(entry.Name)); err == nil {
+			os.Remove(t.infoPath(entry.Name))
+			continue
+		}
+		break
+	}
+
+	err = t.writeInfo(entry, false)
+	if err == nil {
+		err = renameFile(abs, t.filePath(entry.Name))
+	}
+	if err != nil {
+		os.Remove(t.infoPath(entry.Name))
+		return TrashEntry{}, fmt.Errorf("could not trash [%s]: [%s]", path, err.Error())
+	}
+
+	return entry, nil
+}
+
+// writeInfo writes the .trashinfo file of an entry. Track entries list their
+// sidecars.
+func (t *Trash) writeInfo(entry TrashEntry, track bool) error {
+	s := strings.Builder{}
+	s.WriteString("[Trash Info]\n")
+	s.WriteString("Path=" + (&url.URL{Path: entry.Path}).EscapedPath() + "\n")
+	s.WriteString("DeletionDate=" + entry.Deleted.Local().Format(trashDateFormat) + "\n")
+
+	if track {
+		names := []string{}
+		for _, sidecar := range entry.Sidecars {
+			names = append(names, url.PathEscape(sidecar.Name))
+		}
+		s.WriteString(trashSidecarsKey + "=" + strings.Join(names, ";") + "\n")
+	}
+
+	err := ioutil.WriteFile(t.infoPath(entry.Name), []byte(s.String()), 0600)
+	if err != nil {
+		return fmt.Errorf("could not write trash info [%s]: [%s]", entry.Name, err.Error())
+	}
+	return nil
+}
+
+// readInfo reads the .trashinfo file of name. track is true if grump trashed
+// it as a track, and sidecars names its sidecar files.
+func (t *Trash) readInfo(name string) (entry TrashEntry, track bool, sidecars []string, err error) {
+	f, err := os.Open(t.infoPath(name))
+	if err != nil {
+		return entry, false, nil, err
+	}
+	defer f.Close()
+
+	entry.Name = name
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "Path":
+			entry.Path, err = url.PathUnescape(value)
+			if err != nil {
+				return entry, false, nil, fmt.Errorf("could not read trash info [%s]: [%s]", name, err.Error())
+			}
+		case "DeletionDate":
+			entry.Deleted, _ = time.ParseInLocation(trashDateFormat, value, time.Local)
+		case trashSidecarsKey:
+			track = true
+			for _, s := range strings.Split(value, ";") {
+				if s, err := url.PathUnescape(s); err == nil && s != "" {
+					sidecars = append(sidecars, s)
+				}
+			}
+		}
+	}
+
+	if entry.Path == "" {
+		return entry, false, nil, fmt.Errorf("could not read trash info [%s]: [no path]", name)
+	}
+
+	return entry, track, sidecars, scanner.Err()
+}
+
+// Entries returns the tracks grump has trashed, newest first. Files other
+// programs put in the trash are left out.
+func (t *Trash) Entries() ([]TrashEntry, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(t.dir, "info"))
+	if os.IsNotExist(err) {
+		return []TrashEntry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read trash [%s]: [%s]", t.dir, err.Error())
+	}
+
+	entries := []TrashEntry{}
+	for _, info := range infos {
+		name := strings.TrimSuffix(info.Name(), trashInfoExt)
+		if name == info.Name() {
+			continue
+		}
+
+		entry, track, sidecars, err := t.readInfo(name)
+		if err != nil {
+			log.WithError(err).WithField("name", name).Debug("could not read trash entry")
+			continue
+		}
+		if !track {
+			continue
+		}
+
+		for _, s := range sidecars {
+			sidecar, _, _, err := t.readInfo(s)
+			if err != nil {
+				log.WithError(err).WithField("name", s).Debug("could not read trashed sidecar")
+				continue
+			}
+			entry.Sidecars = append(entry.Sidecars, sidecar)
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Deleted.After(entries[j].Deleted) })
+	return entries, nil
+}
+
+// Latest returns the most recently trashed entry that was deleted from path
+func (t *Trash) Latest(path string) (TrashEntry, bool, error) {
+	entries, err := t.Entries()
+	if err != nil {
+		return TrashEntry{}, false, err
+	}
+
+	for _, entry := range entries {
+		if entry.Path == path {
+			return entry, true, nil
+		}
+	}
+	return TrashEntry{}, false, nil
+}
+
+// Restore moves a track and its sidecars back to where they were deleted
+// from. Existing files are never overwritten.
+func (t *Trash) Restore(entry TrashEntry) error {
+	err := t.restore(entry)
+	if err != nil {
+		return err
+	}
+
+	for _, sidecar := range entry.Sidecars {
+		err := t.restore(sidecar)
+		if err != nil {
+			log.WithError(err).WithField("path", sidecar.Path).Warn("could not restore sidecar file")
+		}
+	}
+
+	return nil
+}
+
+func (t *Trash) restore(entry TrashEntry) error {
+	if _, err := os.Lstat(entry.Path); err == nil {
+		return fmt.Errorf("could not restore [%s]: [file already exists]", entry.Path)
+	}
+
+	err := os.MkdirAll(filepath.Dir(entry.Path), 0755)
+	if err != nil {
+		return fmt.Errorf("could not restore [%s]: [%s]", entry.Path, err.Error())
+	}
+
+	err = renameFile(t.filePath(entry.Name), entry.Path)
+	if err != nil {
+		return fmt.Errorf("could not restore [%s]: [%s]", entry.Path, err.Error())
+	}
+
+	return os.Remove(t.infoPath(entry.Name))
+}
+
+// Purge deletes a track and its sidecars from the trash for good
+func (t *Trash) Purge(entry TrashEntry) error {
+	for _, e := range append([]TrashEntry{entry}, entry.Sidecars...) {
+		err := os.RemoveAll(t.filePath(e.Name))
+		if err != nil {
+			return fmt.Errorf("could not purge [%s]: [%s]", e.Name, err.Error())
+		}
+
+		err = os.Remove(t.infoPath(e.Name))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not purge [%s]: [%s]", e.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// renameFile moves a file, copying it when from and to are on different
+// filesystems
+func renameFile(from, to string) error {
+	err := os.Rename(from, to)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	err = copyFile(from, to)
+	if err != nil {
+		os.Remove(to)
+		return err
+	}
+
+	return os.Remove(from)
+}
+
+// copyFile copies a file's contents, mode and modification time
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(to, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,76 @@
+package library_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrash(t *testing.T) {
+	ctx := context.Background()
+	shelf, dir := newTestShelf(t, "a/one.wav", "a/one.lrc", "a/cover.jpg", "b/two.wav", "b/three.wav", "b/cover.jpg")
+	trash := library.NewTrash(filepath.Join(t.TempDir(), "Trash"))
+	shelf.SetTrash(trash, true)
+
+	db, err := library.NewLibrary([]library.AudioShelf{shelf})
+	require.NoError(t, err)
+	_, err = db.LoadTracks()
+	require.NoError(t, err)
+
+	// files other programs trashed are left alone
+	require.NoError(t, os.MkdirAll(filepath.Join(trash.Dir(), "info"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(trash.Dir(), "info", "other.txt.trashinfo"),
+		[]byte("[Trash Info]\nPath=/home/other.txt\nDeletionDate=2020-01-02T03:04:05\n"), 0600))
+
+	// the last track of an album takes its sidecars and directory with it
+	one := library.Track{Path: filepath.Join(dir, "a", "one.wav")}
+	require.NoError(t, db.DeleteTrack(ctx, &one))
+	_, err = os.Stat(filepath.Join(dir, "a"))
+	assert.True(t, os.IsNotExist(err))
+
+	// other tracks keep the album's cover
+	two := library.Track{Path: filepath.Join(dir, "b", "two.wav")}
+	require.NoError(t, db.DeleteTrack(ctx, &two))
+	assert.FileExists(t, filepath.Join(dir, "b", "cover.jpg"))
+	assert.Len(t, db.Tracks(), 1)
+
+	entries, err := trash.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	latest, ok, err := trash.Latest(one.Path)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Len(t, latest.Sidecars, 2)
+
+	restored, err := db.RestoreTrack(ctx, latest)
+	require.NoError(t, err)
+	assert.Equal(t, one.Path, restored.Path)
+	assert.FileExists(t, filepath.Join(dir, "a", "one.lrc"))
+	assert.FileExists(t, filepath.Join(dir, "a", "cover.jpg"))
+	assert.Len(t, db.Tracks(), 2)
+
+	// restored tracks can be deleted again
+	require.NoError(t, db.DeleteTrack(ctx, restored))
+
+	// a restore never overwrites
+	latest, _, err = trash.Latest(two.Path)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(two.Path, []byte("new"), 0644))
+	_, err = db.RestoreTrack(ctx, latest)
+	assert.Error(t, err)
+
+	require.NoError(t, trash.Purge(latest))
+
+	entries, err = trash.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, one.Path, entries[0].Path)
+	assert.FileExists(t, filepath.Join(trash.Dir(), "info", "other.txt.trashinfo"))
+}
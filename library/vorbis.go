@@ -0,0 +1,388 @@
+package library
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// vorbisVendor is used when a file has no comment block yet
+	vorbisVendor = "grump"
+
+	// vorbisRatingKey holds the rating as 0.0 - 1.0, see
+	// https://www.freedesktop.org/wiki/Specifications/free-media-player-specs/
+	vorbisRatingKey = "FMPS_RATING"
+
+	// vorbisScoreKey is an older rating comment without an agreed scale,
+	// either 0 - 5 stars or 0 - 100
+	vorbisScoreKey = "RATING"
+
+	// vorbisPlayCountKey holds the number of plays, from the same spec
+	vorbisPlayCountKey = "FMPS_PLAYCOUNT"
+)
+
+// vorbisComments is a vorbis comment block as used by FLAC and Ogg Vorbis.
+// Comments keep their original order and case.
+type vorbisComments struct {
+	vendor   string
+	comments []string
+}
+
+// decodeVorbisComments parses a vorbis comment block. Anything after the last
+// comment (eg: the ogg framing bit) is ignored.
+func decodeVorbisComments(b []byte) (*vorbisComments, error) {
+	r := bytes.NewReader(b)
+
+	vendor, err := readVorbisString(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not read vorbis vendor: [%s]", err.Error())
+	}
+
+	var count uint32
+	err = binary.Read(r, binary.LittleEndian, &count)
+	if err != nil {
+		return nil, fmt.Errorf("could not read vorbis comment count: [%s]", err.Error())
+	}
+
+	vc := &vorbisComments{vendor: vendor}
+	for i := uint32(0); i < count; i++ {
+		c, err := readVorbisString(r)
+		if err != nil {
+			return nil, fmt.Errorf("could not read vorbis comment %d: [%s]", i, err.Error())
+		}
+		vc.comments = append(vc.comments, c)
+	}
+
+	return vc, nil
+}
+
+func readVorbisString(r *bytes.Reader) (string, error) {
+	var n uint32
+	err := binary.Read(r, binary.LittleEndian, &n)
+	if err != nil {
+		return "", err
+	}
+
+	if int64(n) > int64(r.Len()) {
+		return "", errors.New("length exceeds block")
+	}
+
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return string(b), err
+}
+
+// encode serializes the comment block
+func (vc *vorbisComments) encode() []byte {
+	buf := &bytes.Buffer{}
+	writeVorbisString(buf, vc.vendor)
+	binary.Write(buf, binary.LittleEndian, uint32(len(vc.comments)))
+	for _, c := range vc.comments {
+		writeVorbisString(buf, c)
+	}
+
+	return buf.Bytes()
+}
+
+func writeVorbisString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+	buf.WriteString(s)
+}
+
+// get returns the first value of a field, ignoring case
+func (vc *vorbisComments) get(key string) string {
+	for _, c := range vc.comments {
+		k, v := splitVorbisComment(c)
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// set replaces every value of a field, and any aliases of it, with value. An
+// empty value removes the field.
+func (vc *vorbisComments) set(key, value string, aliases ...string) {
+	drop := append([]string{key}, aliases...)
+
+	// keep the position of the first existing value so files diff nicely
+	pos := -1
+	kept := vc.comments[:0]
+	for _, c := range vc.comments {
+		k, _ := splitVorbisComment(c)
+		if containsFold(drop, k) {
+			if pos < 0 {
+				pos = len(kept)
+			}
+			continue
+		}
+		kept = append(kept, c)
+	}
+	vc.comments = kept
+
+	if value == "" {
+		return
+	}
+
+	c := strings.ToUpper(key) + "=" + value
+	if pos < 0 {
+		vc.comments = append(vc.comments, c)
+		return
+	}
+
+	vc.comments = append(vc.comments[:pos], append([]string{c}, vc.comments[pos:]...)...)
+}
+
+// setNumber sets a numeric field, removing it when n is 0
+func (vc *vorbisComments) setNumber(key string, n int, aliases ...string) {
+	value := ""
+	if n > 0 {
+		value = strconv.Itoa(n)
+	}
+	vc.set(key, value, aliases...)
+}
+
+// setTrack copies track metadata into the comments. Fields grump does not
+// know about are left alone, and so are fields whose value did not change, so
+// they keep the form they were written in (eg: TRACKNUMBER=3/12).
+func (vc *vorbisComments) setTrack(track *Track) {
+	cur := vorbisTrack(vc.get)
+
+	setText := func(key, cur, value string, aliases ...string) {
+		if cur != value {
+			vc.set(key, value, aliases...)
+		}
+	}
+
+	setText("TITLE", cur.Title, track.Title)
+	setText("ARTIST", cur.Artist, track.Artist)
+	setText("ALBUM", cur.Album, track.Album)
+	setText("ALBUMARTIST", cur.AlbumArtist, track.AlbumArtist, "ALBUM ARTIST")
+	setText("COMPOSER", cur.Composer, track.Composer)
+	setText("GENRE", cur.Genre, track.Genre)
+	setText("COMMENT", cur.Comment, track.Comment, "DESCRIPTION")
+	setText("LYRICS", cur.Lyrics, track.Lyrics)
+
+	// a number and its total are written together, as the total may be part
+	// of the number
+	if cur.TrackNumber != track.TrackNumber || cur.TrackTotal != track.TrackTotal {
+		vc.setNumber("TRACKNUMBER", track.TrackNumber)
+		vc.setNumber("TRACKTOTAL", track.TrackTotal, "TOTALTRACKS")
+	}
+
+	if cur.DiscNumber != track.DiscNumber || cur.DiscTotal != track.DiscTotal {
+		vc.setNumber("DISCNUMBER", track.DiscNumber)
+		vc.setNumber("DISCTOTAL", track.DiscTotal, "TOTALDISCS")
+	}
+
+	// a full date (eg: 2015-07-17) is kept unless the year changed
+	if cur.Year != track.Year {
+		vc.setNumber("DATE", track.Year, "YEAR")
+	}
+
+	raw := vc.raw()
+	if vorbisRating(raw) != track.Rating {
+		vc.set(vorbisRatingKey, formatFMPSRating(track.Rating))
+
+		// other players would misread a RATING in the wrong scale, so only
+		// one that is already there is kept up to date, in the scale it uses
+		if old := vc.get(vorbisScoreKey); old != "" {
+			vc.set(vorbisScoreKey, formatVorbisScore(track.Rating, old))
+		}
+	}
+
+	if vorbisPlayCount(raw) != track.PlayCount {
+		playCount := ""
+		if track.PlayCount > 0 {
+			playCount = strconv.FormatUint(track.PlayCount, 10)
+		}
+		vc.set(vorbisPlayCountKey, playCount)
+	}
+
+	if vorbisReplayGain(raw) != track.ReplayGain {
+		vc.setReplayGain(track.ReplayGain)
+	}
+}
+
+// raw returns the first value of each field by lowercase name, like the raw
+// comments of the tag package
+func (vc *vorbisComments) raw() map[string]interface{} {
+	raw := map[string]interface{}{}
+	for _, c := range vc.comments {
+		k, v := splitVorbisComment(c)
+		k = strings.ToLower(k)
+		if _, ok := raw[k]; !ok {
+			raw[k] = v
+		}
+	}
+	return raw
+}
+
+// vorbisTrack reads the track fields grump writes from comments, using get
+// to look up a field by name. Common aliases and forms other taggers write
+// are understood too, eg: TRACKNUMBER=3/12 or ALBUM ARTIST.
+func vorbisTrack(get func(key string) string) Track {
+	track := Track{
+		Title:       get("TITLE"),
+		Artist:      get("ARTIST"),
+		Album:       get("ALBUM"),
+		AlbumArtist: firstValue(get("ALBUMARTIST"), get("ALBUM ARTIST")),
+		Composer:    get("COMPOSER"),
+		Genre:       get("GENRE"),
+		Comment:     firstValue(get("COMMENT"), get("DESCRIPTION")),
+		Lyrics:      get("LYRICS"),
+		Year:        vorbisYear(firstValue(get("DATE"), get("YEAR"))),
+	}
+
+	track.TrackNumber, track.TrackTotal = vorbisNumber(get("TRACKNUMBER"), get("TRACKTOTAL"), get("TOTALTRACKS"))
+	track.DiscNumber, track.DiscTotal = vorbisNumber(get("DISCNUMBER"), get("DISCTOTAL"), get("TOTALDISCS"))
+	return track
+}
+
+// firstValue returns the first value that is not empty
+func firstValue(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// vorbisNumber parses a number that may hold its total (eg: 3/12). A total
+// in its own field wins.
+func vorbisNumber(value string, totals ...string) (int, int) {
+	parts := strings.SplitN(value, "/", 2)
+	n, _ := strconv.Atoi(strings.TrimSpace(parts[0]))
+
+	total := 0
+	if len(parts) == 2 {
+		total, _ = strconv.Atoi(strings.TrimSpace(parts[1]))
+	}
+
+	for _, t := range totals {
+		if v, err := strconv.Atoi(strings.TrimSpace(t)); err == nil && v > 0 {
+			total = v
+			break
+		}
+	}
+
+	return n, total
+}
+
+// vorbisYear reads the year from the start of a date, eg: 2015-07-17T10:00
+func vorbisYear(date string) int {
+	date = strings.TrimSpace(date)
+	if len(date) < 4 {
+		return 0
+	}
+
+	year, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0
+	}
+	return year
+}
+
+// vorbisRating converts a raw FMPS_RATING value to a track rating, falling
+// back to RATING
+func vorbisRating(raw map[string]interface{}) uint8 {
+	v := rawString(raw, strings.ToLower(vorbisRatingKey))
+	if v == "" {
+		return parseVorbisScore(rawString(raw, strings.ToLower(vorbisScoreKey)))
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 {
+		return 0
+	}
+
+	// FMPS_RATING is 0 - 1 over five stars, eg: 0.1 is half a star
+	return StarsRating(math.Max(math.Round(math.Min(f, 1)*10)/2, 0.5))
+}
+
+// formatFMPSRating converts a track rating to an FMPS_RATING value through
+// its star score, eg: 3 stars is 0.6. Unrated tracks have none.
+func formatFMPSRating(rating uint8) string {
+	if rating == 0 {
+		return ""
+	}
+
+	// a rating too low to show as half a star is still rated
+	stars := math.Max(LinearStars(rating), 0.5)
+	return strconv.FormatFloat(stars/5, 'f', -1, 64)
+}
+
+// vorbisScoreScale guesses the maximum of a RATING value
+func vorbisScoreScale(f float64) float64 {
+	if f <= 5 {
+		return 5
+	}
+	return 100
+}
+
+// parseVorbisScore converts a RATING value to a track rating
+func parseVorbisScore(v string) uint8 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || f < 0 {
+		return 0
+	}
+
+	scale := vorbisScoreScale(f)
+	return uint8(math.Round(math.Min(f/scale, 1) * math.MaxUint8))
+}
+
+// formatVorbisScore converts a track rating to a RATING value in the same
+// scale as old. Unrating removes it.
+func formatVorbisScore(rating uint8, old string) string {
+	if rating == 0 {
+		return ""
+	}
+
+	scale := 100.0
+	if f, err := strconv.ParseFloat(strings.TrimSpace(old), 64); err == nil {
+		scale = vorbisScoreScale(f)
+	}
+
+	return strconv.Itoa(int(math.Round(float64(rating) / math.MaxUint8 * scale)))
+}
+
+// vorbisPlayCount converts a raw FMPS_PLAYCOUNT value to a play count. The
+// spec allows fractional counts, which are rounded down.
+func vorbisPlayCount(raw map[string]interface{}) uint64 {
+	v := rawString(raw, strings.ToLower(vorbisPlayCountKey))
+	if v == "" {
+		return 0
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return 0
+	}
+
+	return uint64(f)
+}
+
+func splitVorbisComment(c string) (string, string) {
+	kv := strings.SplitN(c, "=", 2)
+	if len(kv) != 2 {
+		return kv[0], ""
+	}
+	return kv[0], kv[1]
+}
+
+func containsFold(s []string, x string) bool {
+	for _, y := range s {
+		if strings.EqualFold(x, y) {
+			return true
+		}
+	}
+	return false
+}
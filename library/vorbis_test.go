@@ -0,0 +1,386 @@
+package library_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dhowden/tag"
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var savedTrack = library.Track{
+	Title:       "Let It Happen",
+	Artist:      "Tame Impala",
+	Album:       "Currents",
+	AlbumArtist: "Tame Impala",
+	Composer:    "Kevin Parker",
+	Genre:       "Psychedelic",
+	Comment:     "great",
+	TrackNumber: 1,
+	TrackTotal:  13,
+	DiscNumber:  1,
+	DiscTotal:   1,
+	Year:        2015,
+	Rating:      204,
+	PlayCount:   7,
+	ReplayGain:  library.ReplayGain{TrackGain: -6.5, TrackPeak: 0.988312, AlbumGain: -7.25, AlbumPeak: 1},
+}
+
+// vorbisComment builds a vorbis comment block
+func vorbisComment(comments ...string) []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, uint32(len("test")))
+	buf.WriteString("test")
+	binary.Write(buf, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		binary.Write(buf, binary.LittleEndian, uint32(len(c)))
+		buf.WriteString(c)
+	}
+	return buf.Bytes()
+}
+
+func flacBlock(kind byte, last bool, data []byte) []byte {
+	if last {
+		kind |= 0x80
+	}
+	n := len(data)
+	return append([]byte{kind, byte(n >> 16), byte(n >> 8), byte(n)}, data...)
+}
+
+func flacPicture() []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, uint32(3)) // front cover
+	binary.Write(buf, binary.BigEndian, uint32(len("image/png")))
+	buf.WriteString("image/png")
+	binary.Write(buf, binary.BigEndian, uint32(0))
+	binary.Write(buf, binary.BigEndian, [4]uint32{1, 1, 24, 0})
+	binary.Write(buf, binary.BigEndian, uint32(4))
+	buf.WriteString("\x89PNG")
+	return buf.Bytes()
+}
+
+// writeFLAC creates a FLAC file with the given metadata blocks followed by
+// fake audio frames
+func writeFLAC(t *testing.T, audio []byte, blocks ...[]byte) string {
+	b := []byte("fLaC")
+	for _, block := range blocks {
+		b = append(b, block...)
+	}
+	b = append(b, audio...)
+
+	path := filepath.Join(t.TempDir(), "track.flac")
+	require.NoError(t, ioutil.WriteFile(path, b, 0644))
+	return path
+}
+
+func saveAndLoad(t *testing.T, path string) *library.Track {
+	track := savedTrack
+	track.Path = path
+
+	h := &library.TagHandler{}
+	saved, err := h.Save(context.Background(), &track)
+	require.NoError(t, err)
+	require.NotNil(t, saved)
+
+	loaded, err := h.Load(context.Background(), path)
+	require.NoError(t, err)
+	return loaded
+}
+
+func assertSaved(t *testing.T, path string, loaded *library.Track) {
+	expected := savedTrack
+	expected.Path = path
+	expected.FileType = loaded.FileType
+	assert.Equal(t, expected, *loaded)
+}
+
+func TestSaveFLAC(t *testing.T) {
+	audio := bytes.Repeat([]byte{0xff, 0xf8, 0x01, 0x02}, 1000)
+	streamInfo := make([]byte, 34)
+
+	var tests = []struct {
+		name    string
+		blocks  [][]byte
+		inPlace bool
+	}{
+		{"padding", [][]byte{
+			flacBlock(0, false, streamInfo),
+			flacBlock(4, false, vorbisComment("TITLE=Old", "CUSTOM=keep me", "TOTALTRACKS=99", "DATE=2015-07-17")),
+			flacBlock(6, false, flacPicture()),
+			flacBlock(1, true, make([]byte, 1024)),
+		}, true},
+		{"no comments or padding", [][]byte{
+			flacBlock(0, false, streamInfo),
+			flacBlock(6, true, flacPicture()),
+		}, false},
+	}
+
+	for _, test := range tests {
+		path := writeFLAC(t, audio, test.blocks...)
+		before, err := os.Stat(path)
+		require.NoError(t, err)
+
+		loaded := saveAndLoad(t, path)
+		assertSaved(t, path, loaded)
+
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		assert.True(t, bytes.HasSuffix(b, audio), "%s: audio frames changed", test.name)
+
+		if test.inPlace {
+			assert.Equal(t, before.Size(), int64(len(b)), "%s: file was resized", test.name)
+		}
+
+		m, err := tag.ReadFrom(bytes.NewReader(b))
+		require.NoError(t, err)
+		if assert.NotNil(t, m.Picture(), test.name) {
+			assert.Equal(t, []byte("\x89PNG"), m.Picture().Data, test.name)
+		}
+
+		if test.inPlace {
+			raw := m.Raw()
+			assert.Equal(t, "keep me", raw["custom"], test.name)
+			assert.Equal(t, "2015-07-17", raw["date"], test.name)
+			assert.Nil(t, raw["totaltracks"], test.name)
+		}
+	}
+}
+
+// otherTaggerComments are written the way other taggers commonly do
+var otherTaggerComments = []string{
+	"TITLE=Let It Happen",
+	"ARTIST=Tame Impala",
+	"ALBUM ARTIST=Tame Impala",
+	"TRACKNUMBER=3/12",
+	"DISCNUMBER=1",
+	"TOTALDISCS=2",
+	"DATE=2015-07-17T10:00:00",
+	"DESCRIPTION=great",
+	"FMPS_RATING=0.55",
+}
+
+func TestSaveKeepsOtherTaggerComments(t *testing.T) {
+	path := writeFLAC(t, nil,
+		flacBlock(0, false, make([]byte, 34)),
+		flacBlock(4, true, vorbisComment(otherTaggerComments...)),
+	)
+
+	s, err := library.NewLocalAudioShelf(filepath.Dir(path))
+	require.NoError(t, err)
+	_, err = s.LoadTracks()
+	require.NoError(t, err)
+
+	track := s.Tracks()[0]
+	assert.Equal(t, "Tame Impala", track.AlbumArtist)
+	assert.Equal(t, []int{3, 12, 1, 2}, []int{track.TrackNumber, track.TrackTotal, track.DiscNumber, track.DiscTotal})
+	assert.Equal(t, 2015, track.Year)
+	assert.Equal(t, "great", track.Comment)
+
+	// counting a play leaves every other comment as it was
+	played := track
+	played.PlayCount = 1
+	_, err = s.SaveTrack(context.Background(), &track, &played)
+	require.NoError(t, err)
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	for _, c := range otherTaggerComments {
+		assert.Contains(t, string(b), c)
+	}
+	assert.Contains(t, string(b), "FMPS_PLAYCOUNT=1")
+}
+
+func TestFMPSRating(t *testing.T) {
+	var tests = []struct {
+		stars float64
+		fmps  string
+	}{
+		{0, ""},
+		{0.5, "0.1"},
+		{1, "0.2"},
+		{1.5, "0.3"},
+		{2, "0.4"},
+		{2.5, "0.5"},
+		{3, "0.6"},
+		{3.5, "0.7"},
+		{4, "0.8"},
+		{4.5, "0.9"},
+		{5, "1"},
+	}
+
+	for _, test := range tests {
+		path := writeFLAC(t, nil,
+			flacBlock(0, false, make([]byte, 34)),
+			flacBlock(4, true, vorbisComment("TITLE=Old")),
+		)
+
+		track := library.Track{Path: path, Rating: library.StarsRating(test.stars)}
+		h := &library.TagHandler{}
+		_, err := h.Save(context.Background(), &track)
+		require.NoError(t, err)
+
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		m, err := tag.ReadFrom(bytes.NewReader(b))
+		require.NoError(t, err)
+		fmps, _ := m.Raw()["fmps_rating"].(string)
+		assert.Equal(t, test.fmps, fmps, "%g stars", test.stars)
+
+		loaded, err := h.Load(context.Background(), path)
+		require.NoError(t, err)
+		assert.Equal(t, track.Rating, loaded.Rating, "%g stars", test.stars)
+	}
+}
+
+// oggCRC is a bit-at-a-time ogg checksum, independent of the one under test
+func oggCRC(b []byte) uint32 {
+	var crc uint32
+	for _, c := range b {
+		crc ^= uint32(c) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+type oggPage struct {
+	flags    byte
+	granule  uint64
+	sequence uint32
+	segments []byte
+	data     []byte
+}
+
+func (p oggPage) encode() []byte {
+	b := make([]byte, 27)
+	copy(b, "OggS")
+	b[5] = p.flags
+	binary.LittleEndian.PutUint64(b[6:14], p.granule)
+	binary.LittleEndian.PutUint32(b[14:18], 1234)
+	binary.LittleEndian.PutUint32(b[18:22], p.sequence)
+	b[26] = byte(len(p.segments))
+	b = append(b, p.segments...)
+	b = append(b, p.data...)
+	binary.LittleEndian.PutUint32(b[22:26], oggCRC(b))
+	return b
+}
+
+// lacing returns the lacing values for a packet
+func lacing(n int) []byte {
+	l := bytes.Repeat([]byte{255}, n/255)
+	return append(l, byte(n%255))
+}
+
+// readOggPages parses a whole ogg file, checking every checksum
+func readOggPages(t *testing.T, b []byte) []oggPage {
+	pages := []oggPage{}
+	for len(b) > 0 {
+		require.Equal(t, "OggS", string(b[:4]))
+		n := int(b[26])
+		p := oggPage{flags: b[5], sequence: binary.LittleEndian.Uint32(b[18:22]), segments: b[27 : 27+n]}
+		size := 0
+		for _, s := range p.segments {
+			size += int(s)
+		}
+		end := 27 + n + size
+		p.data = b[27+n : end]
+
+		page := append([]byte{}, b[:end]...)
+		crc := binary.LittleEndian.Uint32(page[22:26])
+		binary.LittleEndian.PutUint32(page[22:26], 0)
+		assert.Equal(t, oggCRC(page), crc, "bad checksum on page %d", p.sequence)
+
+		pages = append(pages, p)
+		b = b[end:]
+	}
+	return pages
+}
+
+func TestSaveOgg(t *testing.T) {
+	ident := append([]byte("\x01vorbis"), make([]byte, 23)...)
+	comment := append(append([]byte("\x03vorbis"), vorbisComment("TITLE=Old", "CUSTOM=keep me")...), 1)
+	setup := append([]byte("\x05vorbis"), bytes.Repeat([]byte{0xaa}, 300)...)
+
+	// comment and setup headers share a page
+	headers := append(append([]byte{}, comment...), setup...)
+	audio := [][]byte{bytes.Repeat([]byte{1}, 100), bytes.Repeat([]byte{2}, 100)}
+
+	pages := []oggPage{
+		{flags: 0x02, sequence: 0, segments: lacing(len(ident)), data: ident},
+		{sequence: 1, segments: append(lacing(len(comment)), lacing(len(setup))...), data: headers},
+		{sequence: 2, segments: lacing(len(audio[0])), data: audio[0]},
+		{flags: 0x04, sequence: 3, segments: lacing(len(audio[1])), data: audio[1]},
+	}
+
+	b := []byte{}
+	for _, p := range pages {
+		b = append(b, p.encode()...)
+	}
+
+	path := filepath.Join(t.TempDir(), "track.ogg")
+	require.NoError(t, ioutil.WriteFile(path, b, 0644))
+
+	loaded := saveAndLoad(t, path)
+	assertSaved(t, path, loaded)
+
+	// lyrics long enough to push the headers over several pages
+	track := *loaded
+	track.Lyrics = strings.Repeat("la ", 40000)
+	_, err := (&library.TagHandler{}).Save(context.Background(), &track)
+	require.NoError(t, err)
+
+	loaded, err = (&library.TagHandler{}).Load(context.Background(), path)
+	require.NoError(t, err)
+	assert.Equal(t, track.Lyrics, loaded.Lyrics)
+	assert.Equal(t, "Let It Happen", loaded.Title)
+
+	b, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	written := readOggPages(t, b)
+	require.True(t, len(written) > len(pages))
+
+	for i, p := range written {
+		assert.Equal(t, uint32(i), p.sequence)
+	}
+
+	// audio pages are untouched apart from their sequence number
+	last := written[len(written)-2:]
+	assert.Equal(t, audio[0], last[0].data)
+	assert.Equal(t, audio[1], last[1].data)
+	assert.Equal(t, byte(0x04), last[1].flags)
+
+	// the setup header ends the header pages
+	headerData := []byte{}
+	for _, p := range written[1 : len(written)-2] {
+		headerData = append(headerData, p.data...)
+	}
+	assert.True(t, bytes.HasSuffix(headerData, setup))
+
+	m, err := tag.ReadFrom(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, "keep me", m.Raw()["custom"])
+}
+
+func TestSaveUnsupported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.m4a")
+	require.NoError(t, ioutil.WriteFile(path, []byte("ftyp"), 0644))
+
+	s, err := library.NewLocalAudioShelf(filepath.Dir(path))
+	require.NoError(t, err)
+
+	_, err = s.SaveTrack(context.Background(), nil, &library.Track{Path: path})
+	assert.Error(t, err)
+}
@@ -0,0 +1,231 @@
+package library
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// watchSettle is how long a file must go without being written to before
+	// it is (re)loaded. Copying an album produces a burst of writes per file,
+	// and we only want to read tags once the copy has finished.
+	watchSettle = 1 * time.Second
+)
+
+// Watch watches the shelf directory tree for supported files being added,
+// removed or changed, and keeps the shelf's tracks up to date.
+func (l *LocalAudioShelf) Watch(ctx context.Context) (<-chan TrackEvent, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.watchDir(w, l.directory)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	events := make(chan TrackEvent)
+	go l.watch(ctx, w, events)
+
+	return events, nil
+}
+
+// watchDir adds a watch for dir and every directory beneath it
+func (l *LocalAudioShelf) watchDir(w *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.WithError(err).WithField("path", path).Warn("could not walk path to watch")
+			return nil
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if path != l.directory && l.Excluded(path) {
+			return filepath.SkipDir
+		}
+
+		log.WithField("path", path).Trace("watching directory")
+		err = w.Add(path)
+		if err != nil {
+			log.WithError(err).WithField("path", path).Warn("could not watch directory")
+		}
+
+		return nil
+	})
+}
+
+// watch is the event loop for Watch
+func (l *LocalAudioShelf) watch(ctx context.Context, w *fsnotify.Watcher, events chan<- TrackEvent) {
+	defer close(events)
+	defer w.Close()
+
+	// paths waiting for writes to settle before they are loaded
+	pending := map[string]time.Time{}
+
+	ticker := time.NewTicker(watchSettle / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debug("stopped watching shelf")
+			return
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			log.WithError(err).Warn("error watching shelf")
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			l.handleFSEvent(ctx, w, ev, pending, events)
+		case now := <-ticker.C:
+			for path, at := range pending {
+				if now.Sub(at) < watchSettle {
+					continue
+				}
+
+				delete(pending, path)
+				l.refreshPath(ctx, path, events)
+			}
+		}
+	}
+}
+
+func (l *LocalAudioShelf) handleFSEvent(ctx context.Context, w *fsnotify.Watcher, ev fsnotify.Event, pending map[string]time.Time, events chan<- TrackEvent) {
+	log.WithFields(log.Fields{
+		"path": ev.Name,
+		"op":   ev.Op.String(),
+	}).Trace("filesystem event")
+
+	switch {
+	case ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		// renames show up as a remove of the old path and a create of the
+		// new one (if it is still inside the shelf)
+		delete(pending, ev.Name)
+		for _, track := range l.removePath(ev.Name) {
+			emit(ctx, events, TrackEvent{Type: TrackRemoved, Track: track})
+		}
+	case ev.Op&fsnotify.Create != 0:
+		info, err := os.Stat(ev.Name)
+		if err != nil {
+			return
+		}
+
+		if !info.IsDir() {
+			if l.ShouldInclude(ev.Name) {
+				pending[ev.Name] = time.Now()
+			}
+			return
+		}
+
+		if l.Excluded(ev.Name) {
+			return
+		}
+
+		// a new directory may already contain files by the time we see it
+		l.watchDir(w, ev.Name)
+		filepath.Walk(ev.Name, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.IsDir() && l.Excluded(path) {
+				return filepath.SkipDir
+			}
+			if err == nil && !info.IsDir() && l.ShouldInclude(path) {
+				pending[path] = time.Now()
+			}
+			return nil
+		})
+	case ev.Op&fsnotify.Write != 0:
+		if l.ShouldInclude(ev.Name) {
+			pending[ev.Name] = time.Now()
+		}
+	}
+}
+
+// refreshPath (re)loads the track at path and emits the resulting change
+func (l *LocalAudioShelf) refreshPath(ctx context.Context, path string, events chan<- TrackEvent) {
+	if _, err := os.Stat(path); err != nil {
+		for _, track := range l.removePath(path) {
+			emit(ctx, events, TrackEvent{Type: TrackRemoved, Track: track})
+		}
+		return
+	}
+
+	track, err := l.LoadTrack(ctx, path)
+	if err != nil {
+		log.WithError(err).WithField("path", path).Error("could not load track")
+		return
+	}
+
+	l.indexTrack(path, *track)
+	typ := l.putTrack(*track)
+
+	log.WithFields(log.Fields{
+		"path":  path,
+		"event": typ,
+	}).Debug("shelf changed")
+
+	emit(ctx, events, TrackEvent{Type: typ, Track: *track})
+}
+
+// putTrack adds a track to the shelf or replaces the one with the same path
+func (l *LocalAudioShelf) putTrack(track Track) TrackEventType {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := range l.tracks {
+		if l.tracks[i].Path == track.Path {
+			l.tracks[i] = track
+			return TrackChanged
+		}
+	}
+
+	l.tracks = append(l.tracks, track)
+	return TrackAdded
+}
+
+// removePath removes the track at path, or every track beneath it if path is
+// a directory. It returns the removed tracks.
+func (l *LocalAudioShelf) removePath(path string) []Track {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	prefix := path + string(filepath.Separator)
+	removed := []Track{}
+	kept := l.tracks[:0]
+	for _, track := range l.tracks {
+		if track.Path == path || strings.HasPrefix(track.Path, prefix) {
+			removed = append(removed, track)
+			continue
+		}
+		kept = append(kept, track)
+	}
+	l.tracks = kept
+
+	if l.index != nil {
+		l.index.Remove(path)
+		for _, track := range removed {
+			l.index.Remove(track.Path)
+		}
+	}
+
+	return removed
+}
+
+// emit sends an event unless the watcher is shutting down
+func emit(ctx context.Context, events chan<- TrackEvent, ev TrackEvent) {
+	select {
+	case events <- ev:
+	case <-ctx.Done():
+	}
+}
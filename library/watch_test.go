@@ -0,0 +1,63 @@
+package library_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nextEvent(t *testing.T, events <-chan library.TrackEvent) library.TrackEvent {
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for track event")
+	}
+	return library.TrackEvent{}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	s, err := library.NewLocalAudioShelf(dir)
+	require.NoError(t, err)
+	_, err = s.LoadTracks()
+	require.NoError(t, err)
+
+	events, err := s.Watch(ctx)
+	require.NoError(t, err)
+
+	// files in new directories are picked up too
+	album := filepath.Join(dir, "album")
+	require.NoError(t, os.Mkdir(album, 0755))
+	path := filepath.Join(album, "01.wav")
+	require.NoError(t, ioutil.WriteFile(path, []byte("RIFF"), 0644))
+
+	ev := nextEvent(t, events)
+	assert.Equal(t, library.TrackAdded, ev.Type)
+	assert.Equal(t, path, ev.Track.Path)
+	assert.Len(t, s.Tracks(), 1)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("RIFF again"), 0644))
+	ev = nextEvent(t, events)
+	assert.Equal(t, library.TrackChanged, ev.Type)
+
+	require.NoError(t, os.RemoveAll(album))
+	ev = nextEvent(t, events)
+	assert.Equal(t, library.TrackRemoved, ev.Type)
+	assert.Equal(t, path, ev.Track.Path)
+	assert.Len(t, s.Tracks(), 0)
+
+	cancel()
+	_, ok := <-events
+	assert.False(t, ok)
+}
@@ -0,0 +1,448 @@
+package library
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bogem/id3v2"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	riffList   = "LIST"
+	riffInfo   = "INFO"
+	riffFormat = "fmt "
+)
+
+// riffID3Chunks are the chunk ids used for embedded ID3v2 tags
+var riffID3Chunks = []string{"id3 ", "ID3 "}
+
+// riffChunk is a top level chunk of a RIFF file. Only metadata and format
+// chunks are read into memory, the rest are copied from the file when it is rewritten.
+type riffChunk struct {
+	id     string
+	offset int64
+	size   int64
+	data   []byte
+}
+
+func (c riffChunk) isInfo() bool {
+	return c.id == riffList && len(c.data) >= 4 && string(c.data[:4]) == riffInfo
+}
+
+func (c riffChunk) isID3() bool {
+	return c.id == riffID3Chunks[0] || c.id == riffID3Chunks[1]
+}
+
+// readRIFFChunks lists the chunks of a WAVE file. A final chunk that claims
+// to run past the end of the file, as left by an interrupted recording, is
+// cut short rather than treated as an error.
+func readRIFFChunks(f *os.File) ([]riffChunk, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 12)
+	_, err = f.ReadAt(header, 0)
+	if err != nil || string(header[:4]) != "RIFF" || string(header[8:]) != "WAVE" {
+		return nil, errors.New("not a wave file")
+	}
+
+	end := 8 + int64(binary.LittleEndian.Uint32(header[4:8]))
+	if end > info.Size() {
+		end = info.Size()
+	}
+
+	chunks := []riffChunk{}
+	for off := int64(12); off+8 <= end; {
+		_, err = f.ReadAt(header[:8], off)
+		if err != nil {
+			return nil, err
+		}
+
+		c := riffChunk{
+			id:     string(header[:4]),
+			offset: off + 8,
+			size:   int64(binary.LittleEndian.Uint32(header[4:8])),
+		}
+
+		if c.offset+c.size > end {
+			log.WithFields(log.Fields{
+				"chunk":  c.id,
+				"size":   c.size,
+				"offset": c.offset,
+			}).Debug("riff chunk runs past the end of the file")
+			c.size = end - c.offset
+		}
+
+		if c.id == riffList || c.id == riffFormat || c.isID3() {
+			c.data = make([]byte, c.size)
+			_, err = f.ReadAt(c.data, c.offset)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		chunks = append(chunks, c)
+
+		// chunks are padded to an even size
+		off = c.offset + c.size + c.size&1
+	}
+
+	return chunks, nil
+}
+
+// riffInfoField is a single LIST/INFO entry, eg: INAM
+type riffInfoField struct {
+	id    string
+	value string
+}
+
+// riffInfoList is the LIST/INFO chunk of a RIFF file. Fields keep their
+// original order.
+type riffInfoList struct {
+	fields []riffInfoField
+}
+
+// decodeRIFFInfo parses the body of a LIST chunk of type INFO
+func decodeRIFFInfo(b []byte) (*riffInfoList, error) {
+	ri := &riffInfoList{}
+	b = b[4:]
+	for len(b) >= 8 {
+		id := string(b[:4])
+		size := int(binary.LittleEndian.Uint32(b[4:8]))
+		b = b[8:]
+
+		if size > len(b) {
+			return ri, fmt.Errorf("info field [%s] exceeds chunk", id)
+		}
+
+		// values are usually NUL terminated, and sometimes NUL padded
+		value := strings.TrimRight(string(b[:size]), "\x00")
+		ri.fields = append(ri.fields, riffInfoField{id: id, value: value})
+
+		if size+size&1 > len(b) {
+			break
+		}
+		b = b[size+size&1:]
+	}
+
+	return ri, nil
+}
+
+// encode serializes the chunk body, including the INFO list type
+func (ri *riffInfoList) encode() []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(riffInfo)
+	for _, f := range ri.fields {
+		size := len(f.value) + 1
+		buf.WriteString(f.id)
+		binary.Write(buf, binary.LittleEndian, uint32(size))
+		buf.WriteString(f.value)
+		buf.WriteByte(0)
+		if size&1 == 1 {
+			buf.WriteByte(0)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// get returns the value of a field
+func (ri *riffInfoList) get(id string) string {
+	for _, f := range ri.fields {
+		if f.id == id {
+			return f.value
+		}
+	}
+	return ""
+}
+
+// set replaces a field in place, or appends it. An empty value removes the
+// field.
+func (ri *riffInfoList) set(id, value string) {
+	pos := -1
+	kept := ri.fields[:0]
+	for _, f := range ri.fields {
+		if f.id == id {
+			if pos < 0 {
+				pos = len(kept)
+			}
+			continue
+		}
+		kept = append(kept, f)
+	}
+	ri.fields = kept
+
+	if value == "" {
+		return
+	}
+
+	f := riffInfoField{id: id, value: value}
+	if pos < 0 {
+		ri.fields = append(ri.fields, f)
+		return
+	}
+
+	ri.fields = append(ri.fields[:pos], append([]riffInfoField{f}, ri.fields[pos:]...)...)
+}
+
+// setNumber sets a numeric field, removing it when n is 0
+func (ri *riffInfoList) setNumber(id string, n int) {
+	value := ""
+	if n > 0 {
+		value = strconv.Itoa(n)
+	}
+	ri.set(id, value)
+}
+
+// setTrack copies the track fields INFO can hold. Other fields are left
+// alone.
+func (ri *riffInfoList) setTrack(track *Track) {
+	ri.set("INAM", track.Title)
+	ri.set("IART", track.Artist)
+	ri.set("IPRD", track.Album)
+	ri.set("IGNR", track.Genre)
+	ri.set("ICMT", track.Comment)
+	ri.setNumber("ITRK", track.TrackNumber)
+
+	// keep a full date (eg: 2015-07-17) if the year has not changed
+	date := ri.get("ICRD")
+	if track.Year == 0 || !strings.HasPrefix(date, strconv.Itoa(track.Year)) {
+		ri.setNumber("ICRD", track.Year)
+	}
+}
+
+// fillTrack sets any empty track fields that INFO has a value for
+func (ri *riffInfoList) fillTrack(track *Track) {
+	fill := func(s *string, id string) {
+		if *s == "" {
+			*s = ri.get(id)
+		}
+	}
+
+	fill(&track.Title, "INAM")
+	fill(&track.Artist, "IART")
+	fill(&track.Album, "IPRD")
+	fill(&track.Genre, "IGNR")
+	fill(&track.Comment, "ICMT")
+
+	if track.TrackNumber == 0 {
+		track.TrackNumber, _ = parsePosition(ri.get("ITRK"))
+	}
+
+	if track.Year == 0 {
+		date := ri.get("ICRD")
+		if len(date) > 4 {
+			date = date[:4]
+		}
+		track.Year, _ = strconv.Atoi(date)
+	}
+}
+
+// loadWAV reads track metadata from the INFO and id3 chunks of a WAVE file.
+// The id3 chunk is richer, so INFO only fills in what it lacks.
+func loadWAV(path string, profile *RatingProfile) (*Track, error) {
+	track := Track{
+		FileType:    "WAV",
+		Path:        path,
+		RatingEmail: profile.Email,
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file [%s]: [%s]", path, err.Error())
+	}
+	defer f.Close()
+
+	// still list files without readable metadata, the player may cope
+	chunks, err := readRIFFChunks(f)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path":  path,
+			"error": err,
+		}).Warn("could not read riff chunks")
+		return &track, nil
+	}
+
+	for _, c := range chunks {
+		if !c.isID3() {
+			continue
+		}
+
+		tag, err := id3v2.ParseReader(bytes.NewReader(c.data), id3v2.Options{Parse: true})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path":  path,
+				"error": err,
+			}).Warn("could not parse id3 chunk")
+			break
+		}
+
+		t := id3Track(tag, profile)
+		t.FileType = track.FileType
+		t.Path = track.Path
+		track = t
+		break
+	}
+
+	for _, c := range chunks {
+		if !c.isInfo() {
+			continue
+		}
+
+		ri, err := decodeRIFFInfo(c.data)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"path":  path,
+				"error": err,
+			}).Warn("could not parse all riff info fields")
+		}
+		ri.fillTrack(&track)
+		break
+	}
+
+	loadProperties(&track)
+	return &track, nil
+}
+
+// saveWAV writes track metadata to the INFO and id3 chunks of a WAVE file,
+// adding them if they are missing. Other chunks are copied as they are and
+// the RIFF sizes are recomputed.
+func saveWAV(track *Track, profile *RatingProfile) error {
+	path := track.Path
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open file [%s]: [%s]", path, err.Error())
+	}
+	defer f.Close()
+
+	chunks, err := readRIFFChunks(f)
+	if err != nil {
+		return fmt.Errorf("could not read riff chunks [%s]: [%s]", path, err.Error())
+	}
+
+	info, id3 := -1, -1
+	for i, c := range chunks {
+		if info < 0 && c.isInfo() {
+			info = i
+		}
+		if id3 < 0 && c.isID3() {
+			id3 = i
+		}
+	}
+
+	ri := &riffInfoList{}
+	if info >= 0 {
+		ri, err = decodeRIFFInfo(chunks[info].data)
+		if err != nil {
+			return fmt.Errorf("could not read riff info [%s]: [%s]", path, err.Error())
+		}
+	}
+	ri.setTrack(track)
+
+	tag := id3v2.NewEmptyTag()
+	if id3 >= 0 {
+		tag, err = id3v2.ParseReader(bytes.NewReader(chunks[id3].data), id3v2.Options{Parse: true})
+		if err != nil {
+			return fmt.Errorf("could not read id3 chunk [%s]: [%s]", path, err.Error())
+		}
+	}
+	setID3Track(tag, track, profile)
+
+	id3Data := &bytes.Buffer{}
+	_, err = tag.WriteTo(id3Data)
+	if err != nil {
+		return fmt.Errorf("could not encode id3 chunk [%s]: [%s]", path, err.Error())
+	}
+
+	infoChunk := riffChunk{id: riffList, data: ri.encode()}
+	id3Chunk := riffChunk{id: riffID3Chunks[0], data: id3Data.Bytes()}
+	if id3 >= 0 {
+		id3Chunk.id = chunks[id3].id
+	}
+
+	// replace the metadata chunks where they are, or add them at the end
+	out := []riffChunk{}
+	for i, c := range chunks {
+		switch i {
+		case info:
+			c = infoChunk
+		case id3:
+			c = id3Chunk
+		}
+		out = append(out, c)
+	}
+	if info < 0 {
+		out = append(out, infoChunk)
+	}
+	if id3 < 0 {
+		out = append(out, id3Chunk)
+	}
+
+	size := int64(4)
+	kept := out[:0]
+	for _, c := range out {
+		if c.data != nil {
+			c.size = int64(len(c.data))
+		}
+
+		// drop metadata chunks that ended up empty
+		if (c.id == riffList && c.size <= 4) || (c.isID3() && c.size == 0) {
+			continue
+		}
+
+		size += 8 + c.size + c.size&1
+		kept = append(kept, c)
+	}
+	out = kept
+
+	if size > math.MaxUint32 {
+		return fmt.Errorf("could not save wav metadata [%s]: [file would exceed 4GB]", path)
+	}
+
+	return rewriteFile(path, func(w io.Writer) error {
+		header := make([]byte, 12)
+		copy(header, "RIFF")
+		binary.LittleEndian.PutUint32(header[4:8], uint32(size))
+		copy(header[8:], "WAVE")
+		_, err := w.Write(header)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range out {
+			binary.LittleEndian.PutUint32(header[4:8], uint32(c.size))
+			_, err = w.Write(append([]byte(c.id), header[4:8]...))
+			if err != nil {
+				return err
+			}
+
+			if c.data != nil {
+				_, err = w.Write(c.data)
+			} else {
+				_, err = io.Copy(w, io.NewSectionReader(f, c.offset, c.size))
+			}
+			if err != nil {
+				return err
+			}
+
+			if c.size&1 == 1 {
+				_, err = w.Write([]byte{0})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,165 @@
+package library_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func riffChunk(id string, data []byte) []byte {
+	b := []byte(id)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	if len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func riffInfo(fields ...string) []byte {
+	b := []byte("INFO")
+	for i := 0; i < len(fields); i += 2 {
+		b = append(b, riffChunk(fields[i], append([]byte(fields[i+1]), 0))...)
+	}
+	return riffChunk("LIST", b)
+}
+
+// writeWAV creates a wave file from chunks, fixing up the RIFF size
+func writeWAV(t *testing.T, chunks ...[]byte) string {
+	b := []byte("RIFF\x00\x00\x00\x00WAVE")
+	for _, c := range chunks {
+		b = append(b, c...)
+	}
+	binary.LittleEndian.PutUint32(b[4:8], uint32(len(b)-8))
+
+	path := filepath.Join(t.TempDir(), "track.wav")
+	require.NoError(t, ioutil.WriteFile(path, b, 0644))
+	return path
+}
+
+// readRIFF returns the top level chunks of a wave file, checking its sizes
+func readRIFF(t *testing.T, path string) map[string][]byte {
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "RIFF", string(b[:4]))
+	require.Equal(t, len(b)-8, int(binary.LittleEndian.Uint32(b[4:8])))
+
+	chunks := map[string][]byte{}
+	b = b[12:]
+	for len(b) > 0 {
+		require.True(t, len(b) >= 8)
+		size := int(binary.LittleEndian.Uint32(b[4:8]))
+		require.True(t, len(b) >= 8+size+size%2, "chunk %s overruns file", b[:4])
+		chunks[string(b[:4])] = b[8 : 8+size]
+		b = b[8+size+size%2:]
+	}
+	return chunks
+}
+
+func TestLoadWAVInfo(t *testing.T) {
+	path := writeWAV(t,
+		riffChunk("fmt ", make([]byte, 16)),
+		riffInfo("INAM", "Let It Happen", "IART", "Tame Impala", "IPRD", "Currents",
+			"ICRD", "2015-07-17", "IGNR", "Psychedelic", "ICMT", "great", "ITRK", "1"),
+		riffChunk("data", []byte{1, 2, 3}),
+	)
+
+	track, err := (&library.WAVHandler{}).Load(context.Background(), path)
+	require.NoError(t, err)
+	assert.Equal(t, library.Track{
+		Title:       "Let It Happen",
+		Artist:      "Tame Impala",
+		Album:       "Currents",
+		Genre:       "Psychedelic",
+		Comment:     "great",
+		TrackNumber: 1,
+		Year:        2015,
+		FileType:    "WAV",
+		Path:        path,
+		RatingEmail: "grump",
+	}, *track)
+}
+
+func TestSaveWAV(t *testing.T) {
+	format := make([]byte, 16)
+	audio := bytes.Repeat([]byte{1, 2, 3}, 333)
+
+	var tests = []struct {
+		name   string
+		chunks [][]byte
+	}{
+		{"no metadata", [][]byte{
+			riffChunk("fmt ", format),
+			riffChunk("data", audio),
+		}},
+		{"info", [][]byte{
+			riffChunk("fmt ", format),
+			riffInfo("INAM", "Old", "ISFT", "Lavf58.29.100", "ICRD", "2015-07-17"),
+			riffChunk("junk", []byte{1, 2, 3}),
+			riffChunk("data", audio),
+		}},
+	}
+
+	h := &library.WAVHandler{}
+	for _, test := range tests {
+		path := writeWAV(t, test.chunks...)
+
+		track := mp3Track
+		track.Path = path
+		track.FileType = "WAV"
+		_, err := h.Save(context.Background(), &track)
+		require.NoError(t, err, test.name)
+
+		loaded, err := h.Load(context.Background(), path)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, track, *loaded, test.name)
+
+		chunks := readRIFF(t, path)
+		assert.Equal(t, format, chunks["fmt "], test.name)
+		assert.Equal(t, audio, chunks["data"], test.name)
+		assert.NotEmpty(t, chunks["id3 "], test.name)
+
+		info := string(chunks["LIST"])
+		assert.Contains(t, info, "INAM\x0e\x00\x00\x00Let It Happen\x00", test.name)
+		assert.Contains(t, info, "IPRD\x09\x00\x00\x00Currents\x00\x00", test.name)
+
+		if test.name == "info" {
+			assert.Equal(t, []byte{1, 2, 3}, chunks["junk"], test.name)
+			assert.Contains(t, info, "ISFT", test.name)
+			assert.Contains(t, info, "2015-07-17", test.name)
+		}
+
+		// clearing fields removes them
+		cleared := library.Track{Path: path, FileType: "WAV", RatingEmail: "grump"}
+		_, err = h.Save(context.Background(), &cleared)
+		require.NoError(t, err, test.name)
+
+		loaded, err = h.Load(context.Background(), path)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, cleared, *loaded, test.name)
+		assert.Equal(t, audio, readRIFF(t, path)["data"], test.name)
+	}
+}
+
+func TestSaveWAVTruncated(t *testing.T) {
+	// the data chunk claims more bytes than the file holds
+	path := writeWAV(t, riffChunk("fmt ", make([]byte, 16)), []byte("data\xff\xff\x00\x00\x01\x02\x03\x04"))
+
+	track := library.Track{Path: path, Title: "Recovered", FileType: "WAV", RatingEmail: "grump"}
+	_, err := (&library.WAVHandler{}).Save(context.Background(), &track)
+	require.NoError(t, err)
+
+	chunks := readRIFF(t, path)
+	assert.Equal(t, []byte{1, 2, 3, 4}, chunks["data"])
+
+	loaded, err := (&library.WAVHandler{}).Load(context.Background(), path)
+	require.NoError(t, err)
+	assert.Equal(t, "Recovered", loaded.Title)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/dhulihan/grump/internal/config"
+	"github.com/dhulihan/grump/library"
+	"github.com/sirupsen/logrus"
+)
+
+// loudness measures tracks without a ReplayGain and saves their gain to
+// their tags, or the store where files can not be written. Albums are
+// measured as a whole so their album gain stays right.
+func loudness(c *config.Config, args []string) {
+	flags := flag.NewFlagSet("loudness", flag.ExitOnError)
+	force := flags.Bool("force", false, "measure every track, even those that already have a gain")
+	workers := flags.Int("workers", runtime.NumCPU(), "number of tracks to measure at once")
+	flags.Parse(args)
+
+	roots := c.LibraryRoots(flags.Args())
+	if len(roots) == 0 {
+		help()
+	}
+
+	shelves, index, _ := setupShelves(c, roots)
+	defer saveIndex(index)
+
+	ctx := context.Background()
+	failed := false
+	for _, shelf := range shelves {
+		_, err := shelf.LoadTracks()
+		if err != nil {
+			logrus.WithError(err).WithField("path", shelf.Directory()).Error("could not load tracks")
+			failed = true
+			continue
+		}
+
+		all := shelf.Tracks()
+		pending := []library.Track{}
+		for _, track := range all {
+			if *force || !track.ReplayGain.HasTrack() {
+				pending = append(pending, track)
+			}
+		}
+
+		tracks := library.AlbumTracks(all, pending)
+		prev := map[string]library.Track{}
+		for _, track := range tracks {
+			prev[track.Path] = track
+		}
+
+		measured := 0
+		scanned := library.ScanLoudness(ctx, tracks, *workers, func(track library.Track, err error) {
+			measured++
+			if err != nil {
+				logrus.WithError(err).WithField("path", track.Path).Error("could not measure loudness")
+				failed = true
+				return
+			}
+			fmt.Printf("[%d/%d] %s\n", measured, len(tracks), track.Path)
+		})
+
+		saved := 0
+		for _, track := range scanned {
+			track := track
+			p := prev[track.Path]
+			if p.ReplayGain == track.ReplayGain {
+				continue
+			}
+
+			_, err := shelf.SaveTrack(ctx, &p, &track)
+			if err != nil {
+				logrus.WithError(err).WithField("path", track.Path).Error("could not save replay gain")
+				failed = true
+				continue
+			}
+			saved++
+		}
+
+		fmt.Printf("%s: measured %d tracks, saved %d\n", shelf.Directory(), len(scanned), saved)
+	}
+
+	if failed {
+		saveIndex(index)
+		os.Exit(1)
+	}
+}
@@ -27,25 +27,27 @@ func main() {
 		logrus.WithError(err).Fatal("could not set up config")
 	}
 
-	if len(os.Args) < 2 {
-		help()
+	if len(os.Args) > 1 && os.Args[1] == "organize" {
+		organize(c, os.Args[2:])
+		return
 	}
 
-	path := os.Args[1]
-	logrus.WithField("path", path).Info("starting up")
+	if len(os.Args) > 1 && os.Args[1] == "loudness" {
+		loudness(c, os.Args[2:])
+		return
+	}
 
-	audioShelf, err := library.NewLocalAudioShelf(path)
-	if err != nil {
-		logrus.WithError(err).Fatal("could not set up audio library")
+	roots := c.LibraryRoots(os.Args[1:])
+	if len(roots) == 0 {
+		help()
 	}
 
-	count, err := audioShelf.LoadTracks()
-	if err != nil {
-		logrus.WithError(err).Fatal("could not load audio library")
+	shelves, index, trash := setupShelves(c, roots)
+	audioShelves := []library.AudioShelf{}
+	for _, shelf := range shelves {
+		audioShelves = append(audioShelves, shelf)
 	}
-	logrus.WithField("count", count).Info("loaded library")
 
-	audioShelves := []library.AudioShelf{audioShelf}
 	db, err := library.NewLibrary(audioShelves)
 	if err != nil {
 		logrus.WithError(err).Fatal("could not set up player db")
@@ -56,19 +58,151 @@ func main() {
 		logrus.WithError(err).Fatal("could not set up audio player")
 	}
 
+	replayGain, err := library.ParseReplayGainMode(c.ReplayGain.Mode)
+	if err != nil {
+		logrus.WithError(err).Warn("could not set replay gain mode")
+	}
+	player.SetReplayGain(replayGain, c.ReplayGain.Preamp)
+
 	build := ui.BuildInfo{
 		Version: version,
 		Commit:  commit,
 	}
 
-	err = ui.Start(ctx, build, db, player, c.Loggers())
+	var history *library.History
+	if c.HistoryFile != "" {
+		history = library.NewHistory(c.HistoryFile)
+	}
+
+	// tracks are loaded by the ui so scan progress can be displayed
+	err = ui.Start(ctx, build, c, db, player, history, trash)
+	saveIndex(index)
 	if err != nil {
 		logrus.WithError(err).Fatal("ui exited with an error")
 	}
 }
 
+// setupShelves creates a shelf for each library directory, sharing the
+// index, store and trash between them
+func setupShelves(c *config.Config, roots []config.LibraryConfig) ([]*library.LocalAudioShelf, *library.Index, *library.Trash) {
+	var err error
+	var index *library.Index
+	if c.IndexFile != "" {
+		index, err = library.LoadIndex(c.IndexFile)
+		if err != nil {
+			logrus.WithError(err).Fatal("could not load library index")
+		}
+	}
+
+	// without a store, play counts and ratings of read-only tracks are not kept
+	var store *library.Store
+	if c.StoreFile != "" {
+		store, err = library.LoadStore(c.StoreFile)
+		if err != nil {
+			logrus.WithError(err).Error("could not load store")
+		}
+	}
+
+	// without a trash, deleted tracks can not be restored
+	var trash *library.Trash
+	if c.Trash.Dir != "" {
+		trash = library.NewTrash(c.Trash.Dir)
+	}
+
+	precedence, err := library.ParseRatingPrecedence(c.Ratings.Precedence)
+	if err != nil {
+		logrus.WithError(err).Warn("could not set rating precedence")
+	}
+
+	profile, err := ratingProfile(c.Ratings)
+	if err != nil {
+		logrus.WithError(err).Warn("could not set rating profile, using the default")
+		profile = &library.DefaultRatingProfile
+	}
+
+	if index != nil {
+		index.SetRatingProfile(profile.Name)
+	}
+
+	shelves := []*library.LocalAudioShelf{}
+	for _, root := range roots {
+		logrus.WithFields(logrus.Fields{
+			"path":     root.Path,
+			"readOnly": root.ReadOnly,
+			"exclude":  root.Exclude,
+		}).Info("adding library directory")
+
+		audioShelf, err := library.NewLocalAudioShelf(root.Path)
+		if err != nil {
+			logrus.WithError(err).Fatal("could not set up audio library")
+		}
+
+		audioShelf.SetReadOnly(root.ReadOnly)
+		audioShelf.SetExcludes(root.Exclude)
+		audioShelf.SetRatingProfile(profile)
+		audioShelf.SetTrash(trash, c.Trash.Cleanup)
+		if index != nil {
+			audioShelf.SetIndex(index)
+		}
+		if store != nil {
+			audioShelf.SetStore(store)
+			audioShelf.SetRatings(store, precedence)
+		}
+
+		shelves = append(shelves, audioShelf)
+	}
+
+	return shelves, index, trash
+}
+
+// saveIndex persists the library index, if one is in use
+func saveIndex(index *library.Index) {
+	if index == nil {
+		return
+	}
+
+	err := index.Save()
+	if err != nil {
+		logrus.WithError(err).Error("could not save library index")
+	}
+}
+
+// ratingProfile looks up the configured rating profile, custom profiles first
+func ratingProfile(rc config.RatingsConfig) (*library.RatingProfile, error) {
+	name := rc.Profile
+	if name == "" {
+		name = library.DefaultRatingProfile.Name
+	}
+
+	pc, ok := rc.Profiles[name]
+	if !ok {
+		profile, ok := library.RatingProfiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown rating profile [%s]", name)
+		}
+		return &profile, nil
+	}
+
+	profile := library.RatingProfile{
+		Name:       name,
+		Email:      pc.Email,
+		ReadEmails: pc.ReadEmails,
+		Frames:     library.PopmFrames(pc.Frames),
+	}
+	if profile.Frames == "" {
+		profile.Frames = library.PopmOwn
+	}
+	for _, step := range pc.Steps {
+		profile.Steps = append(profile.Steps, library.RatingStep{Stars: step.Stars, Byte: step.Byte, Min: step.Min})
+	}
+
+	return &profile, profile.Validate()
+}
+
 func help() {
 	cmd := os.Args[0]
-	fmt.Printf("%s <file or directory>\n", cmd)
+	fmt.Printf("%s <directory> [directory...]\n", cmd)
+	fmt.Printf("%s organize [-apply] [-template template] [directory...]\n", cmd)
+	fmt.Printf("%s loudness [-force] [-workers n] [directory...]\n", cmd)
 	os.Exit(2)
 }
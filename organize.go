@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dhulihan/grump/internal/config"
+	"github.com/dhulihan/grump/library"
+	"github.com/sirupsen/logrus"
+)
+
+// organize moves library files into the layout of a path template. It only
+// prints the moves unless -apply is given.
+func organize(c *config.Config, args []string) {
+	flags := flag.NewFlagSet("organize", flag.ExitOnError)
+	apply := flags.Bool("apply", false, "move the files, rather than only showing what would move")
+	template := flags.String("template", c.OrganizeTemplate, "path template, eg: "+library.DefaultPathTemplate)
+	flags.Parse(args)
+
+	if *template == "" {
+		*template = library.DefaultPathTemplate
+	}
+
+	tmpl, err := library.ParsePathTemplate(*template)
+	if err != nil {
+		logrus.WithError(err).Fatal("could not parse organize template")
+	}
+
+	roots := c.LibraryRoots(flags.Args())
+	if len(roots) == 0 {
+		help()
+	}
+
+	shelves, index, _ := setupShelves(c, roots)
+	defer saveIndex(index)
+
+	failed := false
+	for _, shelf := range shelves {
+		_, err := shelf.LoadTracks()
+		if err != nil {
+			logrus.WithError(err).WithField("path", shelf.Directory()).Error("could not load tracks")
+			failed = true
+			continue
+		}
+
+		moves := shelf.PlanOrganize(tmpl)
+		err = library.WriteMoves(os.Stdout, shelf.Directory(), moves)
+		if err != nil {
+			logrus.WithError(err).Fatal("could not write moves")
+		}
+
+		if !*apply || len(moves) == 0 {
+			fmt.Printf("%s: %d tracks to move\n", shelf.Directory(), len(moves))
+			continue
+		}
+
+		moved, err := shelf.Organize(moves)
+		fmt.Printf("%s: moved %d of %d tracks\n", shelf.Directory(), moved, len(moves))
+		if err != nil {
+			logrus.WithError(err).WithField("path", shelf.Directory()).Error("could not organize library")
+			failed = true
+		}
+	}
+
+	if !*apply {
+		fmt.Println("this was a dry run, add -apply to move the files")
+	}
+
+	if failed {
+		saveIndex(index)
+		os.Exit(1)
+	}
+}
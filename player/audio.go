@@ -1,6 +1,8 @@
 package player
 
 import (
+	"time"
+
 	"github.com/dhulihan/grump/library"
 )
 
@@ -35,4 +37,12 @@ type PlayState struct {
 	Position string
 	Volume   string
 	Speed    string
+
+	// Elapsed and Length of the stream as decoded so far, which may be an
+	// estimate for some formats
+	Elapsed time.Duration
+	Length  time.Duration
+
+	// SpeedRatio is the playback speed, 1 is normal
+	SpeedRatio float64
 }
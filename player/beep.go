@@ -2,17 +2,12 @@ package player
 
 import (
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/dhulihan/grump/library"
 	"github.com/faiface/beep"
 	"github.com/faiface/beep/effects"
-	"github.com/faiface/beep/flac"
-	"github.com/faiface/beep/mp3"
 	"github.com/faiface/beep/speaker"
-	"github.com/faiface/beep/vorbis"
-	"github.com/faiface/beep/wav"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -35,7 +30,10 @@ var (
 )
 
 // BeepAudioPlayer is an audio player implementation that uses beep
-type BeepAudioPlayer struct{}
+type BeepAudioPlayer struct {
+	replayGain library.ReplayGainMode
+	preamp     float64
+}
 
 // BeepController manages playing audio.
 //
@@ -52,6 +50,7 @@ type audioPanel struct {
 	sampleRate beep.SampleRate
 	ctrl       *beep.Ctrl
 	resampler  *beep.Resampler
+	gain       *effects.Gain
 	volume     *effects.Volume
 	streamer   beep.StreamSeekCloser
 	finished   bool
@@ -60,7 +59,8 @@ type audioPanel struct {
 // newAudioPanel creates a new audio panel.
 //
 // count - number of times to repeat the track
-func newAudioPanel(sampleRate beep.SampleRate, streamer beep.StreamSeekCloser, count int) *audioPanel {
+// scale - factor to multiply samples by, for ReplayGain
+func newAudioPanel(sampleRate beep.SampleRate, streamer beep.StreamSeekCloser, count int, scale float64) *audioPanel {
 	ctrl := &beep.Ctrl{Streamer: beep.Loop(count, streamer)}
 
 	log.WithFields(log.Fields{
@@ -70,11 +70,15 @@ func newAudioPanel(sampleRate beep.SampleRate, streamer beep.StreamSeekCloser, c
 
 	resampler := beep.Resample(quality, sampleRate, maxSampleRate, ctrl)
 
-	volume := &effects.Volume{Streamer: resampler, Base: 2}
+	// ReplayGain is applied before the user's volume, which works relative
+	// to it
+	gain := &effects.Gain{Streamer: resampler, Gain: scale - 1}
+	volume := &effects.Volume{Streamer: gain, Base: 2}
 	return &audioPanel{
 		sampleRate: sampleRate,
 		ctrl:       ctrl,
 		resampler:  resampler,
+		gain:       gain,
 		volume:     volume,
 		streamer:   streamer,
 	}
@@ -86,6 +90,13 @@ func NewBeepAudioPlayer() (*BeepAudioPlayer, error) {
 	return &bmp, nil
 }
 
+// SetReplayGain sets which ReplayGain is applied to tracks played from now
+// on, with preamp dB added to it
+func (bmp *BeepAudioPlayer) SetReplayGain(mode library.ReplayGainMode, preamp float64) {
+	bmp.replayGain = mode
+	bmp.preamp = preamp
+}
+
 // Play a track and return a controller that lets you perform changes to a running track.
 func (bmp *BeepAudioPlayer) Play(track library.Track, repeat bool) (AudioController, error) {
 	c := BeepController{
@@ -93,40 +104,11 @@ func (bmp *BeepAudioPlayer) Play(track library.Track, repeat bool) (AudioControl
 		done: make(chan (bool)),
 	}
 
-	f, err := os.Open(track.Path)
+	// do not close the stream, it is closed with the controller
+	s, format, err := library.OpenAudio(track)
 	if err != nil {
 		return nil, err
 	}
-	// do not close file io, this should get freed up when we close the streamer
-	//defer f.Close()
-
-	var s beep.StreamSeekCloser
-	var format beep.Format
-
-	switch track.FileType {
-	case "MP3":
-		s, format, err = mp3.Decode(f)
-		if err != nil {
-			return nil, err
-		}
-	case "FLAC":
-		s, format, err = flac.Decode(f)
-		if err != nil {
-			return nil, err
-		}
-	case "OGG":
-		s, format, err = vorbis.Decode(f)
-		if err != nil {
-			return nil, err
-		}
-	case "WAV":
-		s, format, err = wav.Decode(f)
-		if err != nil {
-			return nil, err
-		}
-	default:
-		return nil, fmt.Errorf("unsupported file type [%s]", track.FileType)
-	}
 
 	// number of times to repeat the track
 	count := 1
@@ -140,7 +122,13 @@ func (bmp *BeepAudioPlayer) Play(track library.Track, repeat bool) (AudioControl
 		speakerInitialized = true
 	}
 
-	c.audioPanel = newAudioPanel(format.SampleRate, s, count)
+	scale := track.ReplayGain.Scale(bmp.replayGain, bmp.preamp)
+	log.WithFields(log.Fields{
+		"mode":  bmp.replayGain,
+		"scale": scale,
+	}).Debug("applying replay gain")
+
+	c.audioPanel = newAudioPanel(format.SampleRate, s, count, scale)
 
 	// WARNING: speaker.Play is async
 	speaker.Play(beep.Seq(c.audioPanel.volume, beep.Callback(func() {
@@ -179,6 +167,10 @@ func (c *BeepController) PlayState() (PlayState, error) {
 		Volume:   volumeStatus,
 		Speed:    speedStatus,
 		Finished: finished,
+		Elapsed:  position,
+		Length:   length,
+
+		SpeedRatio: speed,
 	}
 	return prog, nil
 }
@@ -1,11 +1,18 @@
 package player
 
 import (
+	"time"
+
 	"github.com/dhulihan/grump/library"
 )
 
 // MockAudioPlayer is an audio player implementation that uses beep
-type MockAudioPlayer struct{}
+type MockAudioPlayer struct {
+	// Tick is how far each PlayState call moves playback along, and Length
+	// is when a track finishes. Zero values never move or finish.
+	Tick   time.Duration
+	Length time.Duration
+}
 
 // NewMockAudioPlayer --
 func NewMockAudioPlayer() *MockAudioPlayer {
@@ -14,19 +21,34 @@ func NewMockAudioPlayer() *MockAudioPlayer {
 }
 
 // Play a track and return a controller that lets you perform changes to a running track.
-func (bmp *MockAudioPlayer) Play(track library.Track, repeat bool) (*MockAudioController, error) {
-	return &MockAudioController{}, nil
+func (bmp *MockAudioPlayer) Play(track library.Track, repeat bool) (AudioController, error) {
+	return &MockAudioController{tick: bmp.Tick, length: bmp.Length}, nil
+}
+
+// MockAudioController records whether it was stopped
+type MockAudioController struct {
+	Stopped bool
+
+	tick, length, elapsed time.Duration
+}
+
+// PlayState moves playback along by a tick
+func (p *MockAudioController) PlayState() (PlayState, error) {
+	p.elapsed += p.tick
+	return PlayState{
+		Elapsed:    p.elapsed,
+		Length:     p.length,
+		SpeedRatio: 1,
+		Finished:   p.length > 0 && p.elapsed >= p.length,
+	}, nil
 }
 
-type MockAudioController struct{}
-
-func (p *MockAudioController) Paused() bool                  { return false }
-func (p *MockAudioController) PauseToggle() bool             { return true }
-func (p *MockAudioController) PlayState() (PlayState, error) { return PlayState{}, nil }
-func (p *MockAudioController) SeekForward() error            { return nil }
-func (p *MockAudioController) SeekBackward() error           { return nil }
-func (p *MockAudioController) SpeedUp()                      {}
-func (p *MockAudioController) SpeedDown()                    {}
-func (p *MockAudioController) Stop()                         {}
-func (p *MockAudioController) VolumeUp()                     {}
-func (p *MockAudioController) VolumeDown()                   {}
+func (p *MockAudioController) Paused() bool        { return false }
+func (p *MockAudioController) PauseToggle() bool   { return true }
+func (p *MockAudioController) SeekForward() error  { return nil }
+func (p *MockAudioController) SeekBackward() error { return nil }
+func (p *MockAudioController) SpeedUp()            {}
+func (p *MockAudioController) SpeedDown()          {}
+func (p *MockAudioController) Stop()               { p.Stopped = true }
+func (p *MockAudioController) VolumeUp()           {}
+func (p *MockAudioController) VolumeDown()         {}
@@ -0,0 +1,487 @@
+package ui
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+	log "github.com/sirupsen/logrus"
+)
+
+// ways of drawing cover art, set with the artwork config option
+const (
+	artworkAuto   = "auto"
+	artworkOff    = "off"
+	artworkBlocks = "blocks"
+	artworkSixel  = "sixel"
+	artworkKitty  = "kitty"
+)
+
+const (
+	// width of the cover art in the now playing panel, including a gap
+	artworkWidth = 7
+
+	// covers are shrunk to at most this many pixels a side when loaded
+	artworkMaxSize = 256
+
+	// number of albums to keep cover art for
+	artworkCacheSize = 32
+
+	// kitty image id, so the cover can be replaced and removed
+	kittyImageID = 7153
+
+	// kitty graphics payloads are sent in chunks of this many bytes
+	kittyChunkSize = 4096
+)
+
+// artworkProtocol picks how to draw cover art. Graphics protocols can not be
+// queried while tcell owns the terminal, so auto goes by the environment and
+// falls back to half-block characters, which work in any colour terminal.
+func artworkProtocol(mode string, getenv func(string) string) string {
+	switch mode {
+	case artworkOff, artworkBlocks, artworkSixel, artworkKitty:
+		return mode
+	case "", artworkAuto:
+	default:
+		log.WithField("artwork", mode).Warn("unknown artwork mode, detecting terminal support")
+	}
+
+	// tmux swallows graphics escapes unless told to pass them through
+	if getenv("TMUX") != "" {
+		return artworkBlocks
+	}
+
+	term := getenv("TERM")
+	switch {
+	case getenv("KITTY_WINDOW_ID") != "", term == "xterm-kitty":
+		return artworkKitty
+	case getenv("TERM_PROGRAM") == "WezTerm", getenv("TERM_PROGRAM") == "ghostty":
+		return artworkKitty
+	case strings.HasPrefix(term, "foot"), strings.HasPrefix(term, "mlterm"), strings.Contains(term, "sixel"):
+		return artworkSixel
+	}
+
+	return artworkBlocks
+}
+
+// artworkKey identifies the album a track belongs to. Tracks without an
+// album are grouped by directory.
+func artworkKey(track library.Track) string {
+	if track.Album == "" {
+		return filepath.Dir(track.Path)
+	}
+
+	artist := track.AlbumArtist
+	if artist == "" {
+		artist = track.Artist
+	}
+
+	return strings.ToLower(artist + "\x00" + track.Album)
+}
+
+// artworkCache holds decoded cover art for recently played albums. Albums
+// without art are cached as nil so they are not read again.
+type artworkCache struct {
+	keys   []string
+	images map[string]image.Image
+}
+
+func newArtworkCache() *artworkCache {
+	return &artworkCache{images: map[string]image.Image{}}
+}
+
+func (c *artworkCache) get(key string) (image.Image, bool) {
+	img, ok := c.images[key]
+	return img, ok
+}
+
+// add caches an image, dropping the oldest album when full
+func (c *artworkCache) add(key string, img image.Image) {
+	if _, ok := c.images[key]; !ok {
+		c.keys = append(c.keys, key)
+	}
+	c.images[key] = img
+
+	if len(c.keys) > artworkCacheSize {
+		delete(c.images, c.keys[0])
+		c.keys = c.keys[1:]
+	}
+}
+
+// loadArtwork reads and shrinks a track's cover art. It returns nil if the
+// track has none.
+func loadArtwork(track library.Track) image.Image {
+	art, err := track.Artwork()
+	if errors.Is(err, library.ErrNoArtwork) {
+		return nil
+	}
+	if err != nil {
+		log.WithError(err).WithField("path", track.Path).Debug("could not load artwork")
+		return nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(art.Data))
+	if err != nil {
+		log.WithError(err).WithField("source", art.Source).Debug("could not decode artwork")
+		return nil
+	}
+
+	w, h := fitSize(img.Bounds().Dx(), img.Bounds().Dy(), artworkMaxSize, artworkMaxSize)
+	return scaleImage(img, w, h)
+}
+
+// artworkView draws the cover of the playing track
+type artworkView struct {
+	*tview.Box
+
+	protocol string
+	cache    *artworkCache
+	key      string
+	image    image.Image
+
+	// resize is called when the view gains or loses an image
+	resize func(width int)
+
+	// scaled is image resized to the area it was last drawn in
+	scaled image.Image
+
+	// graphics protocols write to the terminal after tcell has drawn
+	term       io.Writer
+	cellWidth  int
+	cellHeight int
+	drawn      bool
+	area       image.Rectangle
+	screenSize image.Point
+	placed     image.Rectangle
+}
+
+func newArtworkView(mode string, getenv func(string) string) *artworkView {
+	a := &artworkView{
+		Box:      tview.NewBox().SetBorderPadding(0, 0, 0, 1),
+		protocol: artworkProtocol(mode, getenv),
+		cache:    newArtworkCache(),
+		resize:   func(int) {},
+	}
+
+	if a.protocol == artworkSixel || a.protocol == artworkKitty {
+		term, err := openTerminal()
+		if err != nil {
+			log.WithError(err).Debug("could not open terminal for graphics, using half blocks")
+			a.protocol = artworkBlocks
+		} else {
+			a.term = term
+			a.cellWidth, a.cellHeight = terminalCellSize(term)
+		}
+	}
+
+	log.WithField("protocol", a.protocol).Debug("artwork protocol")
+	return a
+}
+
+// setTrack shows the cover of a track, loading it in the background unless
+// its album is cached
+func (a *artworkView) setTrack(track library.Track) {
+	if a.protocol == artworkOff {
+		return
+	}
+
+	key := artworkKey(track)
+	if key == a.key {
+		return
+	}
+	a.key = key
+
+	if img, ok := a.cache.get(key); ok {
+		a.setImage(img)
+		return
+	}
+
+	a.setImage(nil)
+	go func() {
+		img := loadArtwork(track)
+		app.QueueUpdateDraw(func() {
+			a.cache.add(key, img)
+			if a.key == key {
+				a.setImage(img)
+			}
+		})
+	}()
+}
+
+func (a *artworkView) setImage(img image.Image) {
+	a.image = img
+	a.scaled = nil
+
+	if img == nil {
+		a.resize(0)
+	} else {
+		a.resize(artworkWidth)
+	}
+}
+
+// Draw draws the cover with half-block characters, or leaves blank cells for
+// afterDraw to put an image over
+func (a *artworkView) Draw(screen tcell.Screen) {
+	a.Box.Draw(screen)
+	x, y, width, height := a.GetInnerRect()
+	if a.image == nil || width <= 0 || height <= 0 {
+		return
+	}
+
+	if a.protocol != artworkBlocks {
+		a.drawn = true
+		a.area = image.Rect(x, y, x+width, y+height)
+		return
+	}
+
+	// each cell holds two pixels, the top one in the foreground colour
+	b := a.image.Bounds()
+	w, h := fitSize(b.Dx(), b.Dy(), width, height*2)
+	if a.scaled == nil || a.scaled.Bounds().Size() != image.Pt(w, h) {
+		a.scaled = scaleImage(a.image, w, h)
+	}
+
+	for row := 0; row < (h+1)/2; row++ {
+		for col := 0; col < w; col++ {
+			style := tcell.StyleDefault.Foreground(cellColor(a.scaled.At(col, row*2)))
+			if row*2+1 < h {
+				style = style.Background(cellColor(a.scaled.At(col, row*2+1)))
+			}
+			screen.SetContent(x+col, y+row, '▀', nil, style)
+		}
+	}
+}
+
+// afterDraw places the cover with a graphics protocol once tcell has flushed
+// the screen. Images are only sent again when something moved or the screen
+// was redrawn from scratch.
+func (a *artworkView) afterDraw(screen tcell.Screen) {
+	if a.term == nil {
+		return
+	}
+
+	visible := a.drawn
+	a.drawn = false
+
+	var size image.Point
+	size.X, size.Y = screen.Size()
+	if visible && a.placed == a.area && a.screenSize == size && a.scaled != nil {
+		return
+	}
+	a.screenSize = size
+
+	if a.placed != (image.Rectangle{}) {
+		if a.protocol == artworkKitty {
+			fmt.Fprintf(a.term, "\x1b_Ga=d,d=I,i=%d,q=2\x1b\\", kittyImageID)
+		} else {
+			// sixels stay on screen until the cells under them are redrawn
+			screen.Sync()
+		}
+		a.placed = image.Rectangle{}
+	}
+
+	if !visible {
+		return
+	}
+
+	b := a.image.Bounds()
+	w, h := fitSize(b.Dx(), b.Dy(), a.area.Dx()*a.cellWidth, a.area.Dy()*a.cellHeight)
+	if a.scaled == nil || a.scaled.Bounds().Size() != image.Pt(w, h) {
+		a.scaled = scaleImage(a.image, w, h)
+	}
+
+	buf := &bytes.Buffer{}
+
+	// save the cursor and move to the top left of the area
+	fmt.Fprintf(buf, "\x1b7\x1b[%d;%dH", a.area.Min.Y+1, a.area.Min.X+1)
+	if a.protocol == artworkKitty {
+		err := encodeKitty(buf, a.scaled)
+		if err != nil {
+			log.WithError(err).Debug("could not encode artwork")
+			return
+		}
+	} else {
+		encodeSixel(buf, a.scaled)
+	}
+	buf.WriteString("\x1b8")
+
+	_, err := a.term.Write(buf.Bytes())
+	if err != nil {
+		log.WithError(err).Debug("could not write artwork")
+		return
+	}
+	a.placed = a.area
+}
+
+// encodeKitty writes an image using the kitty graphics protocol
+func encodeKitty(w io.Writer, img image.Image) error {
+	data := &bytes.Buffer{}
+	err := png.Encode(data, img)
+	if err != nil {
+		return err
+	}
+
+	payload := base64.StdEncoding.EncodeToString(data.Bytes())
+	for i := 0; i < len(payload); i += kittyChunkSize {
+		end := i + kittyChunkSize
+		more := 1
+		if end >= len(payload) {
+			end = len(payload)
+			more = 0
+		}
+
+		if i == 0 {
+			fmt.Fprintf(w, "\x1b_Ga=T,f=100,i=%d,C=1,q=2,m=%d;%s\x1b\\", kittyImageID, more, payload[i:end])
+		} else {
+			fmt.Fprintf(w, "\x1b_Gm=%d;%s\x1b\\", more, payload[i:end])
+		}
+	}
+
+	return nil
+}
+
+// encodeSixel writes an image as sixels, using a 6x6x6 colour cube
+func encodeSixel(w io.Writer, img image.Image) {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+
+	// palette index of every pixel
+	pixels := make([]int, width*height)
+	used := [216]bool{}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			i := sixelLevel(r)*36 + sixelLevel(g)*6 + sixelLevel(bl)
+			pixels[y*width+x] = i
+			used[i] = true
+		}
+	}
+
+	fmt.Fprintf(w, "\x1bPq\"1;1;%d;%d", width, height)
+	for i, u := range used {
+		if u {
+			fmt.Fprintf(w, "#%d;2;%d;%d;%d", i, i/36*20, i/6%6*20, i%6*20)
+		}
+	}
+
+	// each band is six pixels high, drawn once per colour in it
+	for top := 0; top < height; top += 6 {
+		bands := map[int][]byte{}
+		order := []int{}
+		for x := 0; x < width; x++ {
+			for k := 0; k < 6 && top+k < height; k++ {
+				i := pixels[(top+k)*width+x]
+				if bands[i] == nil {
+					bands[i] = make([]byte, width)
+					order = append(order, i)
+				}
+				bands[i][x] |= 1 << k
+			}
+		}
+
+		for _, i := range order {
+			fmt.Fprintf(w, "#%d", i)
+			writeSixelRuns(w, bands[i])
+			io.WriteString(w, "$")
+		}
+		io.WriteString(w, "-")
+	}
+
+	io.WriteString(w, "\x1b\\")
+}
+
+// writeSixelRuns writes one colour of a band, run length encoded
+func writeSixelRuns(w io.Writer, bits []byte) {
+	for x := 0; x < len(bits); {
+		n := 1
+		for x+n < len(bits) && bits[x+n] == bits[x] {
+			n++
+		}
+
+		c := string(rune(63 + bits[x]))
+		if n > 3 {
+			fmt.Fprintf(w, "!%d%s", n, c)
+		} else {
+			io.WriteString(w, strings.Repeat(c, n))
+		}
+		x += n
+	}
+}
+
+// sixelLevel maps a 16 bit colour channel onto 6 levels
+func sixelLevel(v uint32) int {
+	return int((v>>8)*5+127) / 255
+}
+
+func cellColor(c color.Color) tcell.Color {
+	r, g, b, _ := c.RGBA()
+	return tcell.NewRGBColor(int32(r>>8), int32(g>>8), int32(b>>8))
+}
+
+// fitSize scales width and height to fit a box, keeping the aspect ratio
+func fitSize(width, height, boxWidth, boxHeight int) (int, int) {
+	if width <= 0 || height <= 0 {
+		return 0, 0
+	}
+
+	w, h := boxWidth, height*boxWidth/width
+	if h > boxHeight {
+		w, h = width*boxHeight/height, boxHeight
+	}
+
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+// scaleImage resizes an image, averaging the source pixels that fall under
+// each new pixel
+func scaleImage(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := b.Min.Y + (y+1)*b.Dy()/height
+		if y1 == y0 {
+			y1++
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := b.Min.X + (x+1)*b.Dx()/width
+			if x1 == x0 {
+				x1++
+			}
+
+			var r, g, bl, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, _ := img.At(sx, sy).RGBA()
+					r += cr >> 8
+					g += cg >> 8
+					bl += cb >> 8
+					n++
+				}
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255})
+		}
+	}
+
+	return dst
+}
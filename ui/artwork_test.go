@@ -0,0 +1,81 @@
+package ui
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/gdamore/tcell"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtworkProtocol(t *testing.T) {
+	var tests = []struct {
+		mode string
+		env  map[string]string
+		want string
+	}{
+		{"", map[string]string{"TERM": "xterm-256color"}, artworkBlocks},
+		{"auto", map[string]string{"TERM": "xterm-kitty"}, artworkKitty},
+		{"", map[string]string{"TERM": "xterm-256color", "TERM_PROGRAM": "WezTerm"}, artworkKitty},
+		{"", map[string]string{"TERM": "foot"}, artworkSixel},
+		{"", map[string]string{"TERM": "xterm-kitty", "TMUX": "/tmp/tmux-1000/default"}, artworkBlocks},
+		{"sixel", map[string]string{"TERM": "xterm-kitty"}, artworkSixel},
+		{"off", map[string]string{"TERM": "xterm-kitty"}, artworkOff},
+		{"bogus", map[string]string{}, artworkBlocks},
+	}
+
+	for _, test := range tests {
+		got := artworkProtocol(test.mode, func(k string) string { return test.env[k] })
+		assert.Equal(t, test.want, got, "%s %v", test.mode, test.env)
+	}
+}
+
+func TestEncodeSixel(t *testing.T) {
+	// one red pixel above seven blue ones, so the second band is partial
+	img := image.NewRGBA(image.Rect(0, 0, 1, 8))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	for y := 1; y < 8; y++ {
+		img.Set(0, y, color.RGBA{0, 0, 255, 255})
+	}
+
+	buf := &bytes.Buffer{}
+	encodeSixel(buf, img)
+	assert.Equal(t, "\x1bPq\"1;1;1;8#5;2;0;0;100#180;2;100;0;0#180@$#5}$-#5B$-\x1b\\", buf.String())
+}
+
+func TestArtworkBlocks(t *testing.T) {
+	screen := tcell.NewSimulationScreen("UTF-8")
+	require.NoError(t, screen.Init())
+	screen.SetSize(10, 5)
+
+	// a 2x2 image fills two cells of one row
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	img.Set(1, 0, color.RGBA{0, 255, 0, 255})
+	img.Set(0, 1, color.RGBA{0, 0, 255, 255})
+	img.Set(1, 1, color.RGBA{255, 255, 255, 255})
+
+	a := newArtworkView(artworkBlocks, func(string) string { return "" })
+	a.setImage(img)
+	a.SetRect(0, 0, 3, 1)
+	a.Draw(screen)
+
+	var tests = []struct {
+		x      int
+		fg, bg tcell.Color
+	}{
+		{0, tcell.NewRGBColor(255, 0, 0), tcell.NewRGBColor(0, 0, 255)},
+		{1, tcell.NewRGBColor(0, 255, 0), tcell.NewRGBColor(255, 255, 255)},
+	}
+
+	for _, test := range tests {
+		r, _, style, _ := screen.GetContent(test.x, 0)
+		fg, bg, _ := style.Decompose()
+		assert.Equal(t, '▀', r, "cell %d", test.x)
+		assert.Equal(t, test.fg, fg, "cell %d", test.x)
+		assert.Equal(t, test.bg, bg, "cell %d", test.x)
+	}
+}
@@ -0,0 +1,392 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/rivo/tview"
+	log "github.com/sirupsen/logrus"
+)
+
+// mixedValue is shown in the batch edit form for fields that differ between
+// the tracks being edited
+const mixedValue = "<mixed>"
+
+// maxBatchErrors is how many failed files are listed after a batch edit
+const maxBatchErrors = 8
+
+// batchField is a tag that can be edited on many tracks at once
+type batchField struct {
+	field library.Field
+	label string
+}
+
+// batchFields are the fields of the batch edit form, in order
+var batchFields = []batchField{
+	{library.FieldTitle, "Title"},
+	{library.FieldArtist, "Artist"},
+	{library.FieldAlbumArtist, "Album Artist"},
+	{library.FieldAlbum, "Album"},
+	{library.FieldGenre, "Genre"},
+	{library.FieldYear, "Year"},
+	{library.FieldDiscNumber, "Disc"},
+	{library.FieldDiscTotal, "Disc Total"},
+	{library.FieldTrackTotal, "Track Total"},
+}
+
+// batchEdit is an open batch edit form and the tracks it will change
+type batchEdit struct {
+	tracks  []library.Track
+	initial map[library.Field]string
+	score   string
+}
+
+// batchChange is a track changed by a batch edit
+type batchChange struct {
+	prev  library.Track
+	track library.Track
+}
+
+// batchValue returns the value shown for a field when editing tracks, which
+// is mixedValue if they do not all share it. Numbers that are not set are
+// shown empty.
+func batchValue(tracks []library.Track, f library.Field) string {
+	value := ""
+	for i, track := range tracks {
+		v := f.Text(track)
+		if f.Numeric() && f.Number(track) == 0 {
+			v = ""
+		}
+
+		switch {
+		case i == 0:
+			value = v
+		case v != value:
+			return mixedValue
+		}
+	}
+
+	return value
+}
+
+// batchScore returns the score shown when editing tracks, which is
+// mixedValue if they do not all share it
+func batchScore(tracks []library.Track) string {
+	score := ""
+	for i, track := range tracks {
+		s := Score(track.Rating)
+		switch {
+		case i == 0:
+			score = s
+		case s != score:
+			return mixedValue
+		}
+	}
+
+	return score
+}
+
+// applyBatch sets edited fields, and the score unless it is empty, on copies
+// of tracks. It returns the tracks that changed. Nothing is changed if any
+// value is invalid.
+func applyBatch(tracks []library.Track, edits map[library.Field]string, score string) ([]batchChange, error) {
+	for f, v := range edits {
+		if !f.Numeric() || strings.TrimSpace(v) == "" {
+			continue
+		}
+
+		var check library.Track
+		err := f.Set(&check, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	changes := []batchChange{}
+	for _, prev := range tracks {
+		track := prev
+		changed := false
+
+		for f, v := range edits {
+			// clearing a number sets it to 0
+			if f.Numeric() && strings.TrimSpace(v) == "" {
+				v = "0"
+			}
+
+			before := f.Text(track)
+			f.Set(&track, v)
+			changed = changed || f.Text(track) != before
+		}
+
+		if score != "" && Score(track.Rating) != score {
+			track.Rating = Rating(score)
+			changed = true
+		}
+
+		if changed {
+			changes = append(changes, batchChange{prev: prev, track: track})
+		}
+	}
+
+	return changes, nil
+}
+
+// selectedTracks returns the selected tracks in cache order
+func (t *TrackPage) selectedTracks() []library.Track {
+	tracks := []library.Track{}
+	for _, track := range t.tracks {
+		if t.selected[track.Path] {
+			tracks = append(tracks, track)
+		}
+	}
+
+	return tracks
+}
+
+// rowIcon returns the status icon of a row that is not playing
+func (t *TrackPage) rowIcon(row int) string {
+	i, ok := t.rowTrack(row)
+	if ok && t.selected[t.tracks[i].Path] {
+		return trackIconSelectedText
+	}
+
+	return trackIconEmptyText
+}
+
+// setSelected selects or deselects the track shown on a row
+func (t *TrackPage) setSelected(row int, selected bool) {
+	i, ok := t.rowTrack(row)
+	if !ok {
+		return
+	}
+
+	path := t.tracks[i].Path
+	if selected {
+		t.selected[path] = true
+	} else {
+		delete(t.selected, path)
+	}
+
+	if row != t.currentlyPlayingRow {
+		t.trackList.GetCell(row, columnStatus).SetText(t.rowIcon(row))
+	}
+}
+
+// toggleSelect selects or deselects the hovered track and moves down a row,
+// so tracks can be picked one after another
+func (t *TrackPage) toggleSelect() {
+	row, _ := t.trackList.GetSelection()
+	i, ok := t.rowTrack(row)
+	if !ok {
+		return
+	}
+
+	t.selectAnchor = t.tracks[i].Path
+	t.setSelected(row, !t.selected[t.selectAnchor])
+
+	if row < len(t.visible) {
+		t.trackList.Select(row+1, 0)
+	}
+	t.selectionStatus()
+}
+
+// selectRange selects every row between the last toggled track and the
+// hovered track
+func (t *TrackPage) selectRange() {
+	row, _ := t.trackList.GetSelection()
+	anchor := t.trackRow(t.trackIndex(t.selectAnchor))
+	if anchor == 0 {
+		anchor = row
+	}
+
+	if anchor > row {
+		anchor, row = row, anchor
+	}
+
+	for r := anchor; r <= row; r++ {
+		t.setSelected(r, true)
+	}
+	t.selectionStatus()
+}
+
+// selectAll selects every track matching the current filter, or deselects
+// them if they are all selected already
+func (t *TrackPage) selectAll() {
+	all := true
+	for _, i := range t.visible {
+		all = all && t.selected[t.tracks[i].Path]
+	}
+
+	for row := 1; row <= len(t.visible); row++ {
+		t.setSelected(row, !all)
+	}
+	t.selectionStatus()
+}
+
+// selectNone clears the selection
+func (t *TrackPage) selectNone() {
+	t.selected = map[string]bool{}
+	t.selectAnchor = ""
+
+	for row := 1; row <= len(t.visible); row++ {
+		if row != t.currentlyPlayingRow {
+			t.trackList.GetCell(row, columnStatus).SetText(trackIconEmptyText)
+		}
+	}
+	t.selectionStatus()
+}
+
+// selectionStatus logs how many tracks are selected
+func (t *TrackPage) selectionStatus() {
+	log.Infof("%d tracks selected", len(t.selected))
+}
+
+// editSelected opens the batch edit form for the selected tracks, or the
+// hovered track if none are selected
+func (t *TrackPage) editSelected() {
+	tracks := t.selectedTracks()
+	if len(tracks) == 0 {
+		track, err := t.track(hovered)
+		if err != nil {
+			log.WithError(err).Error("could not target track")
+			return
+		}
+		tracks = append(tracks, *track)
+	}
+
+	b := &batchEdit{
+		tracks:  tracks,
+		initial: map[library.Field]string{},
+		score:   batchScore(tracks),
+	}
+	t.batch = b
+
+	batchForm.Clear(true)
+	for _, bf := range batchFields {
+		b.initial[bf.field] = batchValue(tracks, bf.field)
+		batchForm.AddFormItem(newInputField(bf.label, b.initial[bf.field], nil))
+	}
+
+	scores := Scores
+	if b.score == mixedValue {
+		scores = append([]string{mixedValue}, Scores...)
+	}
+	batchForm.AddFormItem(newDropDown("Score", scores, indexOf(scores, b.score))).
+		AddButton("Apply", t.applyBatchEdit).
+		AddButton("Cancel", t.batchCancel).
+		SetCancelFunc(t.batchCancel)
+
+	batchForm.SetBorder(true).
+		SetTitle(fmt.Sprintf("Edit %d Tracks (unchanged fields are kept)", len(tracks))).
+		SetTitleAlign(tview.AlignLeft)
+	pages.ShowPage("batch")
+	app.SetFocus(batchForm)
+}
+
+func (t *TrackPage) batchCancel() {
+	t.batch = nil
+	pages.HidePage("batch")
+	app.SetFocus(t.trackList)
+}
+
+// applyBatchEdit saves the changed fields of the batch edit form to every
+// track in the background, then reports which files could not be saved
+func (t *TrackPage) applyBatchEdit() {
+	ctx := context.Background()
+	b := t.batch
+	if b == nil {
+		return
+	}
+
+	edits := map[library.Field]string{}
+	for _, bf := range batchFields {
+		v := getFormInputText(batchForm, bf.label)
+		if v != b.initial[bf.field] && v != mixedValue {
+			edits[bf.field] = v
+		}
+	}
+
+	score := ""
+	if dd, ok := batchForm.GetFormItemByLabel("Score").(*tview.DropDown); ok {
+		_, s := dd.GetCurrentOption()
+		if s != b.score && s != mixedValue {
+			score = s
+		}
+	}
+
+	changes, err := applyBatch(t.currentTracks(b.tracks), edits, score)
+	if err != nil {
+		log.WithError(err).Error("could not edit tracks")
+		return
+	}
+
+	t.batchCancel()
+	log.WithFields(log.Fields{"tracks": len(b.tracks), "changed": len(changes)}).Info("saving batch edit")
+
+	go func() {
+		failures := []string{}
+		for _, change := range changes {
+			prev, track := change.prev, change.track
+			saved, err := t.shelf.SaveTrack(ctx, &prev, &track)
+			if err != nil {
+				log.WithError(err).WithField("path", track.Path).Error("could not save batch edit")
+				failures = append(failures, fmt.Sprintf("%s: %s", filepath.Base(track.Path), err.Error()))
+				continue
+			}
+
+			app.QueueUpdateDraw(func() {
+				if i := t.trackIndex(saved.Path); i >= 0 {
+					t.replaceTrack(i, *saved)
+				}
+			})
+		}
+
+		app.QueueUpdateDraw(func() {
+			t.batchResults(len(b.tracks), len(changes), failures)
+		})
+	}()
+}
+
+// currentTracks returns the cached copy of each track, which may have had a
+// play counted or a score set since tracks were taken
+func (t *TrackPage) currentTracks(tracks []library.Track) []library.Track {
+	current := make([]library.Track, 0, len(tracks))
+	for _, track := range tracks {
+		if i := t.trackIndex(track.Path); i >= 0 {
+			track = t.tracks[i]
+		}
+		current = append(current, track)
+	}
+
+	return current
+}
+
+// batchResults shows how a batch edit went, listing files that failed
+func (t *TrackPage) batchResults(total, changed int, failures []string) {
+	msg := fmt.Sprintf("Saved %d of %d tracks, %d were unchanged.",
+		changed-len(failures), total, total-changed)
+
+	if len(failures) > 0 {
+		msg += fmt.Sprintf("\n\n%d could not be saved:\n", len(failures))
+		shown := failures
+		if len(shown) > maxBatchErrors {
+			shown = shown[:maxBatchErrors]
+		}
+		msg += strings.Join(shown, "\n")
+		if len(failures) > len(shown) {
+			msg += fmt.Sprintf("\n...and %d more, see logs", len(failures)-len(shown))
+		}
+	}
+
+	modal := tview.NewModal().
+		SetText(msg).
+		AddButtons([]string{"OK"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			app.SetRoot(pages, true).SetFocus(t.trackList)
+		})
+
+	app.SetRoot(modal, false).SetFocus(modal)
+}
@@ -0,0 +1,63 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchEdit(t *testing.T) {
+	tracks := []library.Track{
+		{Path: "a.mp3", Title: "One", Artist: "Tame Impala", Album: "Currents", Year: 2015, Rating: 204},
+		{Path: "b.mp3", Title: "Two", Artist: "Tame Impala", Album: "Currents", Year: 2015, Rating: 153},
+		{Path: "c.mp3", Title: "Three", Artist: "Tame Impala", Album: "Lonerism"},
+	}
+
+	assert.Equal(t, mixedValue, batchValue(tracks, library.FieldTitle))
+	assert.Equal(t, "Tame Impala", batchValue(tracks, library.FieldArtist))
+	assert.Equal(t, mixedValue, batchValue(tracks, library.FieldYear))
+	assert.Equal(t, "", batchValue(tracks, library.FieldDiscNumber))
+	assert.Equal(t, mixedValue, batchScore(tracks))
+	assert.Equal(t, Score40, batchScore(tracks[:1]))
+
+	var tests = []struct {
+		name    string
+		edits   map[library.Field]string
+		score   string
+		changed []string
+		err     bool
+	}{
+		{"nothing", map[library.Field]string{}, "", []string{}, false},
+		{"album", map[library.Field]string{library.FieldAlbum: "Currents"}, "", []string{"c.mp3"}, false},
+		{"year", map[library.Field]string{library.FieldYear: "2015"}, "", []string{"c.mp3"}, false},
+		{"clear year", map[library.Field]string{library.FieldYear: ""}, "", []string{"a.mp3", "b.mp3"}, false},
+		{"score", map[library.Field]string{}, Score30, []string{"a.mp3", "c.mp3"}, false},
+		{"bad year", map[library.Field]string{library.FieldAlbum: "x", library.FieldYear: "soon"}, "", nil, true},
+	}
+
+	for _, test := range tests {
+		changes, err := applyBatch(tracks, test.edits, test.score)
+		if test.err {
+			assert.Error(t, err, test.name)
+			continue
+		}
+		require.NoError(t, err, test.name)
+
+		changed := []string{}
+		for _, c := range changes {
+			changed = append(changed, c.track.Path)
+
+			// fields that were not edited keep each track's own value
+			assert.Equal(t, c.prev.Title, c.track.Title, test.name)
+			for f, v := range test.edits {
+				assert.Equal(t, v, batchValue([]library.Track{c.track}, f), test.name)
+			}
+		}
+		assert.Equal(t, test.changed, changed, test.name)
+	}
+
+	// the tracks themselves are untouched
+	assert.Equal(t, "Lonerism", tracks[2].Album)
+}
@@ -1 +1,246 @@
 package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dhulihan/grump/internal/config"
+	"github.com/dhulihan/grump/library"
+	"github.com/rivo/tview"
+	log "github.com/sirupsen/logrus"
+)
+
+// columnStatus is always the first table column, track columns follow it
+const columnStatus = 0
+
+// column is a track table column showing a single track field
+type column struct {
+	field     library.Field
+	title     string
+	width     int
+	expansion int
+	align     int
+}
+
+// columnSet is a named list of columns that can be switched to at runtime
+type columnSet struct {
+	name    string
+	columns []column
+}
+
+// columnDefaults is the layout of each field when shown as a column. Fields not
+// listed here get a plain left aligned column.
+var columnDefaults = map[library.Field]column{
+	library.FieldAlbum:       {title: "Album", width: 8, expansion: 4},
+	library.FieldAlbumArtist: {title: "Album Artist", width: 8, expansion: 4},
+	library.FieldArtist:      {title: "Artist", width: 8, expansion: 4},
+	library.FieldBitDepth:    {title: "Bits", align: tview.AlignRight},
+	library.FieldBitrate:     {title: "kbps", align: tview.AlignRight},
+	library.FieldChannels:    {title: "Ch", align: tview.AlignRight},
+	library.FieldComment:     {title: "Comment", width: 8, expansion: 2},
+	library.FieldComposer:    {title: "Composer", width: 8, expansion: 2},
+	library.FieldDiscNumber:  {title: "Disc", align: tview.AlignRight},
+	library.FieldDiscTotal:   {title: "Discs", align: tview.AlignRight},
+	library.FieldFileType:    {title: "Type"},
+	library.FieldGenre:       {title: "Genre", width: 8, expansion: 2},
+	library.FieldLength:      {title: "Length", align: tview.AlignRight},
+	library.FieldLyrics:      {title: "Lyrics", width: 8, expansion: 1},
+	library.FieldMimeType:    {title: "MIME Type"},
+	library.FieldPath:        {title: "Path", width: 8, expansion: 6},
+	library.FieldPlayCount:   {title: "Plays", align: tview.AlignRight},
+	library.FieldRating:      {title: "Rating"},
+	library.FieldSampleRate:  {title: "Hz", align: tview.AlignRight},
+	library.FieldTitle:       {title: "Title", width: 8, expansion: 10},
+	library.FieldTrackNumber: {title: "#", align: tview.AlignRight},
+	library.FieldTrackTotal:  {title: "Tracks", align: tview.AlignRight},
+	library.FieldYear:        {title: "Year", align: tview.AlignRight},
+}
+
+// columnAliases are alternative names accepted in config
+var columnAliases = map[string]library.Field{
+	"duration": library.FieldLength,
+	"plays":    library.FieldPlayCount,
+	"name":     library.FieldTitle,
+}
+
+// newColumn builds a column from config, filling in defaults for anything
+// that was not set.
+func newColumn(cc config.ColumnConfig) (column, error) {
+	field, ok := columnAliases[strings.ToLower(cc.Name)]
+	if !ok {
+		var err error
+		field, err = library.ParseField(cc.Name)
+		if err != nil {
+			return column{}, fmt.Errorf("could not create column [%s]: [%s]", cc.Name, err.Error())
+		}
+	}
+
+	c, ok := columnDefaults[field]
+	if !ok {
+		c.title = strings.Title(string(field))
+	}
+	c.field = field
+
+	if cc.Width > 0 {
+		c.width = cc.Width
+	}
+
+	if cc.Expansion > 0 {
+		c.expansion = cc.Expansion
+	}
+
+	switch strings.ToLower(cc.Align) {
+	case "":
+	case "left":
+		c.align = tview.AlignLeft
+	case "center":
+		c.align = tview.AlignCenter
+	case "right":
+		c.align = tview.AlignRight
+	default:
+		return column{}, fmt.Errorf("could not create column [%s]: unknown alignment [%s]", cc.Name, cc.Align)
+	}
+
+	return c, nil
+}
+
+// newColumns builds columns from config, skipping any that are invalid
+func newColumns(ccs []config.ColumnConfig) []column {
+	columns := []column{}
+	for _, cc := range ccs {
+		c, err := newColumn(cc)
+		if err != nil {
+			log.WithError(err).Warn("skipping column")
+			continue
+		}
+		columns = append(columns, c)
+	}
+
+	return columns
+}
+
+// columnSets returns the configured column sets. The "default" set comes
+// from Columns and is always first, the rest are sorted by name.
+func columnSets() []columnSet {
+	c := cfg()
+
+	defaults := newColumns(c.Columns)
+	if len(defaults) == 0 {
+		defaults = newColumns(config.DefaultConfig().Columns)
+	}
+	sets := []columnSet{{name: "default", columns: defaults}}
+
+	names := []string{}
+	for name := range c.ColumnSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		columns := newColumns(c.ColumnSets[name])
+		if len(columns) == 0 {
+			log.WithField("name", name).Warn("skipping empty column set")
+			continue
+		}
+		sets = append(sets, columnSet{name: name, columns: columns})
+	}
+
+	return sets
+}
+
+// columns returns the columns currently shown in the track table
+func (t *TrackPage) columns() []column {
+	return t.columnSets[t.columnSet].columns
+}
+
+// cycleColumns switches to the next column set
+func (t *TrackPage) cycleColumns() {
+	if len(t.columnSets) < 2 {
+		log.Info("no other column sets configured")
+		return
+	}
+
+	t.columnSet = (t.columnSet + 1) % len(t.columnSets)
+	t.renderTracks()
+
+	log.WithField("columns", t.columnSets[t.columnSet].name).Info("switched columns")
+}
+
+// headerCell returns the table header for a column
+func (c column) headerCell(indicator string) *tview.TableCell {
+	return &tview.TableCell{
+		Text:          c.title + indicator,
+		Color:         theme.TitleColor,
+		Align:         c.align,
+		NotSelectable: true,
+	}
+}
+
+// cell returns the table cell showing a column of a track
+func (c column) cell(track library.Track) *tview.TableCell {
+	cell := &tview.TableCell{
+		Text:      c.text(track),
+		Color:     theme.PrimaryTextColor,
+		Align:     c.align,
+		MaxWidth:  c.width,
+		Expansion: c.expansion,
+	}
+
+	if c.field == library.FieldRating {
+		cell.Color = ScoreColor(cell.Text)
+	}
+
+	return cell
+}
+
+// text formats a track field for display
+func (c column) text(track library.Track) string {
+	switch c.field {
+	case library.FieldTitle:
+		// use path if title is empty
+		if track.Title == "" {
+			return track.Path
+		}
+		return track.Title
+	case library.FieldRating:
+		return Score(track.Rating)
+	case library.FieldLength:
+		return formatLength(track.Length)
+	case library.FieldFileType:
+		if track.FileType == "" {
+			return strings.TrimPrefix(filepath.Ext(track.Path), ".")
+		}
+		return track.FileType
+	}
+
+	// hide unset numbers rather than showing a column of zeroes
+	if c.field.Numeric() && c.field.Number(track) == 0 {
+		return ""
+	}
+
+	return c.field.Text(track)
+}
+
+// formatLength formats a length in millis as m:ss, or h:mm:ss for long tracks
+func formatLength(millis int) string {
+	if millis <= 0 {
+		return ""
+	}
+
+	return formatDuration(time.Duration(millis) * time.Millisecond)
+}
+
+// formatDuration formats a duration as m:ss, or h:mm:ss when over an hour
+func formatDuration(d time.Duration) string {
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
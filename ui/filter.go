@@ -0,0 +1,74 @@
+package ui
+
+import (
+	"github.com/dhulihan/grump/library"
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+	log "github.com/sirupsen/logrus"
+)
+
+// newFilterInput creates the search bar shown above the track list
+func newFilterInput() *tview.InputField {
+	return tview.NewInputField().
+		SetLabel("/ ").
+		SetLabelColor(theme.TitleColor).
+		SetFieldBackgroundColor(theme.PrimitiveBackgroundColor).
+		SetFieldTextColor(theme.PrimaryTextColor).
+		SetPlaceholder(`eg: tame impala, artist:"tame impala" year>2010 -album:live`).
+		SetPlaceholderTextColor(theme.BorderColor)
+}
+
+// openFilter shows the search bar and focuses it
+func (t *TrackPage) openFilter() {
+	log.Trace("opening filter")
+	t.main.ResizeItem(t.filterInput, 1, 0)
+	app.SetFocus(t.filterInput)
+}
+
+// closeFilter clears the filter and hides the search bar
+func (t *TrackPage) closeFilter() {
+	log.Trace("closing filter")
+	t.filterInput.SetText("")
+	t.main.ResizeItem(t.filterInput, 0, 0)
+	app.SetFocus(t.trackList)
+}
+
+// filterChanged narrows the track list as the user types
+func (t *TrackPage) filterChanged(text string) {
+	pred, err := library.ParseSearch(text, library.SearchOptions{
+		Stars: Stars,
+		Fuzzy: true,
+	})
+	if err != nil {
+		// the query is probably incomplete, keep the last one that worked
+		log.WithError(err).Debug("could not parse filter")
+		t.filterInput.SetFieldTextColor(tcell.ColorRed)
+		return
+	}
+	t.filterInput.SetFieldTextColor(theme.PrimaryTextColor)
+
+	t.setFilter(pred)
+}
+
+// setFilter changes the track filter and redraws the track list
+func (t *TrackPage) setFilter(pred library.Predicate) {
+	t.filter = pred
+	t.renderTracks()
+
+	log.WithFields(log.Fields{
+		"visible": len(t.visible),
+		"total":   len(t.tracks),
+	}).Debug("filtered tracks")
+}
+
+// filterDone handles leaving the search bar. Enter keeps the filter, escape
+// clears it.
+func (t *TrackPage) filterDone(key tcell.Key) {
+	switch key {
+	case tcell.KeyEnter:
+		app.SetFocus(t.trackList)
+	case tcell.KeyEscape:
+		// clearing the text resets the filter
+		t.closeFilter()
+	}
+}
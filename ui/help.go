@@ -2,6 +2,7 @@ package ui
 
 import (
 	"context"
+	"strings"
 
 	"github.com/gdamore/tcell"
 	"github.com/rivo/tview"
@@ -17,35 +18,7 @@ type HelpPage struct {
 func NewHelpPage(ctx context.Context) *HelpPage {
 	theme := defaultTheme()
 
-	kb := []KeyboardShortcut{
-		KeyboardShortcut{"space", "pause/unpause"},
-		KeyboardShortcut{"escape", "stop track"},
-		KeyboardShortcut{"d", "describe currently playing track"},
-		KeyboardShortcut{"e", "edit currently playing track"},
-		KeyboardShortcut{"delete", "delete currently playing track (with prompt)"},
-		KeyboardShortcut{"l", "view logs page"},
-		KeyboardShortcut{"left", "seek forward (does not work on flac)"},
-		KeyboardShortcut{"right", "seek backward  (does not work on flac)"},
-		KeyboardShortcut{"]", "play next track"},
-		KeyboardShortcut{"[", "play previous track"},
-		KeyboardShortcut{"=", "volume up"},
-		KeyboardShortcut{"-", "volume down"},
-		KeyboardShortcut{"S", "toggle shuffle"},
-		KeyboardShortcut{"+", "speed up"},
-		KeyboardShortcut{"_", "speed down"},
-		KeyboardShortcut{"q", "quit"},
-		KeyboardShortcut{"0", "set rating of currently playing track to " + Score00},
-		KeyboardShortcut{"shift+0", "set rating of currently playing track to " + Score05},
-		KeyboardShortcut{"1", "set rating of currently playing track to " + Score10},
-		KeyboardShortcut{"shift+1", "set rating of currently playing track to " + Score15},
-		KeyboardShortcut{"2", "set rating of currently playing track to " + Score20},
-		KeyboardShortcut{"shift+2", "set rating of currently playing track to " + Score25},
-		KeyboardShortcut{"3", "set rating of currently playing track to " + Score30},
-		KeyboardShortcut{"shift+3", "set rating of currently playing track to " + Score35},
-		KeyboardShortcut{"4", "set rating of currently playing track to " + Score40},
-		KeyboardShortcut{"shift+4", "set rating of currently playing track to " + Score45},
-		KeyboardShortcut{"5", "set rating of currently playing track to " + Score50},
-	}
+	kb := keyboardShortcuts(keyBindings())
 
 	middle := tview.NewTable().SetBorders(true).SetBordersColor(theme.BorderColor)
 	return &HelpPage{
@@ -89,6 +62,22 @@ type KeyboardShortcut struct {
 	Description string
 }
 
+// keyboardShortcuts lists the keys bound to every action, so the help page
+// always matches the real bindings
+func keyboardShortcuts(km *keyMap) []KeyboardShortcut {
+	kb := []KeyboardShortcut{}
+	for _, info := range actions {
+		keys := km.keysFor(info.action)
+		if len(keys) == 0 {
+			continue
+		}
+
+		kb = append(kb, KeyboardShortcut{strings.Join(keys, ", "), info.description})
+	}
+
+	return kb
+}
+
 func (p *HelpPage) keyboardShortcut(row, column int, key, description string) *tview.TableCell {
 	return &tview.TableCell{Text: trackIconEmptyText, Color: p.theme.TitleColor, NotSelectable: true}
 }
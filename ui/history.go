@@ -0,0 +1,167 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+	log "github.com/sirupsen/logrus"
+)
+
+// number of plays shown on the history page
+const historyLimit = 500
+
+// HistoryPage lists recent plays from the listening history
+type HistoryPage struct {
+	history *library.History
+	table   *tview.Table
+	bottom  *tview.TextView
+}
+
+// NewHistoryPage creates the history page. history may be nil if it is
+// disabled.
+func NewHistoryPage(ctx context.Context, history *library.History) *HistoryPage {
+	return &HistoryPage{
+		history: history,
+		table:   tview.NewTable().SetFixed(1, 0).SetSelectable(true, false),
+		bottom:  tview.NewTextView(),
+	}
+}
+
+// Page populates the layout for the history page
+func (p *HistoryPage) Page(ctx context.Context) tview.Primitive {
+	p.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		globalInputCapture(event)
+
+		switch keyBindings().action(event, scopeHistory) {
+		case ActionExportJSON:
+			p.export("json", library.WriteHistoryJSON)
+			return nil
+		case ActionExportCSV:
+			p.export("csv", library.WriteHistoryCSV)
+			return nil
+		}
+
+		switch event.Key() {
+		case tcell.KeyESC:
+			pages.SwitchToPage("tracks")
+		}
+
+		return event
+	})
+	p.table.SetBorder(true).SetTitle("Listening History").SetBorderColor(theme.BorderColor)
+
+	p.help()
+
+	main := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(p.table, 0, 6, true).
+		AddItem(p.bottom, 1, 0, false)
+
+	return tview.NewFlex().AddItem(main, 0, 3, true)
+}
+
+// help describes the page's keys in the bottom bar
+func (p *HistoryPage) help() {
+	p.bottom.SetText(fmt.Sprintf("Press escape to go back. Export: %s JSON, %s CSV.",
+		strings.Join(keyBindings().keysFor(ActionExportJSON), ", "),
+		strings.Join(keyBindings().keysFor(ActionExportCSV), ", ")))
+}
+
+// refresh reloads recent plays, newest first
+func (p *HistoryPage) refresh() {
+	p.table.Clear()
+	p.help()
+
+	for i, title := range []string{"Played", "Artist", "Title", "Album", "Heard", "Speed", ""} {
+		p.table.SetCell(0, i, &tview.TableCell{Text: title, Color: theme.TitleColor, NotSelectable: true})
+	}
+
+	if p.history == nil {
+		p.bottom.SetText("Listening history is disabled, set history_file to enable it.")
+		return
+	}
+
+	plays, err := p.history.Recent(historyLimit)
+	if err != nil {
+		log.WithError(err).Error("could not read listening history")
+		return
+	}
+
+	for i, play := range plays {
+		row := i + 1
+		color := theme.PrimaryTextColor
+		if !play.Finished {
+			color = theme.SecondaryTextColor
+		}
+
+		p.table.SetCell(row, 0, &tview.TableCell{Text: play.Start.Local().Format("2006-01-02 15:04"), Color: theme.BorderColor})
+		p.table.SetCell(row, 1, &tview.TableCell{Text: play.Artist, Color: color, MaxWidth: 30, Expansion: 1})
+		p.table.SetCell(row, 2, &tview.TableCell{Text: play.Title, Color: color, MaxWidth: 40, Expansion: 2})
+		p.table.SetCell(row, 3, &tview.TableCell{Text: play.Album, Color: color, MaxWidth: 30, Expansion: 1})
+		p.table.SetCell(row, 4, &tview.TableCell{Text: formatDuration(time.Duration(play.Listened) * time.Millisecond), Color: color, Align: tview.AlignRight})
+		p.table.SetCell(row, 5, &tview.TableCell{Text: fmt.Sprintf("%.2fx", play.Speed), Color: color, Align: tview.AlignRight})
+		p.table.SetCell(row, 6, &tview.TableCell{Text: playOutcome(play), Color: color})
+	}
+
+	p.table.Select(1, 0).ScrollToBeginning()
+}
+
+// playOutcome describes how a play ended, eg: "skipped, shuffle"
+func playOutcome(play library.Play) string {
+	s := "skipped"
+	if play.Finished {
+		s = "finished"
+	}
+
+	if play.Shuffle {
+		s += ", " + shuffleIconOn
+	}
+	return s
+}
+
+// export writes the whole history next to the history file
+func (p *HistoryPage) export(ext string, write func(io.Writer, []library.Play) error) {
+	if p.history == nil {
+		return
+	}
+
+	path, err := exportHistory(p.history, ext, write)
+	if err != nil {
+		log.WithError(err).Error("could not export listening history")
+		p.bottom.SetText("Export failed, see logs.")
+		return
+	}
+
+	log.WithField("path", path).Info("exported listening history")
+	p.bottom.SetText("Exported to " + path)
+}
+
+func exportHistory(history *library.History, ext string, write func(io.Writer, []library.Play) error) (string, error) {
+	plays, err := history.Plays()
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("history-%s.%s", time.Now().Format("20060102-150405"), ext)
+	path := filepath.Join(filepath.Dir(history.Path()), name)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("could not create export [%s]: [%s]", path, err.Error())
+	}
+
+	err = write(f, plays)
+	if err != nil {
+		f.Close()
+		return "", fmt.Errorf("could not write export [%s]: [%s]", path, err.Error())
+	}
+
+	return path, f.Close()
+}
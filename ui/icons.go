@@ -4,6 +4,8 @@ const (
 	trackIconEmptyText   = "  "
 	trackIconPlayingText = "🔈"
 	trackIconPausedText  = "🔇"
+	// selected tracks are batch edited
+	trackIconSelectedText = "✓ "
 
 	shuffleIconOff = " "
 	shuffleIconOn  = "🔀"
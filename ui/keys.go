@@ -0,0 +1,457 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell"
+	log "github.com/sirupsen/logrus"
+)
+
+// Action is something that can be bound to a key
+type Action string
+
+// Actions that can be bound to keys
+const (
+	ActionLogs          Action = "logs"
+	ActionTracks        Action = "tracks"
+	ActionHistory       Action = "history"
+	ActionExportJSON    Action = "export-history-json"
+	ActionExportCSV     Action = "export-history-csv"
+	ActionHelp          Action = "help"
+	ActionQuit          Action = "quit"
+	ActionDescribeHover Action = "describe-hovered"
+	ActionSearch        Action = "search"
+	ActionSort          Action = "sort"
+	ActionSortReverse   Action = "sort-reverse"
+	ActionColumns       Action = "columns"
+	ActionPathTags      Action = "tags-from-path"
+	ActionPathTagsSave  Action = "tags-from-path-save"
+	ActionPathTagsFill  Action = "tags-from-path-fill"
+	ActionSelect        Action = "select"
+	ActionSelectRange   Action = "select-range"
+	ActionSelectAll     Action = "select-all"
+	ActionSelectNone    Action = "select-none"
+	ActionEditSelected  Action = "edit-selected"
+	ActionTrash         Action = "trash"
+	ActionTrashRestore  Action = "trash-restore"
+	ActionTrashPurge    Action = "trash-purge"
+	ActionUndoDelete    Action = "undo-delete"
+	ActionPause         Action = "pause"
+	ActionStop          Action = "stop"
+	ActionDescribe      Action = "describe"
+	ActionEdit          Action = "edit"
+	ActionDelete        Action = "delete"
+	ActionSeekBackward  Action = "seek-backward"
+	ActionSeekForward   Action = "seek-forward"
+	ActionNext          Action = "next"
+	ActionPrev          Action = "prev"
+	ActionVolumeUp      Action = "volume-up"
+	ActionVolumeDown    Action = "volume-down"
+	ActionShuffle       Action = "shuffle"
+	ActionSpeedUp       Action = "speed-up"
+	ActionSpeedDown     Action = "speed-down"
+	ActionRate00        Action = "rate-0"
+	ActionRate05        Action = "rate-0.5"
+	ActionRate10        Action = "rate-1"
+	ActionRate15        Action = "rate-1.5"
+	ActionRate20        Action = "rate-2"
+	ActionRate25        Action = "rate-2.5"
+	ActionRate30        Action = "rate-3"
+	ActionRate35        Action = "rate-3.5"
+	ActionRate40        Action = "rate-4"
+	ActionRate45        Action = "rate-4.5"
+	ActionRate50        Action = "rate-5"
+)
+
+// actionScope is where an action can be triggered from. Most scopes are
+// active on the track page at once, so keys must be unique across all of them.
+type actionScope int
+
+const (
+	// scopeGlobal actions work on every page
+	scopeGlobal actionScope = iota
+	// scopeTracks actions work on the track page
+	scopeTracks
+	// scopePlaying actions work on the track page while a track is playing
+	scopePlaying
+	// scopeHistory actions work on the history page
+	scopeHistory
+	// scopePathTags actions work on the tags from paths page
+	scopePathTags
+	// scopeTrash actions work on the trash page
+	scopeTrash
+)
+
+// actionInfo describes an action and its default keys
+type actionInfo struct {
+	action      Action
+	description string
+	scope       actionScope
+	keys        []string
+}
+
+// actions lists every bindable action, in the order shown on the help page
+var actions = []actionInfo{
+	{ActionPause, "pause/unpause", scopePlaying, []string{"space"}},
+	{ActionStop, "stop track", scopePlaying, []string{"esc"}},
+	{ActionDescribe, "describe currently playing track", scopePlaying, []string{"d"}},
+	{ActionDescribeHover, "describe selected track", scopeTracks, []string{"D"}},
+	{ActionEdit, "edit currently playing track", scopePlaying, []string{"e"}},
+	{ActionDelete, "delete currently playing track (with prompt)", scopePlaying, []string{"delete"}},
+	{ActionUndoDelete, "restore the last deleted track", scopeTracks, []string{"u"}},
+	{ActionSearch, "search tracks (enter to keep, escape to clear)", scopeTracks, []string{"/"}},
+	{ActionSort, "sort by next column", scopeTracks, []string{"o"}},
+	{ActionSortReverse, "reverse sort order", scopeTracks, []string{"O"}},
+	{ActionColumns, "switch column set", scopeTracks, []string{"c"}},
+	{ActionPathTags, "fill in missing tags from file paths", scopeTracks, []string{"P"}},
+	{ActionPathTagsSave, "save tags from paths to files (tags page)", scopePathTags, []string{"W"}},
+	{ActionPathTagsFill, "fill in tags from paths, display only (tags page)", scopePathTags, []string{"F"}},
+	{ActionSelect, "select/deselect hovered track", scopeTracks, []string{"v"}},
+	{ActionSelectRange, "select from last selected to hovered track", scopeTracks, []string{"V"}},
+	{ActionSelectAll, "select/deselect all tracks matching search", scopeTracks, []string{"ctrl+a"}},
+	{ActionSelectNone, "clear selection", scopeTracks, []string{"U"}},
+	{ActionEditSelected, "edit tags of selected tracks", scopeTracks, []string{"E"}},
+	{ActionSeekBackward, "seek backward (does not work on flac)", scopePlaying, []string{"left"}},
+	{ActionSeekForward, "seek forward (does not work on flac)", scopePlaying, []string{"right"}},
+	{ActionNext, "play next track", scopePlaying, []string{"]"}},
+	{ActionPrev, "play previous track", scopePlaying, []string{"["}},
+	{ActionVolumeUp, "volume up", scopePlaying, []string{"="}},
+	{ActionVolumeDown, "volume down", scopePlaying, []string{"-"}},
+	{ActionShuffle, "toggle shuffle", scopePlaying, []string{"S"}},
+	{ActionSpeedUp, "speed up", scopePlaying, []string{"+"}},
+	{ActionSpeedDown, "speed down", scopePlaying, []string{"_"}},
+	{ActionLogs, "view logs page", scopeGlobal, []string{"l"}},
+	{ActionTracks, "view tracks page", scopeGlobal, []string{"t"}},
+	{ActionHistory, "view listening history", scopeGlobal, []string{"h"}},
+	{ActionExportJSON, "export listening history as JSON (history page)", scopeHistory, []string{"J"}},
+	{ActionExportCSV, "export listening history as CSV (history page)", scopeHistory, []string{"C"}},
+	{ActionTrash, "view deleted tracks", scopeGlobal, []string{"T"}},
+	{ActionTrashRestore, "restore deleted track (trash page)", scopeTrash, []string{"R"}},
+	{ActionTrashPurge, "delete track for good (trash page)", scopeTrash, []string{"X"}},
+	{ActionHelp, "view this help page", scopeGlobal, []string{"?"}},
+	{ActionQuit, "quit", scopeGlobal, []string{"q"}},
+	{ActionRate00, "set rating of currently playing track to " + Score00, scopePlaying, []string{"0"}},
+	{ActionRate05, "set rating of currently playing track to " + Score05, scopePlaying, []string{")"}},
+	{ActionRate10, "set rating of currently playing track to " + Score10, scopePlaying, []string{"1"}},
+	{ActionRate15, "set rating of currently playing track to " + Score15, scopePlaying, []string{"!"}},
+	{ActionRate20, "set rating of currently playing track to " + Score20, scopePlaying, []string{"2"}},
+	{ActionRate25, "set rating of currently playing track to " + Score25, scopePlaying, []string{"@"}},
+	{ActionRate30, "set rating of currently playing track to " + Score30, scopePlaying, []string{"3"}},
+	{ActionRate35, "set rating of currently playing track to " + Score35, scopePlaying, []string{"#"}},
+	{ActionRate40, "set rating of currently playing track to " + Score40, scopePlaying, []string{"4"}},
+	{ActionRate45, "set rating of currently playing track to " + Score45, scopePlaying, []string{"$"}},
+	{ActionRate50, "set rating of currently playing track to " + Score50, scopePlaying, []string{"5"}},
+}
+
+// rateActions maps rating actions to the score they set
+var rateActions = map[Action]string{
+	ActionRate00: Score00,
+	ActionRate05: Score05,
+	ActionRate10: Score10,
+	ActionRate15: Score15,
+	ActionRate20: Score20,
+	ActionRate25: Score25,
+	ActionRate30: Score30,
+	ActionRate35: Score35,
+	ActionRate40: Score40,
+	ActionRate45: Score45,
+	ActionRate50: Score50,
+}
+
+// keyMap binds keys to actions
+type keyMap struct {
+	// keys holds the keys bound to each action, in canonical form
+	keys map[Action][]string
+	// bound maps a canonical key to its action
+	bound map[string]actionInfo
+}
+
+// bindings is the active key map, see keyBindings()
+var bindings *keyMap
+
+// keyBindings returns the active key map, falling back to the default
+// bindings when the ui was started without one (eg: in tests)
+func keyBindings() *keyMap {
+	if bindings == nil {
+		bindings, _ = newKeyMap(nil)
+	}
+
+	return bindings
+}
+
+// newKeyMap creates a key map from the default bindings and user overrides.
+// Overrides map action names to one or more space separated keys, "none"
+// unbinds an action. A usable key map is always returned; the error describes
+// any overrides that were ignored.
+func newKeyMap(overrides map[string]string) (*keyMap, error) {
+	km := &keyMap{
+		keys:  map[Action][]string{},
+		bound: map[string]actionInfo{},
+	}
+
+	problems := []string{}
+
+	// user bindings are applied first so they win any conflict with a default
+	overridden := map[Action]bool{}
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		info, ok := actionByName(name)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown action [%s]", name))
+			continue
+		}
+
+		keys, err := parseKeys(overrides[name])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("action [%s]: %s", name, err.Error()))
+			continue
+		}
+
+		overridden[info.action] = true
+		for _, key := range keys {
+			if err := km.bind(info, key); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+
+	for _, info := range actions {
+		if overridden[info.action] {
+			continue
+		}
+
+		for _, key := range info.keys {
+			// defaults are all valid, so only conflicts are reported
+			k, _ := parseKey(key)
+			if err := km.bind(info, k); err != nil {
+				problems = append(problems, err.Error()+", default binding removed")
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return km, fmt.Errorf("could not apply keyboard shortcuts: [%s]", strings.Join(problems, "; "))
+	}
+
+	return km, nil
+}
+
+// bind adds a key to an action, failing if the key is already taken
+func (km *keyMap) bind(info actionInfo, key string) error {
+	if other, ok := km.bound[key]; ok {
+		return fmt.Errorf("key [%s] for action [%s] is already bound to [%s]", key, info.action, other.action)
+	}
+
+	km.bound[key] = info
+	km.keys[info.action] = append(km.keys[info.action], key)
+
+	return nil
+}
+
+// action returns the action bound to a key event if it belongs to scope, or
+// "" if there is none
+func (km *keyMap) action(event *tcell.EventKey, scope actionScope) Action {
+	info, ok := km.bound[eventKey(event)]
+	if !ok || info.scope != scope {
+		return ""
+	}
+
+	return info.action
+}
+
+// keysFor returns the keys bound to an action
+func (km *keyMap) keysFor(a Action) []string {
+	return km.keys[a]
+}
+
+// actionByName looks up an action, ignoring case
+func actionByName(name string) (actionInfo, bool) {
+	for _, info := range actions {
+		if strings.EqualFold(string(info.action), name) {
+			return info, true
+		}
+	}
+
+	return actionInfo{}, false
+}
+
+// namedKeys maps lowercase key names to tcell keys
+var namedKeys = map[string]tcell.Key{}
+
+// keyAliases are alternative key names accepted in config
+var keyAliases = map[string]string{
+	"escape":     "esc",
+	"return":     "enter",
+	"del":        "delete",
+	"backspace2": "backspace",
+	"pageup":     "pgup",
+	"pagedown":   "pgdn",
+}
+
+func init() {
+	for k, name := range tcell.KeyNames {
+		if strings.HasPrefix(name, "Ctrl-") {
+			continue
+		}
+		namedKeys[strings.ToLower(name)] = k
+	}
+}
+
+// parseKeys parses a space separated list of keys
+func parseKeys(s string) ([]string, error) {
+	if strings.EqualFold(strings.TrimSpace(s), "none") {
+		return []string{}, nil
+	}
+
+	keys := []string{}
+	for _, field := range strings.Fields(s) {
+		k, err := parseKey(field)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys given")
+	}
+
+	return keys, nil
+}
+
+// parseKey converts a key description into canonical form: modifiers in the
+// order ctrl, alt, shift followed by a single character or lowercase key name,
+// eg: "Ctrl+Alt+x", "shift+Left", "escape" become "ctrl+alt+x", "shift+left"
+// and "esc". Shift on a letter becomes the uppercase letter.
+func parseKey(s string) (string, error) {
+	var ctrl, alt, shift bool
+
+	rest := s
+	for {
+		i := strings.Index(rest, "+")
+		// a trailing or lone "+" is the plus key itself
+		if i <= 0 || i == len(rest)-1 {
+			break
+		}
+
+		switch strings.ToLower(rest[:i]) {
+		case "ctrl":
+			ctrl = true
+		case "alt":
+			alt = true
+		case "shift":
+			shift = true
+		default:
+			return "", fmt.Errorf("unknown modifier [%s] in key [%s]", rest[:i], s)
+		}
+		rest = rest[i+1:]
+	}
+
+	if rest == "" {
+		return "", fmt.Errorf("empty key")
+	}
+
+	base := ""
+	if utf8.RuneCountInString(rest) == 1 {
+		r, _ := utf8.DecodeRuneInString(rest)
+		switch {
+		case shift && unicode.IsLetter(r):
+			r = unicode.ToUpper(r)
+			shift = false
+		case shift:
+			return "", fmt.Errorf("use the shifted character instead of [%s]", s)
+		case ctrl && unicode.IsLetter(r):
+			// ctrl letters are sent without case
+			r = unicode.ToLower(r)
+		}
+		base = string(r)
+	} else {
+		name := strings.ToLower(rest)
+		if alias, ok := keyAliases[name]; ok {
+			name = alias
+		}
+		if _, ok := namedKeys[name]; !ok && name != "space" {
+			return "", fmt.Errorf("unknown key [%s]", s)
+		}
+		base = name
+	}
+
+	if base == " " {
+		base = "space"
+	}
+
+	return withModifiers(ctrl, alt, shift, base), nil
+}
+
+// eventKey converts a key event into the canonical form used by parseKey
+func eventKey(event *tcell.EventKey) string {
+	mod := event.Modifiers()
+	ctrl := mod&tcell.ModCtrl != 0
+	alt := mod&tcell.ModAlt != 0
+	shift := mod&tcell.ModShift != 0
+
+	k := event.Key()
+	base := ""
+	switch {
+	case k == tcell.KeyRune:
+		// the rune is already shifted
+		shift = false
+		base = string(event.Rune())
+		if base == " " {
+			base = "space"
+		}
+	case k >= tcell.KeyCtrlA && k <= tcell.KeyCtrlZ && (ctrl || !typeable(k)):
+		ctrl = true
+		base = string(rune('a' + k - tcell.KeyCtrlA))
+	case k == tcell.KeyBackspace2:
+		base = "backspace"
+	default:
+		base = strings.ToLower(tcell.KeyNames[k])
+	}
+
+	return withModifiers(ctrl, alt, shift, base)
+}
+
+// typeable returns true for control keys that have their own key on a
+// keyboard
+func typeable(k tcell.Key) bool {
+	switch k {
+	case tcell.KeyBackspace, tcell.KeyTab, tcell.KeyEnter:
+		return true
+	}
+
+	return false
+}
+
+func withModifiers(ctrl, alt, shift bool, base string) string {
+	s := ""
+	if ctrl {
+		s += "ctrl+"
+	}
+	if alt {
+		s += "alt+"
+	}
+	if shift {
+		s += "shift+"
+	}
+
+	return s + base
+}
+
+// setupKeys builds the active key map from config
+func setupKeys(overrides map[string]string) {
+	km, err := newKeyMap(overrides)
+	if err != nil {
+		log.WithError(err).Warn("some keyboard shortcuts were ignored")
+	}
+	bindings = km
+}
@@ -0,0 +1,112 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKey(t *testing.T) {
+	var tests = []struct {
+		in       string
+		expected string
+		err      bool
+	}{
+		{"esc", "esc", false},
+		{"Escape", "esc", false},
+		{"o", "o", false},
+		{"shift+o", "O", false},
+		{"Ctrl+X", "ctrl+x", false},
+		{"shift+alt+Left", "alt+shift+left", false},
+		{"+", "+", false},
+		{"ctrl++", "ctrl++", false},
+		{"space", "space", false},
+		{"F5", "f5", false},
+		{"hyper+x", "", true},
+		{"shift+1", "", true},
+		{"nope", "", true},
+	}
+
+	for _, test := range tests {
+		k, err := parseKey(test.in)
+		if test.err {
+			assert.Error(t, err, test.in)
+			continue
+		}
+
+		if assert.NoError(t, err, test.in) {
+			assert.Equal(t, test.expected, k, test.in)
+		}
+	}
+}
+
+func TestEventKey(t *testing.T) {
+	var tests = []struct {
+		event    *tcell.EventKey
+		expected string
+	}{
+		{tcell.NewEventKey(tcell.KeyRune, 'O', tcell.ModNone), "O"},
+		{tcell.NewEventKey(tcell.KeyRune, 'O', tcell.ModShift), "O"},
+		{tcell.NewEventKey(tcell.KeyRune, ' ', tcell.ModNone), "space"},
+		{tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModAlt), "alt+x"},
+		{tcell.NewEventKey(tcell.KeyRune, 0x18, tcell.ModNone), "ctrl+x"},
+		{tcell.NewEventKey(tcell.KeyLeft, 0, tcell.ModShift), "shift+left"},
+		{tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone), "enter"},
+		{tcell.NewEventKey(tcell.KeyEsc, 0, tcell.ModNone), "esc"},
+		{tcell.NewEventKey(tcell.KeyBackspace2, 0, tcell.ModNone), "backspace"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, eventKey(test.event), test.event.Name())
+	}
+}
+
+func TestNewKeyMap(t *testing.T) {
+	km, err := newKeyMap(map[string]string{
+		"next":     "n ctrl+n",
+		"quit":     "none",
+		"describe": "q",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, ActionNext, km.action(tcell.NewEventKey(tcell.KeyRune, 'n', tcell.ModNone), scopePlaying))
+	assert.Equal(t, ActionNext, km.action(tcell.NewEventKey(tcell.KeyCtrlN, 0, tcell.ModCtrl), scopePlaying))
+	assert.Equal(t, ActionDescribe, km.action(tcell.NewEventKey(tcell.KeyRune, 'q', tcell.ModNone), scopePlaying))
+	assert.Empty(t, km.keysFor(ActionQuit))
+
+	// the default key no longer does anything
+	assert.Equal(t, Action(""), km.action(tcell.NewEventKey(tcell.KeyRune, ']', tcell.ModNone), scopePlaying))
+
+	// actions only fire in their own scope
+	assert.Equal(t, Action(""), km.action(tcell.NewEventKey(tcell.KeyRune, 'n', tcell.ModNone), scopeGlobal))
+}
+
+func TestNewKeyMapConflicts(t *testing.T) {
+	km, err := newKeyMap(map[string]string{
+		"next":  "d",
+		"prev":  "d",
+		"bogus": "x",
+		"pause": "hyper+p",
+	})
+	assert.Error(t, err)
+
+	// the first override wins, and takes the key from the default binding
+	assert.Equal(t, []string{"d"}, km.keysFor(ActionNext))
+	assert.Empty(t, km.keysFor(ActionPrev))
+	assert.Empty(t, km.keysFor(ActionDescribe))
+
+	// invalid overrides keep the default
+	assert.Equal(t, []string{"space"}, km.keysFor(ActionPause))
+}
+
+func TestKeyboardShortcuts(t *testing.T) {
+	km, err := newKeyMap(nil)
+	require.NoError(t, err)
+
+	kb := keyboardShortcuts(km)
+	assert.Len(t, kb, len(actions))
+	assert.Contains(t, kb, KeyboardShortcut{"left", "seek backward (does not work on flac)"})
+	assert.Contains(t, kb, KeyboardShortcut{"right", "seek forward (does not work on flac)"})
+}
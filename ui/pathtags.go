@@ -0,0 +1,215 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dhulihan/grump/internal/config"
+	"github.com/dhulihan/grump/library"
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+	log "github.com/sirupsen/logrus"
+)
+
+// pathProposal is a track with tags filled in from its path
+type pathProposal struct {
+	prev    library.Track
+	track   library.Track
+	changed []library.Field
+}
+
+// PathTagsPage previews tags read from file paths and applies them, either
+// by saving them to the files or only filling them in for display
+type PathTagsPage struct {
+	tracks    *TrackPage
+	proposals []pathProposal
+
+	input  *tview.InputField
+	table  *tview.Table
+	bottom *tview.TextView
+}
+
+// NewPathTagsPage creates the page for filling in tags of tracks
+func NewPathTagsPage(ctx context.Context, tracks *TrackPage) *PathTagsPage {
+	pattern := cfg().PathPattern
+	if pattern == "" {
+		pattern = library.DefaultPathPattern
+	}
+
+	return &PathTagsPage{
+		tracks: tracks,
+		input:  tview.NewInputField().SetLabel("Pattern: ").SetText(pattern),
+		table:  tview.NewTable().SetFixed(1, 0).SetSelectable(true, false),
+		bottom: tview.NewTextView(),
+	}
+}
+
+// Page populates the layout for the page
+func (p *PathTagsPage) Page(ctx context.Context) tview.Primitive {
+	p.input.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEnter, tcell.KeyTab:
+			p.refresh()
+			app.SetFocus(p.table)
+		case tcell.KeyEscape:
+			pages.SwitchToPage("tracks")
+		}
+	})
+	p.input.SetBorder(true).SetBorderColor(theme.BorderColor)
+
+	p.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		globalInputCapture(event)
+
+		switch keyBindings().action(event, scopePathTags) {
+		case ActionPathTagsSave:
+			p.save(ctx)
+			return nil
+		case ActionPathTagsFill:
+			p.fill()
+			return nil
+		}
+
+		switch event.Key() {
+		case tcell.KeyTab:
+			app.SetFocus(p.input)
+			return nil
+		case tcell.KeyESC:
+			pages.SwitchToPage("tracks")
+		}
+
+		return event
+	})
+	p.table.SetBorder(true).SetTitle("Tags From Paths").SetBorderColor(theme.BorderColor)
+
+	main := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(p.input, 3, 0, false).
+		AddItem(p.table, 0, 6, true).
+		AddItem(p.bottom, 1, 0, false)
+
+	return tview.NewFlex().AddItem(main, 0, 3, true)
+}
+
+// open shows the page with proposals for the current pattern
+func (p *PathTagsPage) open() {
+	p.refresh()
+	pages.SwitchToPage("pathtags")
+	app.SetFocus(p.input)
+}
+
+// help describes the page's keys in the bottom bar
+func (p *PathTagsPage) help() {
+	p.bottom.SetText(fmt.Sprintf("%d tracks. Enter previews, tab switches. %s save to files, %s fill in for display only.",
+		len(p.proposals),
+		strings.Join(keyBindings().keysFor(ActionPathTagsSave), ", "),
+		strings.Join(keyBindings().keysFor(ActionPathTagsFill), ", ")))
+}
+
+// refresh parses the pattern and previews what it would fill in
+func (p *PathTagsPage) refresh() {
+	p.table.Clear()
+	p.proposals = nil
+
+	pattern, err := library.ParsePathPattern(p.input.GetText())
+	if err != nil {
+		p.bottom.SetText(err.Error())
+		return
+	}
+	p.proposals = pathProposals(p.tracks.tracks, pattern)
+
+	fields := pattern.Fields()
+	p.table.SetCell(0, 0, &tview.TableCell{Text: "File", Color: theme.TitleColor, NotSelectable: true})
+	for i, f := range fields {
+		c, _ := newColumn(config.ColumnConfig{Name: string(f)})
+		p.table.SetCell(0, i+1, &tview.TableCell{Text: c.title, Color: theme.TitleColor, NotSelectable: true})
+	}
+
+	for i, proposal := range p.proposals {
+		row := i + 1
+		p.table.SetCell(row, 0, &tview.TableCell{Text: filepath.Base(proposal.track.Path), Color: theme.BorderColor, MaxWidth: 40})
+		for j, f := range fields {
+			// tags the file already has are kept, and shown dimmed
+			color := theme.BorderColor
+			if fieldIn(f, proposal.changed) {
+				color = theme.PrimaryTextColor
+			}
+			p.table.SetCell(row, j+1, &tview.TableCell{Text: f.Text(proposal.track), Color: color, MaxWidth: 30, Expansion: 1})
+		}
+	}
+
+	p.table.Select(1, 0).ScrollToBeginning()
+	p.help()
+}
+
+// pathProposals returns the tracks a pattern would fill in tags for
+func pathProposals(tracks []library.Track, pattern *library.PathPattern) []pathProposal {
+	proposals := []pathProposal{}
+	for _, track := range tracks {
+		proposed, changed := pattern.Propose(track)
+		if len(changed) == 0 {
+			continue
+		}
+		proposals = append(proposals, pathProposal{prev: track, track: proposed, changed: changed})
+	}
+	return proposals
+}
+
+// fill shows proposed tags on the track list only. The tracks keep their own
+// tags, so nothing filled in is written by a later save.
+func (p *PathTagsPage) fill() {
+	pattern, err := library.ParsePathPattern(p.input.GetText())
+	if err != nil {
+		p.bottom.SetText(err.Error())
+		return
+	}
+
+	p.tracks.pathFill = pattern
+	p.tracks.renderTracks()
+
+	log.WithField("count", len(p.proposals)).Info("filled in tags from paths for display")
+	p.bottom.SetText(fmt.Sprintf("Filled in %d tracks for display, no files were changed.", len(p.proposals)))
+}
+
+// save writes proposed tags to the files in the background
+func (p *PathTagsPage) save(ctx context.Context) {
+	proposals := p.proposals
+	p.bottom.SetText(fmt.Sprintf("Saving %d tracks...", len(proposals)))
+
+	go func() {
+		failed := 0
+		for _, proposal := range proposals {
+			prev, track := proposal.prev, proposal.track
+			saved, err := p.tracks.shelf.SaveTrack(ctx, &prev, &track)
+			if err != nil {
+				log.WithError(err).WithField("path", track.Path).Error("could not save tags from path")
+				failed++
+				continue
+			}
+
+			app.QueueUpdateDraw(func() {
+				if i := p.tracks.trackIndex(saved.Path); i >= 0 {
+					p.tracks.replaceTrack(i, *saved)
+				}
+			})
+		}
+
+		app.QueueUpdateDraw(func() {
+			p.refresh()
+			msg := fmt.Sprintf("Saved %d tracks.", len(proposals)-failed)
+			if failed > 0 {
+				msg += fmt.Sprintf(" %d could not be saved, see logs.", failed)
+			}
+			p.bottom.SetText(msg)
+		})
+	}()
+}
+
+func fieldIn(f library.Field, fields []library.Field) bool {
+	for _, g := range fields {
+		if f == g {
+			return true
+		}
+	}
+	return false
+}
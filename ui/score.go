@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"github.com/dhulihan/grump/library"
 	"github.com/gdamore/tcell"
 )
 
@@ -22,17 +23,19 @@ const (
 	Score45 = "🌕🌕🌕🌕🌗"
 	Score50 = "🌕🌕🌕🌕🌕"
 
-	// mapping of track uint8 ratings to human friendly scores
+	// ratings of each score. ratings are spread evenly over 0-255, files
+	// that store them differently (eg: ID3 POPM) are mapped by the library's
+	// rating profile.
 	Rating00 = 0
-	Rating05 = 13
-	Rating10 = 1
-	Rating15 = 54
-	Rating20 = 64
-	Rating25 = 118
-	Rating30 = 128
-	Rating35 = 186
-	Rating40 = 196
-	Rating45 = 242
+	Rating05 = 26
+	Rating10 = 51
+	Rating15 = 77
+	Rating20 = 102
+	Rating25 = 128
+	Rating30 = 153
+	Rating35 = 179
+	Rating40 = 204
+	Rating45 = 230
 	Rating50 = 255
 )
 
@@ -52,36 +55,17 @@ var (
 	}
 )
 
-// Score returns a human-friendly rating string and color. It clamsp 0-255 to a
-// 0-5 rating string (think 5 stars).
+// Score returns a human-friendly rating string. It clamps 0-255 to a 0-5
+// rating string (think 5 stars).
 func Score(rating uint8) string {
-	switch {
-	case rating == Rating00:
-		return Score00
-	case rating <= Rating10:
-		return Score10
-	// yes this is bizarre
-	case rating <= Rating05:
-		return Score05
-	case rating <= Rating15:
-		return Score15
-	case rating <= Rating20:
-		return Score20
-	case rating <= Rating25:
-		return Score25
-	case rating <= Rating30:
-		return Score30
-	case rating <= Rating35:
-		return Score35
-	case rating <= Rating40:
-		return Score40
-	case rating <= Rating45:
-		return Score45
-	case rating <= ratingMax:
-		return Score50
-	default:
-		return Score00
-	}
+	return Scores[int(Stars(rating)*2)]
+}
+
+// Stars returns the score of a rating as a number of stars, in half-star
+// steps. It can be used as library.SearchOptions.Stars so searches use the
+// same scale as the rating column.
+func Stars(rating uint8) float64 {
+	return library.LinearStars(rating)
 }
 
 // ScoreColor returns a color for the score
@@ -128,30 +112,9 @@ func ScoreColor(score string) tcell.Color {
 
 // Rating converts a human-friendly score value to a rating
 func Rating(score string) uint8 {
-	switch score {
-	case Score00:
-		return Rating00
-	case Score05:
-		return Rating05
-	case Score10:
-		return Rating10
-	case Score15:
-		return Rating15
-	case Score20:
-		return Rating20
-	case Score25:
-		return Rating25
-	case Score30:
-		return Rating30
-	case Score35:
-		return Rating35
-	case Score40:
-		return Rating40
-	case Score45:
-		return Rating45
-	case Score50:
-		return Rating50
-	default:
+	i := indexOf(Scores, score)
+	if i < 0 {
 		return Rating00
 	}
+	return library.StarsRating(float64(i) / 2)
 }
@@ -14,15 +14,15 @@ func TestScore(t *testing.T) {
 		err    error
 	}{
 		{ui.Score00, 0, nil},
-		{ui.Score05, 13, nil},
-		{ui.Score10, 1, nil},
-		{ui.Score15, 54, nil},
-		{ui.Score20, 64, nil},
-		{ui.Score25, 118, nil},
-		{ui.Score30, 128, nil},
-		{ui.Score35, 186, nil},
-		{ui.Score40, 196, nil},
-		{ui.Score45, 242, nil},
+		{ui.Score05, 26, nil},
+		{ui.Score10, 51, nil},
+		{ui.Score15, 77, nil},
+		{ui.Score20, 102, nil},
+		{ui.Score25, 128, nil},
+		{ui.Score30, 153, nil},
+		{ui.Score35, 179, nil},
+		{ui.Score40, 204, nil},
+		{ui.Score45, 230, nil},
 		{ui.Score50, 255, nil},
 	}
 
@@ -59,15 +59,15 @@ func TestRating(t *testing.T) {
 		err    error
 	}{
 		{ui.Score00, 0, nil},
-		{ui.Score05, 13, nil},
-		{ui.Score10, 1, nil},
-		{ui.Score15, 54, nil},
-		{ui.Score20, 64, nil},
-		{ui.Score25, 118, nil},
-		{ui.Score30, 128, nil},
-		{ui.Score35, 186, nil},
-		{ui.Score40, 196, nil},
-		{ui.Score45, 242, nil},
+		{ui.Score05, 26, nil},
+		{ui.Score10, 51, nil},
+		{ui.Score15, 77, nil},
+		{ui.Score20, 102, nil},
+		{ui.Score25, 128, nil},
+		{ui.Score30, 153, nil},
+		{ui.Score35, 179, nil},
+		{ui.Score40, 204, nil},
+		{ui.Score45, 230, nil},
 		{ui.Score50, 255, nil},
 	}
 
@@ -78,3 +78,23 @@ func TestRating(t *testing.T) {
 		}
 	}
 }
+
+func TestStars(t *testing.T) {
+	var tests = []struct {
+		rating uint8
+		stars  float64
+	}{
+		{ui.Rating00, 0},
+		{ui.Rating05, 0.5},
+		{ui.Rating10, 1},
+		{ui.Rating35, 3.5},
+		{ui.Rating50, 5},
+	}
+
+	for _, test := range tests {
+		stars := ui.Stars(test.rating)
+		if stars != test.stars {
+			t.Errorf("for %d, wanted %.1f, got %.1f", test.rating, test.stars, stars)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dhulihan/grump/library"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// sort keys beyond this many are dropped when changing the primary sort
+	maxSortKeys = 4
+
+	sortIconAscending  = "▲"
+	sortIconDescending = "▼"
+)
+
+// defaultSort returns the sort keys from config, if any
+func defaultSort() []library.SortKey {
+	keys, err := library.ParseSortKeys(cfg().Sort)
+	if err != nil {
+		log.WithError(err).Warn("could not parse sort from config, using library order")
+		return nil
+	}
+
+	return keys
+}
+
+// cycleSort makes the next displayed column the primary sort key. The
+// previous keys are kept as tie-breakers. After the last column the default
+// sort is restored.
+func (t *TrackPage) cycleSort() {
+	columns := t.columns()
+
+	next := 0
+	if len(t.sortKeys) > 0 {
+		for i, c := range columns {
+			if c.field == t.sortKeys[0].Field {
+				next = i + 1
+				break
+			}
+		}
+	}
+
+	if next >= len(columns) {
+		t.setSort(t.defaultSort)
+		return
+	}
+
+	keys := []library.SortKey{{Field: columns[next].field}}
+	for _, k := range t.sortKeys {
+		if k.Field != keys[0].Field && len(keys) < maxSortKeys {
+			keys = append(keys, k)
+		}
+	}
+
+	t.setSort(keys)
+}
+
+// reverseSort flips the direction of the primary sort key
+func (t *TrackPage) reverseSort() {
+	if len(t.sortKeys) == 0 {
+		log.Info("tracks are not sorted, press o to sort")
+		return
+	}
+
+	keys := append([]library.SortKey{}, t.sortKeys...)
+	keys[0].Descending = !keys[0].Descending
+	t.setSort(keys)
+}
+
+// setSort reorders the track list. No keys restores library (path) order.
+func (t *TrackPage) setSort(keys []library.SortKey) {
+	t.sortKeys = keys
+	t.sortTracks()
+	t.renderTracks()
+
+	log.WithField("sort", t.sortDescription()).Info("sorted tracks")
+}
+
+// sortTracks orders the track cache by the active sort keys
+func (t *TrackPage) sortTracks() {
+	if len(t.sortKeys) == 0 {
+		library.SortTracks(t.tracks, library.SortKey{Field: library.FieldPath})
+		return
+	}
+
+	library.SortTracks(t.tracks, t.sortKeys...)
+}
+
+// sortIndicator returns the header suffix for a sorted field, eg: " ▲" or
+// " ▼2" when sorting by several keys.
+func (t *TrackPage) sortIndicator(field library.Field) string {
+	for i, k := range t.sortKeys {
+		if k.Field != field {
+			continue
+		}
+
+		icon := sortIconAscending
+		if k.Descending {
+			icon = sortIconDescending
+		}
+
+		if len(t.sortKeys) == 1 {
+			return " " + icon
+		}
+		return fmt.Sprintf(" %s%d", icon, i+1)
+	}
+
+	return ""
+}
+
+// sortDescription lists every sort key, eg: "albumartist ▲, year ▼"
+func (t *TrackPage) sortDescription() string {
+	if len(t.sortKeys) == 0 {
+		return "path " + sortIconAscending
+	}
+
+	parts := make([]string, len(t.sortKeys))
+	for i, k := range t.sortKeys {
+		icon := sortIconAscending
+		if k.Descending {
+			icon = sortIconDescending
+		}
+		parts[i] = string(k.Field) + " " + icon
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package ui
+
+import (
+	"errors"
+	"os"
+)
+
+func openTerminal() (*os.File, error) {
+	return nil, errors.New("graphics protocols are not supported on this platform")
+}
+
+func terminalCellSize(f *os.File) (int, int) {
+	return 10, 20
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package ui
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openTerminal opens the terminal tcell draws to, for writing graphics
+// escapes that tcell does not know about
+func openTerminal() (*os.File, error) {
+	return os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+}
+
+// terminalCellSize returns the size of a character cell in pixels, guessing
+// if the terminal does not report it
+func terminalCellSize(f *os.File) (int, int) {
+	ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 || ws.Xpixel == 0 || ws.Ypixel == 0 {
+		return 10, 20
+	}
+
+	return int(ws.Xpixel / ws.Col), int(ws.Ypixel / ws.Row)
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"os"
 	"runtime"
 	"time"
 
+	"github.com/dhulihan/grump/internal/config"
 	"github.com/dhulihan/grump/library"
 	"github.com/dhulihan/grump/player"
 	"github.com/gdamore/tcell"
@@ -21,15 +23,12 @@ func init() {
 type trackTarget int
 
 const (
-	columnStatus = iota
-	columnArtist
-	columnAlbum
-	columnTrack
-	columnRating
-
 	// check audio progess at this interval
 	checkAudioMillis = 500
 
+	// redraw scan progress at most this often
+	scanProgressMillis = 100
+
 	// track target types
 	playing trackTarget = iota
 	hovered
@@ -40,19 +39,57 @@ const (
 // TrackPage is a page that displays playable audio tracks
 type TrackPage struct {
 	// TODO: extract this to a something ui-agnostic
-	shelf                      library.AudioShelf
-	tracks                     []library.Track
+	shelf  library.AudioShelf
+	tracks []library.Track
+	// visible maps table rows to indexes in tracks. Row r shows
+	// tracks[visible[r-1]].
+	visible                    []int
+	filter                     library.Predicate
+	sortKeys                   []library.SortKey
+	defaultSort                []library.SortKey
+	columnSets                 []columnSet
+	columnSet                  int
 	player                     player.AudioPlayer
 	currentlyPlayingController player.AudioController
 	currentlyPlayingTrack      *library.Track
 	currentlyPlayingRow        int
 	shuffle                    bool
+	loading                    bool
+	scanProgress               library.ScanProgress
+
+	// heard is how much of the playing track has been listened to, not
+	// counting seeks. lastElapsed is its position at the last check.
+	heard       time.Duration
+	lastElapsed time.Duration
+	playCounted bool
+
+	// history records plays, play is the entry for the playing track
+	history *library.History
+	trash   *library.Trash
+	// deleted are the paths of tracks deleted this session, for undo
+	deleted     []string
+	play        *library.Play
+	speed       float64
+	shufflePick bool
+
+	// tracks selected for batch editing, by path
+	selected     map[string]bool
+	selectAnchor string
+	batch        *batchEdit
+
+	// pathFill fills in empty tags from paths where tracks are shown. The
+	// tracks themselves are left alone, so the guesses are never saved.
+	pathFill *library.PathPattern
 
 	// layout
 	left         *tview.List
 	center       *tview.Flex
+	main         *tview.Flex
+	filterInput  *tview.InputField
 	logBox       *tview.TextView
 	trackList    *tview.Table
+	nowPlaying   *tview.Flex
+	artwork      *artworkView
 	playStateBox *tview.Table
 	statusBox    *tview.Table
 	editForm     *tview.Form
@@ -65,7 +102,16 @@ func NewTrackPage(ctx context.Context, shelf library.AudioShelf, pl player.Audio
 	trackList := tview.NewTable().SetBorders(true).SetBordersColor(theme.BorderColor)
 
 	playStateBox := tview.NewTable()
-	playStateBox.SetBorder(true).SetBorderColor(theme.BorderColor)
+	artwork := newArtworkView(cfg().Artwork, os.Getenv)
+
+	// cover art sits left of the play state, taking no space until there is some
+	nowPlaying := tview.NewFlex().
+		AddItem(artwork, 0, 0, false).
+		AddItem(playStateBox, 0, 1, false)
+	nowPlaying.SetBorder(true).SetBorderColor(theme.BorderColor)
+	artwork.resize = func(width int) {
+		nowPlaying.ResizeItem(artwork, width, 0)
+	}
 
 	p := &TrackPage{
 		//editForm:    form,
@@ -74,21 +120,25 @@ func NewTrackPage(ctx context.Context, shelf library.AudioShelf, pl player.Audio
 		player:       pl,
 		logBox:       statusBar,
 		trackList:    trackList,
+		nowPlaying:   nowPlaying,
+		artwork:      artwork,
 		playStateBox: playStateBox,
 		statusBox:    tview.NewTable(),
+		filterInput:  newFilterInput(),
+		defaultSort:  defaultSort(),
+		columnSets:   columnSets(),
+		selected:     map[string]bool{},
 	}
+	p.sortKeys = p.defaultSort
+	p.sortTracks()
+	p.refreshVisible()
 
 	return p
 }
 
 // Page populates the layout for the track page
 func (t *TrackPage) Page(ctx context.Context) tview.Primitive {
-	t.trackColumns(t.trackList)
-
-	for i, track := range t.tracks {
-		// incr by one to pass table headers
-		t.trackCell(t.trackList, i+1, track)
-	}
+	t.renderTracks()
 
 	t.trackList.
 		// fired on Escape, Tab, or Backtab key
@@ -102,24 +152,297 @@ func (t *TrackPage) Page(ctx context.Context) tview.Primitive {
 
 	editForm.SetCancelFunc(t.editCancel)
 
-	main := tview.NewFlex().SetDirection(tview.FlexRow).
+	t.filterInput.SetChangedFunc(t.filterChanged).SetDoneFunc(t.filterDone)
+
+	// the filter bar stays collapsed until opened
+	t.main = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(t.filterInput, 0, 0, false).
 		AddItem(t.trackList, 0, 3, true).
-		AddItem(t.playStateBox, 5, 1, false).
+		AddItem(t.nowPlaying, 5, 1, false).
 		AddItem(t.statusBox, 1, 1, false).
 		AddItem(t.logBox, 1, 1, false)
 
 	// Create the layout.
 	flex := tview.NewFlex().
-		AddItem(main, 0, 3, true)
+		AddItem(t.main, 0, 3, true)
 
+	t.loading = true
 	t.welcome()
 
+	go t.loadTracks(ctx)
+
 	// one outstanding goroutine that tracks audio progress
 	go t.audioPlaying(ctx)
 
 	return flex
 }
 
+// renderTracks fills the track table with the tracks that pass the current
+// filter, keeping the currently playing track highlighted if it is visible.
+func (t *TrackPage) renderTracks() {
+	t.refreshVisible()
+
+	t.trackList.Clear()
+	t.trackColumns(t.trackList)
+	t.statusBox.SetCell(0, 2, &tview.TableCell{Text: "Sort: " + t.sortDescription(), Color: theme.BorderColor, Align: tview.AlignRight, Expansion: 1})
+	t.renderSummary()
+
+	for row, i := range t.visible {
+		// incr by one to pass table headers
+		t.trackCell(t.trackList, row+1, t.tracks[i])
+	}
+
+	t.currentlyPlayingRow = 0
+	if t.currentlyPlayingTrack != nil {
+		t.currentlyPlayingRow = t.trackRow(t.trackIndex(t.currentlyPlayingTrack.Path))
+		t.restorePlayingStyle()
+	}
+
+	if selected, _ := t.trackList.GetSelection(); selected > len(t.visible) || selected < 1 {
+		t.trackList.Select(1, 0)
+	}
+}
+
+// refreshVisible recomputes which tracks pass the current filter
+func (t *TrackPage) refreshVisible() {
+	t.visible = make([]int, 0, len(t.tracks))
+	for i, track := range t.tracks {
+		if t.filter == nil || t.filter(track) {
+			t.visible = append(t.visible, i)
+		}
+	}
+}
+
+// rowTrack returns the track cache index shown on a table row
+func (t *TrackPage) rowTrack(row int) (int, bool) {
+	if row < 1 || row > len(t.visible) {
+		return -1, false
+	}
+
+	return t.visible[row-1], true
+}
+
+// trackRow returns the table row showing the track at cache index i, or 0
+// if it is filtered out.
+func (t *TrackPage) trackRow(i int) int {
+	if i < 0 {
+		return 0
+	}
+
+	for row, v := range t.visible {
+		if v == i {
+			return row + 1
+		}
+	}
+
+	return 0
+}
+
+// restorePlayingStyle highlights the currently playing row
+func (t *TrackPage) restorePlayingStyle() {
+	if t.currentlyPlayingRow == 0 || t.currentlyPlayingController == nil {
+		return
+	}
+
+	if t.currentlyPlayingController.Paused() {
+		t.setTrackRowStyle(t.currentlyPlayingRow, theme.SecondaryTextColor, trackIconPausedText)
+	} else {
+		t.setTrackRowStyle(t.currentlyPlayingRow, theme.TertiaryTextColor, trackIconPlayingText)
+	}
+}
+
+// loadTracks loads the shelf in the background, reporting progress in the
+// welcome panel and status bar as it goes.
+func (t *TrackPage) loadTracks(ctx context.Context) {
+	var lastDraw time.Time
+	t.shelf.SetProgressFunc(func(p library.ScanProgress) {
+		if !p.Done() && time.Since(lastDraw) < scanProgressMillis*time.Millisecond {
+			return
+		}
+		lastDraw = time.Now()
+
+		log.Infof("scanned %d / %d", p.Scanned, p.Total)
+		app.QueueUpdateDraw(func() {
+			t.scanProgress = p
+			if t.currentlyPlayingController == nil {
+				t.welcome()
+			}
+		})
+	})
+
+	count, err := t.shelf.LoadTracks()
+	if err != nil {
+		log.WithError(err).Error("could not load audio library")
+	}
+	log.WithField("count", count).Info("loaded library")
+
+	tracks := t.shelf.Tracks()
+	app.QueueUpdateDraw(func() {
+		t.loading = false
+		t.tracks = tracks
+		t.sortTracks()
+		t.renderTracks()
+
+		if t.currentlyPlayingController == nil {
+			t.welcome()
+		}
+	})
+
+	t.watchTracks(ctx)
+}
+
+// watchTracks applies changes made to the shelf outside of grump until ctx is
+// done.
+func (t *TrackPage) watchTracks(ctx context.Context) {
+	events, err := t.shelf.Watch(ctx)
+	if err != nil {
+		log.WithError(err).Warn("could not watch library for changes")
+		return
+	}
+
+	for ev := range events {
+		ev := ev
+		app.QueueUpdateDraw(func() {
+			t.applyTrackEvent(ev)
+		})
+	}
+}
+
+// applyTrackEvent updates the track cache and table in place, keeping the
+// currently playing row pointed at the currently playing track.
+func (t *TrackPage) applyTrackEvent(ev library.TrackEvent) {
+	log.WithFields(log.Fields{
+		"event": ev.Type,
+		"path":  ev.Track.Path,
+	}).Debug("library changed")
+
+	i := t.trackIndex(ev.Track.Path)
+
+	switch ev.Type {
+	case library.TrackAdded:
+		if i >= 0 {
+			t.replaceTrack(i, ev.Track)
+			return
+		}
+
+		// the new track goes where sorting, or path order without a sort,
+		// puts it after a restart rather than at the end
+		t.tracks = append(t.tracks, ev.Track)
+		t.sortTracks()
+		t.renderTracks()
+	case library.TrackChanged:
+		if i < 0 {
+			return
+		}
+
+		t.replaceTrack(i, ev.Track)
+	case library.TrackRemoved:
+		if i < 0 {
+			return
+		}
+
+		// let a removed track that is playing finish, there will just be
+		// no row to highlight anymore
+		t.removeTrack(i)
+	}
+
+	t.renderSummary()
+
+	if t.currentlyPlayingController == nil {
+		t.welcome()
+	}
+}
+
+// renderSummary shows the number of visible tracks and how long they play for
+func (t *TrackPage) renderSummary() {
+	t.statusBox.SetCell(0, 1, &tview.TableCell{Text: t.summary(), Color: theme.BorderColor, Expansion: 1})
+}
+
+// summary describes the visible tracks, eg: "12 of 340 tracks, 48:03"
+func (t *TrackPage) summary() string {
+	var length time.Duration
+	for _, i := range t.visible {
+		length += time.Duration(t.tracks[i].Length) * time.Millisecond
+	}
+
+	s := fmt.Sprintf("%d tracks", len(t.visible))
+	if len(t.visible) != len(t.tracks) {
+		s = fmt.Sprintf("%d of %d tracks", len(t.visible), len(t.tracks))
+	}
+
+	if length > 0 {
+		s += ", " + formatDuration(length)
+	}
+	return s
+}
+
+// replaceTrack updates the cached track at index i and its row, if visible
+func (t *TrackPage) replaceTrack(i int, track library.Track) {
+	t.tracks[i] = track
+
+	// the playing track may be filtered out, so match it by path
+	if t.currentlyPlayingTrack != nil && t.currentlyPlayingTrack.Path == track.Path {
+		*t.currentlyPlayingTrack = track
+	}
+
+	row := t.trackRow(i)
+	if row == 0 {
+		return
+	}
+
+	t.trackCell(t.trackList, row, track)
+
+	if row == t.currentlyPlayingRow {
+		t.restorePlayingStyle()
+	}
+}
+
+// removeTrack removes the track at cache index i from the cache and the
+// table, keeping row bookkeeping in sync.
+func (t *TrackPage) removeTrack(i int) library.Track {
+	row := t.trackRow(i)
+	track := t.removeTrackFromCache(i)
+	delete(t.selected, track.Path)
+
+	visible := t.visible[:0]
+	for _, v := range t.visible {
+		switch {
+		case v == i:
+			continue
+		case v > i:
+			v--
+		}
+		visible = append(visible, v)
+	}
+	t.visible = visible
+
+	if row == 0 {
+		return track
+	}
+
+	t.trackList.RemoveRow(row)
+
+	switch {
+	case row < t.currentlyPlayingRow:
+		t.currentlyPlayingRow--
+	case row == t.currentlyPlayingRow:
+		t.currentlyPlayingRow = 0
+	}
+
+	return track
+}
+
+// trackIndex returns the cache index of the track at path, or -1
+func (t *TrackPage) trackIndex(path string) int {
+	for i := range t.tracks {
+		if t.tracks[i].Path == path {
+			return i
+		}
+	}
+
+	return -1
+}
+
 // main key input handler for this page
 func (t *TrackPage) inputCapture(event *tcell.EventKey) *tcell.EventKey {
 	// placeholder nil check for convenience
@@ -127,14 +450,42 @@ func (t *TrackPage) inputCapture(event *tcell.EventKey) *tcell.EventKey {
 
 	globalInputCapture(event)
 
-	switch event.Key() {
-	case tcell.KeyRune:
-		// attempt to use rune as string
-		s := string(event.Rune())
-		switch s {
-		case "D":
-			t.describe(hovered)
-		}
+	switch keyBindings().action(event, scopeTracks) {
+	case ActionDescribeHover:
+		t.describe(hovered)
+	case ActionSearch:
+		t.openFilter()
+		return nil
+	case ActionSort:
+		t.cycleSort()
+		return nil
+	case ActionSortReverse:
+		t.reverseSort()
+		return nil
+	case ActionColumns:
+		t.cycleColumns()
+		return nil
+	case ActionPathTags:
+		pathTagsPage.open()
+		return nil
+	case ActionSelect:
+		t.toggleSelect()
+		return nil
+	case ActionSelectRange:
+		t.selectRange()
+		return nil
+	case ActionSelectAll:
+		t.selectAll()
+		return nil
+	case ActionSelectNone:
+		t.selectNone()
+		return nil
+	case ActionEditSelected:
+		t.editSelected()
+		return nil
+	case ActionUndoDelete:
+		t.undoDelete(context.Background())
+		return nil
 	}
 
 	// something is currently playing, handle that
@@ -156,10 +507,13 @@ func (t *TrackPage) track(target trackTarget) (*library.Track, error) {
 		}
 
 		track = t.currentlyPlayingTrack
-	// TODO: hovered does not work yet
 	case hovered:
-		row, column := t.trackList.GetOffset()
-		track = &t.tracks[row]
+		row, column := t.trackList.GetSelection()
+		i, ok := t.rowTrack(row)
+		if !ok {
+			return nil, fmt.Errorf("no track at row %d", row)
+		}
+		track = &t.tracks[i]
 		log.WithFields(log.Fields{"row": row, "column": column}).Debug("currently hovered track")
 
 		return track, nil
@@ -186,6 +540,12 @@ func (t *TrackPage) describe(target trackTarget) {
 		"ratingEmail": track.RatingEmail,
 		"score":       Score(track.Rating),
 		"playCount":   track.PlayCount,
+		"length":      formatLength(track.Length),
+		"mimeType":    track.MimeType,
+		"sampleRate":  track.SampleRate,
+		"bitDepth":    track.BitDepth,
+		"channels":    track.Channels,
+		"bitrate":     track.Bitrate,
 	}).Info("describing track")
 }
 
@@ -274,7 +634,10 @@ func (t *TrackPage) save() {
 		return
 	}
 	row := t.currentlyPlayingRow
-	track := prev
+
+	// edit a copy so a failed save leaves the cache untouched
+	updated := *prev
+	track := &updated
 
 	_, score := t.dropDown("Score").GetCurrentOption()
 
@@ -291,17 +654,16 @@ func (t *TrackPage) save() {
 		"row":    row,
 	}).Debug("collected track data from form")
 
-	_, err = t.shelf.SaveTrack(ctx, prev, track)
+	saved, err := t.shelf.SaveTrack(ctx, prev, track)
 	if err != nil {
 		log.WithField("track", track).WithError(err).Error("could not save track")
 		return
 	}
 
-	// update track row
-	t.trackCell(t.trackList, row, *track)
-
-	// update cache
-	t.tracks[row-1] = *track
+	// update cache and track row
+	if i := t.trackIndex(saved.Path); i >= 0 {
+		t.replaceTrack(i, *saved)
+	}
 
 	// switch back to tracks page
 	pages.SwitchToPage("tracks")
@@ -323,14 +685,20 @@ func (t *TrackPage) confirmDelete(ctx context.Context, target trackTarget) {
 		t.pauseToggle()
 	}
 
+	prompt := "Delete?"
+	if t.trash != nil {
+		prompt = "Move to trash?"
+	}
+
 	msg := fmt.Sprintf(`
-	Delete?
+	%s
 
 	Title: %s
 	Album: %s
 	Artist: %s
 
 	%s`,
+		prompt,
 		track.Title,
 		track.Album,
 		track.Artist,
@@ -372,15 +740,18 @@ func (t *TrackPage) deleteTrack(ctx context.Context) error {
 		return err
 	}
 
-	// delete from cache
-	removed := t.removeTrackFromCache(row - 1)
-	log.WithFields(log.Fields{
-		"trackRemovedFromCache": removed,
-		"row":                   row,
-	}).Debug("track removed from cache")
+	// delete from cache and ui
+	if i := t.trackIndex(track.Path); i >= 0 {
+		removed := t.removeTrack(i)
+		log.WithFields(log.Fields{
+			"trackRemovedFromCache": removed,
+			"row":                   row,
+		}).Debug("track removed from cache")
+	}
 
-	// update ui
-	t.trackList.RemoveRow(row)
+	if t.trash != nil {
+		t.deleted = append(t.deleted, track.Path)
+	}
 
 	// log
 	log.WithFields(log.Fields{
@@ -388,11 +759,54 @@ func (t *TrackPage) deleteTrack(ctx context.Context) error {
 	}).Info("deleted track")
 
 	// play next track
+	if row == 0 || row > len(t.visible) {
+		row = 1
+	}
 	t.cellChosen(row, 0)
 
 	return nil
 }
 
+// undoDelete restores the track deleted last
+func (t *TrackPage) undoDelete(ctx context.Context) {
+	if len(t.deleted) == 0 {
+		log.Info("nothing to undo")
+		return
+	}
+
+	path := t.deleted[len(t.deleted)-1]
+	entry, ok, err := t.trash.Latest(path)
+	if err != nil {
+		log.WithError(err).Error("could not read trash")
+		return
+	}
+
+	t.deleted = t.deleted[:len(t.deleted)-1]
+	if !ok {
+		log.WithField("path", path).Warn("deleted track is no longer in the trash")
+		return
+	}
+
+	err = t.restore(ctx, entry)
+	if err != nil {
+		log.WithError(err).WithField("path", path).Error("could not restore track")
+		return
+	}
+
+	log.WithField("path", path).Info("restored track")
+}
+
+// restore moves a track back from the trash and adds it to the table
+func (t *TrackPage) restore(ctx context.Context, entry library.TrashEntry) error {
+	track, err := t.shelf.RestoreTrack(ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	t.applyTrackEvent(library.TrackEvent{Type: library.TrackAdded, Track: *track})
+	return nil
+}
+
 // remove track from cache and return it
 func (t *TrackPage) removeTrackFromCache(i int) library.Track {
 	track := t.tracks[i]
@@ -405,80 +819,52 @@ func (t *TrackPage) removeTrackFromCache(i int) library.Track {
 func (t *TrackPage) currentlyPlayingInputCapture(event *tcell.EventKey) *tcell.EventKey {
 	ctx := context.Background()
 
-	switch event.Key() {
-	case tcell.KeyESC:
+	action := keyBindings().action(event, scopePlaying)
+	if score, ok := rateActions[action]; ok {
+		t.SetScore(score)
+		return event
+	}
+
+	switch action {
+	case ActionStop:
 		t.stopCurrentlyPlaying()
 		t.welcome()
-	case tcell.KeyLeft:
+	case ActionSeekBackward:
 		err := t.currentlyPlayingController.SeekBackward()
 		if err != nil {
-			log.WithError(err).Error("problem seeking forward")
+			log.WithError(err).Error("problem seeking backward")
 			return event
 		}
-	case tcell.KeyRight:
+	case ActionSeekForward:
 		err := t.currentlyPlayingController.SeekForward()
 		if err != nil {
 			log.WithError(err).Error("problem seeking forward")
 			return event
 		}
-	case tcell.KeyDelete:
+	case ActionDelete:
 		t.confirmDelete(ctx, playing)
 		return event
-	case tcell.KeyRune:
-		// attempt to use rune as string
-		s := string(event.Rune())
-		switch s {
-		// key - playing
-		// shift+key - hovered
-		case "0":
-			t.SetScore(Score00)
-		case ")":
-			t.SetScore(Score05)
-		case "1":
-			t.SetScore(Score10)
-		case "!":
-			t.SetScore(Score15)
-		case "2":
-			t.SetScore(Score20)
-		case "@":
-			t.SetScore(Score25)
-		case "3":
-			t.SetScore(Score30)
-		case "#":
-			t.SetScore(Score35)
-		case "4":
-			t.SetScore(Score40)
-		case "$":
-			t.SetScore(Score45)
-		case "5":
-			t.SetScore(Score50)
-		case "d":
-			t.describe(playing)
-		case "e":
-			t.edit(playing)
-		case " ":
-			t.pauseToggle()
-		case "=":
-			// IDEA: flash the label
-			t.currentlyPlayingController.VolumeUp()
-		case "-":
-			t.currentlyPlayingController.VolumeDown()
-		case "S":
-			t.shuffleToggle()
-		case "+":
-			t.currentlyPlayingController.SpeedUp()
-		case "_":
-			t.currentlyPlayingController.SpeedDown()
-		case "]":
-			t.skip(1)
-		case "[":
-			t.skip(-1)
-		case "?":
-			log.Trace("switching to help page")
-			pages.SwitchToPage("help")
-		case "q":
-			app.Stop()
-		}
+	case ActionDescribe:
+		t.describe(playing)
+	case ActionEdit:
+		t.edit(playing)
+	case ActionPause:
+		t.pauseToggle()
+	case ActionVolumeUp:
+		// IDEA: flash the label
+		t.currentlyPlayingController.VolumeUp()
+	case ActionVolumeDown:
+		t.currentlyPlayingController.VolumeDown()
+	case ActionShuffle:
+		t.shuffleToggle()
+	case ActionSpeedUp:
+		t.currentlyPlayingController.SpeedUp()
+	case ActionSpeedDown:
+		t.currentlyPlayingController.SpeedDown()
+	case ActionNext:
+		t.skip(1)
+	case ActionPrev:
+		t.skip(-1)
 	}
 	return event
 }
@@ -529,14 +915,16 @@ func (t *TrackPage) cellChosen(row, column int) {
 
 	log.Tracef("selecting row %d column %d", row, column)
 
-	if row > len(t.tracks) {
-		log.Warnf("row out of range %d column %d, length %d", row, column, len(t.tracks))
+	i, ok := t.rowTrack(row)
+	if !ok {
+		log.Warnf("row out of range %d column %d, length %d", row, column, len(t.visible))
 		return
 	}
 
-	track := t.tracks[row-1]
+	track := t.tracks[i]
 
-	if t.currentlyPlayingRow != 0 && t.currentlyPlayingController != nil && t.currentlyPlayingTrack != nil {
+	// a track hidden by the filter has no row, but still has to be stopped
+	if t.currentlyPlayingController != nil {
 		log.WithFields(log.Fields{
 			"track": t.currentlyPlayingTrack,
 			"row":   t.currentlyPlayingRow,
@@ -555,10 +943,18 @@ func (t *TrackPage) cellChosen(row, column int) {
 // setTrackRowStyle sets the style of a track row. Used for selection, pausing,
 // unpausing, etc.
 func (t *TrackPage) setTrackRowStyle(row int, color tcell.Color, statusColumnText string) {
+	if row <= 0 {
+		return
+	}
+
 	t.trackList.GetCell(row, columnStatus).SetText(statusColumnText)
-	t.trackList.GetCell(row, columnArtist).SetTextColor(color)
-	t.trackList.GetCell(row, columnAlbum).SetTextColor(color)
-	t.trackList.GetCell(row, columnTrack).SetTextColor(color)
+	for i, c := range t.columns() {
+		// ratings keep their own color
+		if c.field == library.FieldRating {
+			continue
+		}
+		t.trackList.GetCell(row, i+1).SetTextColor(color)
+	}
 }
 
 func (t *TrackPage) playTrack(track *library.Track) {
@@ -575,10 +971,49 @@ func (t *TrackPage) playTrack(track *library.Track) {
 
 	t.currentlyPlayingController = controller
 	t.currentlyPlayingTrack = track
+	t.heard = 0
+	t.lastElapsed = 0
+	t.playCounted = false
+
+	play := library.NewPlay(*track, time.Now())
+	play.Shuffle = t.shufflePick
+	t.play = &play
+	t.speed = 1
+	t.shufflePick = false
+}
+
+// endPlay records the playing track in the listening history
+func (t *TrackPage) endPlay(finished bool) {
+	if t.play == nil {
+		return
+	}
+
+	play := *t.play
+	t.play = nil
+
+	play.Listened = int(t.heard / time.Millisecond)
+	play.Finished = finished
+	play.Speed = t.speed
+
+	log.WithFields(log.Fields{
+		"path":     play.Path,
+		"listened": play.Listened,
+		"finished": play.Finished,
+	}).Debug("play ended")
+
+	if t.history == nil {
+		return
+	}
+
+	err := t.history.Append(play)
+	if err != nil {
+		log.WithError(err).Error("could not record play in history")
+	}
 }
 
 // audioPlaying is a loop that checks on currently playing track
-// progress
+// progress. Checks run on the ui goroutine, like key presses, so the play
+// state is only ever touched from there.
 func (t *TrackPage) audioPlaying(ctx context.Context) {
 	for {
 		select {
@@ -586,7 +1021,7 @@ func (t *TrackPage) audioPlaying(ctx context.Context) {
 			log.Debug("context done")
 			return
 		default:
-			t.checkCurrentlyPlaying()
+			app.QueueUpdateDraw(t.checkCurrentlyPlaying)
 			time.Sleep(checkAudioMillis * time.Millisecond)
 		}
 	}
@@ -594,12 +1029,13 @@ func (t *TrackPage) audioPlaying(ctx context.Context) {
 
 func (t *TrackPage) stopCurrentlyPlaying() {
 	log.WithField("row", t.currentlyPlayingRow).Debug("clearing track style")
-	t.setTrackRowStyle(t.currentlyPlayingRow, theme.PrimaryTextColor, trackIconEmptyText)
+	t.setTrackRowStyle(t.currentlyPlayingRow, theme.PrimaryTextColor, t.rowIcon(t.currentlyPlayingRow))
 
 	if t.currentlyPlayingController == nil {
 		return
 	}
 
+	t.endPlay(false)
 	t.currentlyPlayingController.Stop()
 	t.currentlyPlayingController = nil
 	t.currentlyPlayingTrack = nil
@@ -619,50 +1055,141 @@ func (t *TrackPage) checkCurrentlyPlaying() {
 
 	t.updatePlayState(ps, t.currentlyPlayingTrack)
 
+	t.listen(ps)
+	if !t.playCounted && playReached(t.heard, playLength(ps, t.currentlyPlayingTrack), cfg().PlayCount) {
+		t.playCounted = true
+		go t.countPlay(*t.currentlyPlayingTrack)
+	}
+
 	// check if audio has stopped
 	if ps.Finished {
 		log.Debug("track has finished playing")
+		t.endPlay(true)
 
 		// move to next track
 		t.skip(1)
 	}
 }
 
+// listen adds playback since the last check to the time heard. Jumps of a
+// seek or more are skipped audio, not listening.
+func (t *TrackPage) listen(ps player.PlayState) {
+	delta := ps.Elapsed - t.lastElapsed
+	t.lastElapsed = ps.Elapsed
+	if ps.SpeedRatio > 0 {
+		t.speed = ps.SpeedRatio
+	}
+
+	if delta > 0 && delta < player.SeekSecs*time.Second {
+		t.heard += delta
+	}
+}
+
+// playReached checks if enough of a track has been heard to count as a play
+func playReached(heard, length time.Duration, pc config.PlayCountConfig) bool {
+	if pc.Seconds > 0 && heard >= time.Duration(pc.Seconds)*time.Second {
+		return true
+	}
+
+	if pc.Percent <= 0 || length <= 0 {
+		return false
+	}
+
+	return heard*100 >= length*time.Duration(pc.Percent)
+}
+
+// countPlay persists a play of track, then updates its row
+func (t *TrackPage) countPlay(track library.Track) {
+	counted, err := t.shelf.CountPlay(context.Background(), &track)
+	if err != nil {
+		log.WithError(err).WithField("path", track.Path).Warn("could not count play")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"path":      counted.Path,
+		"playCount": counted.PlayCount,
+	}).Debug("counted play")
+
+	// only the count is taken, as the row may have changed since
+	app.QueueUpdateDraw(func() {
+		if i := t.trackIndex(counted.Path); i >= 0 {
+			track := t.tracks[i]
+			track.PlayCount = counted.PlayCount
+			t.replaceTrack(i, track)
+		}
+	})
+}
+
 // skip skips forward/backward on the playlist. count can be negative to go backward.
 //
 // TODO: add unit tests for next track logic
 func (t *TrackPage) skip(count int) {
+	rows := len(t.visible)
+	if rows == 0 {
+		log.Debug("no tracks to skip to")
+		return
+	}
+
 	// attempt to play the next track available
-	nextRow := t.currentlyPlayingRow + count
+	current := t.playingPosition(count)
+	nextRow := current + count
 
 	// if shuffling, choose one at random
 	if t.shuffle {
-		nextRow = rand.Intn(len(t.tracks))
+		nextRow = rand.Intn(rows) + 1
+		t.shufflePick = true
 	}
 
 	// if skipping too far ahead, go to beginning
 	if nextRow <= 0 {
-		nextRow = len(t.tracks)
+		nextRow = rows
 	}
 
 	// if we're at the end of the list, start over
-	if t.currentlyPlayingRow >= len(t.tracks) && count > 0 {
+	if nextRow > rows {
 		nextRow = 1
 	}
 
 	log.WithFields(log.Fields{
 		"currentlyPlayingRow": t.currentlyPlayingRow,
 		"nextRow":             nextRow,
-		"totalTracks":         len(t.tracks),
+		"totalTracks":         rows,
 		"skip":                count,
 	}).Debug("skipping to next track")
 
 	t.cellChosen(nextRow, columnStatus)
 }
 
-func (t *TrackPage) updatePlayState(ps player.PlayState, track *library.Track) {
-	percentageComplete := int(ps.Progress * 100)
+// playingPosition returns the row to skip from. If the playing track has been
+// filtered out, this is the position it would have had among the visible
+// rows, so skipping moves to its visible neighbours.
+func (t *TrackPage) playingPosition(count int) int {
+	if t.currentlyPlayingRow != 0 || t.currentlyPlayingTrack == nil {
+		return t.currentlyPlayingRow
+	}
+
+	i := t.trackIndex(t.currentlyPlayingTrack.Path)
+	if i < 0 {
+		return 0
+	}
 
+	// number of visible rows before the hidden track
+	before := 0
+	for _, v := range t.visible {
+		if v > i {
+			break
+		}
+		before++
+	}
+
+	if count > 0 {
+		return before
+	}
+	return before + 1
+}
+
+func (t *TrackPage) updatePlayState(ps player.PlayState, track *library.Track) {
 	log.WithFields(log.Fields{
 		"progress":   ps.Progress,
 		"position":   ps.Position,
@@ -672,22 +1199,49 @@ func (t *TrackPage) updatePlayState(ps player.PlayState, track *library.Track) {
 		"goroutines": runtime.NumGoroutine(),
 	}).Trace("play state update")
 
-	app.QueueUpdateDraw(func() {
-		t.playStateBox.SetCell(0, 0, tview.NewTableCell("Title"))
-		t.playStateBox.SetCell(0, 1, &tview.TableCell{Text: track.Title, Color: theme.TertiaryTextColor})
-		t.playStateBox.SetCell(1, 0, tview.NewTableCell("Album"))
-		t.playStateBox.SetCell(1, 1, &tview.TableCell{Text: track.Album, Color: theme.TertiaryTextColor})
-		t.playStateBox.SetCell(2, 0, tview.NewTableCell("Artist"))
-		t.playStateBox.SetCell(2, 1, &tview.TableCell{Text: track.Artist, Color: theme.TertiaryTextColor})
-
-		t.playStateBox.SetCell(0, 2, tview.NewTableCell("Progress"))
-		t.playStateBox.SetCell(0, 3, &tview.TableCell{Text: fmt.Sprintf("%s %d%%", ps.Position, percentageComplete), Color: theme.TertiaryTextColor})
-		t.playStateBox.SetCell(1, 2, &tview.TableCell{Text: "Volume"})
-		t.playStateBox.SetCell(1, 2, tview.NewTableCell("Volume"))
-		t.playStateBox.SetCell(1, 3, &tview.TableCell{Text: ps.Volume, Color: theme.TertiaryTextColor})
-		t.playStateBox.SetCell(2, 2, tview.NewTableCell("Speed"))
-		t.playStateBox.SetCell(2, 3, &tview.TableCell{Text: ps.Speed, Color: theme.TertiaryTextColor})
-	})
+	t.artwork.setTrack(*track)
+
+	t.playStateBox.SetCell(0, 0, tview.NewTableCell("Title"))
+	t.playStateBox.SetCell(0, 1, &tview.TableCell{Text: track.Title, Color: theme.TertiaryTextColor})
+	t.playStateBox.SetCell(1, 0, tview.NewTableCell("Album"))
+	t.playStateBox.SetCell(1, 1, &tview.TableCell{Text: track.Album, Color: theme.TertiaryTextColor})
+	t.playStateBox.SetCell(2, 0, tview.NewTableCell("Artist"))
+	t.playStateBox.SetCell(2, 1, &tview.TableCell{Text: track.Artist, Color: theme.TertiaryTextColor})
+
+	t.playStateBox.SetCell(0, 2, tview.NewTableCell("Progress"))
+	t.playStateBox.SetCell(0, 3, &tview.TableCell{Text: playProgress(ps, track), Color: theme.TertiaryTextColor})
+	t.playStateBox.SetCell(1, 2, &tview.TableCell{Text: "Volume"})
+	t.playStateBox.SetCell(1, 2, tview.NewTableCell("Volume"))
+	t.playStateBox.SetCell(1, 3, &tview.TableCell{Text: ps.Volume, Color: theme.TertiaryTextColor})
+	t.playStateBox.SetCell(2, 2, tview.NewTableCell("Speed"))
+	t.playStateBox.SetCell(2, 3, &tview.TableCell{Text: ps.Speed, Color: theme.TertiaryTextColor})
+}
+
+// playProgress describes how far through a track playback is, eg:
+// "1:02 / 3:45 27%". The length read from the file's headers is preferred,
+// as the player's own estimate can be off for variable bitrate files.
+func playProgress(ps player.PlayState, track *library.Track) string {
+	length := playLength(ps, track)
+	if length <= 0 {
+		return fmt.Sprintf("%s %d%%", ps.Position, int(ps.Progress*100))
+	}
+
+	elapsed := ps.Elapsed
+	if elapsed > length {
+		elapsed = length
+	}
+
+	return fmt.Sprintf("%s / %s %d%%", formatDuration(elapsed), formatDuration(length), int(elapsed*100/length))
+}
+
+// playLength is the length of the playing track, preferring the one read
+// from its headers
+func playLength(ps player.PlayState, track *library.Track) time.Duration {
+	length := time.Duration(track.Length) * time.Millisecond
+	if length <= 0 {
+		length = ps.Length
+	}
+	return length
 }
 
 func (t *TrackPage) welcome() {
@@ -695,61 +1249,72 @@ func (t *TrackPage) welcome() {
 		SetCell(0, 0, tview.NewTableCell("grump")).
 		SetCell(0, 1, &tview.TableCell{Text: fmt.Sprintf("%s", build.Version), Color: theme.TitleColor, NotSelectable: true}).
 		SetCell(1, 0, tview.NewTableCell("files scanned")).
-		SetCell(1, 1, &tview.TableCell{Text: fmt.Sprintf("%d", len(t.tracks)), Color: theme.SecondaryTextColor, NotSelectable: true}).
+		SetCell(1, 1, &tview.TableCell{Text: t.scanStatus(), Color: theme.SecondaryTextColor, NotSelectable: true}).
 		SetCell(2, 0, tview.NewTableCell("for help, press")).
 		SetCell(2, 1, &tview.TableCell{Text: "?", Color: theme.TertiaryTextColor, NotSelectable: true})
 }
 
+// scanStatus describes library loading progress for the welcome panel
+func (t *TrackPage) scanStatus() string {
+	if t.loading {
+		return fmt.Sprintf("%d / %d", t.scanProgress.Scanned, t.scanProgress.Total)
+	}
+
+	return fmt.Sprintf("%d", len(t.tracks))
+}
+
+// trackColumns sets the table header, marking the columns tracks are sorted by
 func (t *TrackPage) trackColumns(table *tview.Table) {
-	table.
-		SetCell(0, columnStatus, &tview.TableCell{Text: trackIconEmptyText, Color: theme.TitleColor, NotSelectable: true}).
-		SetCell(0, columnArtist, &tview.TableCell{Text: "Artist", Color: theme.TitleColor, NotSelectable: true}).
-		SetCell(0, columnAlbum, &tview.TableCell{Text: "Album", Color: theme.TitleColor, NotSelectable: true}).
-		SetCell(0, columnTrack, &tview.TableCell{Text: "Title", Color: theme.TitleColor, NotSelectable: true}).
-		SetCell(0, columnRating, &tview.TableCell{Text: "Rating", Color: theme.TitleColor, NotSelectable: true})
+	table.SetCell(0, columnStatus, &tview.TableCell{Text: trackIconEmptyText, Color: theme.TitleColor, NotSelectable: true})
+	for i, c := range t.columns() {
+		table.SetCell(0, i+1, c.headerCell(t.sortIndicator(c.field)))
+	}
 }
 
 func (t *TrackPage) SetScore(score string) {
 	ctx := context.Background()
 	log.WithFields(log.Fields{"score": score}).Debug("setting score")
 
-	track := t.currentlyPlayingTrack
-	row := t.currentlyPlayingRow
+	// rate a copy so a failed save leaves the cache untouched, and the
+	// shelf can tell only the rating changed
+	prev := *t.currentlyPlayingTrack
+	track := prev
 
 	// convert rating
 	rating := Rating(score)
 	track.Rating = rating
-	_, err := t.shelf.SaveTrack(ctx, nil, track)
+	saved, err := t.shelf.SaveTrack(ctx, &prev, &track)
 	if err != nil {
 		log.WithError(err).WithField("rating", rating).Error("could not set rating on track")
 		return
 	}
 
-	// update track row
-	t.trackCell(t.trackList, row, *track)
-
-	// restore "playing" visual state
-	t.setTrackRowStyle(t.currentlyPlayingRow, theme.TertiaryTextColor, trackIconPlayingText)
-
-	// update cache
-	t.tracks[row-1] = *track
+	// update cache and track row, restoring "playing" visual state
+	if i := t.trackIndex(saved.Path); i >= 0 {
+		t.replaceTrack(i, *saved)
+	}
 }
 
 func (t *TrackPage) trackCell(table *tview.Table, row int, track library.Track) {
-	title := track.Title
+	icon := trackIconEmptyText
+	if t.selected[track.Path] {
+		icon = trackIconSelectedText
+	}
 
-	// use path if title is empty
-	if track.Title == "" {
-		title = track.Path
+	table.SetCell(row, columnStatus, &tview.TableCell{Text: icon, Color: theme.PrimaryTextColor})
+	track = t.displayTrack(track)
+	for i, c := range t.columns() {
+		table.SetCell(row, i+1, c.cell(track))
 	}
+}
 
-	scoreText := Score(track.Rating)
-	scoreColor := ScoreColor(scoreText)
+// displayTrack returns track as it is shown, with tags filled in from its
+// path if that was asked for
+func (t *TrackPage) displayTrack(track library.Track) library.Track {
+	if t.pathFill == nil {
+		return track
+	}
 
-	table.
-		SetCell(row, columnStatus, &tview.TableCell{Text: trackIconEmptyText, Color: theme.PrimaryTextColor}).
-		SetCell(row, columnArtist, &tview.TableCell{Text: track.Artist, Color: theme.PrimaryTextColor, Expansion: 4, MaxWidth: 8}).
-		SetCell(row, columnAlbum, &tview.TableCell{Text: track.Album, Color: theme.PrimaryTextColor, Expansion: 4, MaxWidth: 8}).
-		SetCell(row, columnTrack, &tview.TableCell{Text: title, Color: theme.PrimaryTextColor, Expansion: 10, MaxWidth: 8}).
-		SetCell(row, columnRating, &tview.TableCell{Text: scoreText, Color: scoreColor})
+	filled, _ := t.pathFill.Propose(track)
+	return filled
 }
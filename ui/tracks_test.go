@@ -1,12 +1,23 @@
 package ui
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/dhulihan/grump/internal/config"
 	"github.com/dhulihan/grump/library"
 	"github.com/dhulihan/grump/player"
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -16,6 +27,8 @@ type TrackPageSuite struct {
 }
 
 func (s *TrackPageSuite) SetupSuite() {
+	theme = defaultTheme()
+	setupLoggers(nil)
 }
 
 func (s *TrackPageSuite) SetupTest() {
@@ -48,13 +61,374 @@ func (s *TrackPageSuite) TestDeleteTrack() {
 	s.Equal(&s.page.tracks[1], s.page.currentlyPlayingTrack)
 	s.Equal(2, s.page.currentlyPlayingRow)
 
-	err := s.page.deleteTrack()
+	err := s.page.deleteTrack(context.Background())
 	if s.NoError(err) {
 		s.Equal(&s.page.tracks[1], s.page.currentlyPlayingTrack)
 		s.Equal(2, s.page.currentlyPlayingRow)
 	}
 }
 
+func (s *TrackPageSuite) TestFilteredRows() {
+	s.page.renderTracks()
+	s.page.setFilter(func(t library.Track) bool {
+		return t.Path != "mock-track-path-2" && t.Path != "mock-track-path-4"
+	})
+	s.Len(s.page.visible, 3)
+
+	// row 2 now shows the third track
+	s.page.cellChosen(2, 0)
+	s.Equal("Mock Track 3", s.page.currentlyPlayingTrack.Title)
+	s.Equal(2, s.page.currentlyPlayingRow)
+
+	s.page.skip(1)
+	s.Equal("Mock Track 5", s.page.currentlyPlayingTrack.Title)
+	s.Equal(3, s.page.currentlyPlayingRow)
+
+	// wrap around to the first visible track
+	s.page.skip(1)
+	s.Equal("Mock Track 1", s.page.currentlyPlayingTrack.Title)
+	s.Equal(1, s.page.currentlyPlayingRow)
+
+	s.page.skip(-1)
+	s.Equal("Mock Track 5", s.page.currentlyPlayingTrack.Title)
+}
+
+func (s *TrackPageSuite) TestFilterHidesPlayingTrack() {
+	s.page.renderTracks()
+	s.page.cellChosen(2, 0)
+	s.Equal("Mock Track 2", s.page.currentlyPlayingTrack.Title)
+	hidden := s.page.currentlyPlayingController.(*player.MockAudioController)
+
+	s.page.setFilter(func(t library.Track) bool {
+		return t.Path != "mock-track-path-2"
+	})
+	s.Equal(0, s.page.currentlyPlayingRow)
+	s.False(hidden.Stopped)
+
+	// skipping continues from where the hidden track would be, and stops it
+	s.page.skip(1)
+	s.True(hidden.Stopped)
+	s.Equal("Mock Track 3", s.page.currentlyPlayingTrack.Title)
+	s.Equal(2, s.page.currentlyPlayingRow)
+
+	// clearing the filter finds the playing row again
+	s.page.setFilter(nil)
+	s.Equal(3, s.page.currentlyPlayingRow)
+}
+
+func (s *TrackPageSuite) TestDeleteFilteredTrack() {
+	s.page.renderTracks()
+	s.page.setFilter(func(t library.Track) bool {
+		return t.Path != "mock-track-path-1"
+	})
+
+	s.page.cellChosen(1, 0)
+	s.Equal("Mock Track 2", s.page.currentlyPlayingTrack.Title)
+
+	err := s.page.deleteTrack(context.Background())
+	if s.NoError(err) {
+		s.Len(s.page.tracks, 4)
+		s.Len(s.page.visible, 3)
+		s.Equal("Mock Track 3", s.page.currentlyPlayingTrack.Title)
+		s.Equal(1, s.page.currentlyPlayingRow)
+	}
+}
+
+func (s *TrackPageSuite) TestSortKeepsPlayingRow() {
+	s.page.renderTracks()
+	s.page.cellChosen(2, 0)
+
+	// artist, then title descending
+	s.page.cycleSort()
+	s.page.cycleSort()
+	s.page.cycleSort()
+	s.page.reverseSort()
+	s.Equal("title ▼, album ▲, artist ▲", s.page.sortDescription())
+	s.Equal("Title ▼1", s.page.trackList.GetCell(0, 3).Text)
+	s.Equal("Mock Track 5", s.page.tracks[0].Title)
+
+	// the playing track follows its row
+	s.Equal("Mock Track 2", s.page.currentlyPlayingTrack.Title)
+	s.Equal(4, s.page.currentlyPlayingRow)
+
+	// cycling past the last column restores library order
+	s.page.cycleSort()
+	s.page.cycleSort()
+	s.Empty(s.page.sortKeys)
+	s.Equal("Title", s.page.trackList.GetCell(0, 3).Text)
+	s.Equal(2, s.page.currentlyPlayingRow)
+}
+
+func (s *TrackPageSuite) TestTrackAddedInPathOrder() {
+	s.page.renderTracks()
+	s.page.cellChosen(3, 0)
+
+	added := library.Track{Title: "Mock Track 2.5", Path: "mock-track-path-2.5"}
+	s.page.applyTrackEvent(library.TrackEvent{Type: library.TrackAdded, Track: added})
+
+	// the track goes where a restart would put it, not at the end
+	s.Len(s.page.tracks, 6)
+	s.Equal("Mock Track 2.5", s.page.tracks[2].Title)
+	s.Equal("Mock Track 2.5", s.page.trackList.GetCell(3, 3).Text)
+
+	// the playing row moves down with its track
+	s.Equal("Mock Track 3", s.page.currentlyPlayingTrack.Title)
+	s.Equal(4, s.page.currentlyPlayingRow)
+}
+
+func (s *TrackPageSuite) TestColumnSets() {
+	conf = config.DefaultConfig()
+	defer func() { conf = nil }()
+
+	conf.Columns = []config.ColumnConfig{
+		{Name: "track"},
+		{Name: "title"},
+		{Name: "duration", Align: "center"},
+		{Name: "bogus"},
+	}
+	conf.ColumnSets = map[string][]config.ColumnConfig{
+		"paths": {{Name: "path", Width: 20}},
+	}
+
+	tracks := []library.Track{{Path: "a.mp3", TrackNumber: 3, Length: 61500}}
+	page := NewTrackPage(context.Background(), library.NewMockAudioLibrary(tracks), player.NewMockAudioPlayer())
+	page.renderTracks()
+
+	// invalid columns are skipped
+	s.Len(page.columns(), 3)
+	s.Equal("#", page.trackList.GetCell(0, 1).Text)
+	s.Equal("3", page.trackList.GetCell(1, 1).Text)
+	s.Equal("a.mp3", page.trackList.GetCell(1, 2).Text)
+	s.Equal("1:01", page.trackList.GetCell(1, 3).Text)
+	s.Equal(tview.AlignCenter, page.trackList.GetCell(1, 3).Align)
+
+	page.cycleColumns()
+	s.Equal(2, page.trackList.GetColumnCount())
+	s.Equal("Path", page.trackList.GetCell(0, 1).Text)
+	s.Equal(20, page.trackList.GetCell(1, 1).MaxWidth)
+
+	page.cycleColumns()
+	s.Equal(4, page.trackList.GetColumnCount())
+}
+
+func (s *TrackPageSuite) TestSummary() {
+	s.page.tracks[0].Length = 60000
+	s.page.tracks[1].Length = 3600000
+	s.page.renderTracks()
+	s.Equal("5 tracks, 1:01:00", s.page.statusBox.GetCell(0, 1).Text)
+
+	pred, err := library.ParseSearch("track 2", library.SearchOptions{})
+	s.Require().NoError(err)
+	s.page.setFilter(pred)
+	s.Equal("1 of 5 tracks, 1:00:00", s.page.statusBox.GetCell(0, 1).Text)
+}
+
+func TestPlayProgress(t *testing.T) {
+	var tests = []struct {
+		ps       player.PlayState
+		length   int
+		expected string
+	}{
+		{player.PlayState{}, 225000, "0:00 / 3:45 0%"},
+		{player.PlayState{Elapsed: 90 * time.Second, Length: 100 * time.Second}, 225000, "1:30 / 3:45 40%"},
+		{player.PlayState{Elapsed: 50 * time.Second, Length: 100 * time.Second}, 0, "0:50 / 1:40 50%"},
+		{player.PlayState{Position: "?", Progress: 0.5}, 0, "? 50%"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, playProgress(test.ps, &library.Track{Length: test.length}))
+	}
+}
+
+func (s *TrackPageSuite) TestListen() {
+	for _, elapsed := range []time.Duration{500, 1000, 8000, 8500, 3500, 4000} {
+		s.page.listen(player.PlayState{Elapsed: elapsed * time.Millisecond})
+	}
+
+	// seeking forward and back is not listening
+	s.Equal(2*time.Second, s.page.heard)
+}
+
+func (s *TrackPageSuite) TestHistory() {
+	history := library.NewHistory(filepath.Join(s.T().TempDir(), "history.jsonl"))
+	s.page.history = history
+	s.page.renderTracks()
+
+	s.page.cellChosen(2, 0)
+	s.page.listen(player.PlayState{Elapsed: 3 * time.Second, SpeedRatio: 1.5})
+	s.page.shuffle = true
+	s.page.skip(1)
+	s.page.endPlay(true)
+
+	plays, err := history.Recent(10)
+	s.Require().NoError(err)
+	s.Require().Len(plays, 2)
+
+	s.Equal("Mock Track 2", plays[1].Title)
+	s.Equal(3000, plays[1].Listened)
+	s.Equal(1.5, plays[1].Speed)
+	s.False(plays[1].Finished)
+	s.False(plays[1].Shuffle)
+
+	s.True(plays[0].Finished)
+	s.True(plays[0].Shuffle)
+	s.Equal(1.0, plays[0].Speed)
+}
+
+func (s *TrackPageSuite) TestBatchEditCurrentTracks() {
+	opened := []library.Track{s.page.tracks[1], s.page.tracks[3]}
+
+	// a play is counted and a score set while the form is open
+	counted := s.page.tracks[1]
+	counted.PlayCount = 3
+	s.page.replaceTrack(1, counted)
+	rated := s.page.tracks[3]
+	rated.Rating = Rating(Score40)
+	s.page.replaceTrack(3, rated)
+
+	changes, err := applyBatch(s.page.currentTracks(opened), map[library.Field]string{library.FieldAlbum: "Currents"}, "")
+	s.Require().NoError(err)
+	s.Require().Len(changes, 2)
+	s.Equal(uint64(3), changes[0].track.PlayCount)
+	s.Equal(Rating(Score40), changes[1].track.Rating)
+	s.Equal("Currents", changes[1].track.Album)
+}
+
+// writeFLAC creates a FLAC file with only the given comments
+func writeFLAC(t *testing.T, path string, comments ...string) {
+	block := &bytes.Buffer{}
+	putString := func(s string) {
+		binary.Write(block, binary.LittleEndian, uint32(len(s)))
+		block.WriteString(s)
+	}
+	putString("test")
+	binary.Write(block, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		putString(c)
+	}
+
+	b := append([]byte("fLaC\x00\x00\x00\x22"), make([]byte, 34)...)
+	n := block.Len()
+	b = append(b, 0x84, byte(n>>16), byte(n>>8), byte(n))
+	b = append(b, block.Bytes()...)
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, b, 0644))
+}
+
+func (s *TrackPageSuite) TestPathFillIsNotSaved() {
+	dir := s.T().TempDir()
+	path := filepath.Join(dir, "Tame Impala", "Currents", "01 - Let It Happen.flac")
+	writeFLAC(s.T(), path, "GENRE=Psychedelic")
+
+	shelf, err := library.NewLocalAudioShelf(dir)
+	s.Require().NoError(err)
+	_, err = shelf.LoadTracks()
+	s.Require().NoError(err)
+
+	s.page = NewTrackPage(context.Background(), shelf, player.NewMockAudioPlayer())
+	s.page.renderTracks()
+	pathTags := NewPathTagsPage(context.Background(), s.page)
+	pathTags.refresh()
+	pathTags.fill()
+
+	// the guesses are shown, but the track keeps its own tags
+	shown := []string{}
+	for col := 1; col < s.page.trackList.GetColumnCount(); col++ {
+		shown = append(shown, s.page.trackList.GetCell(1, col).Text)
+	}
+	s.Contains(shown, "Tame Impala")
+	s.Contains(shown, "Let It Happen")
+	s.Equal("", s.page.tracks[0].Title)
+
+	// rating the playing track only writes the rating
+	s.page.currentlyPlayingTrack = &s.page.tracks[0]
+	s.page.SetScore(Score40)
+
+	loaded, err := shelf.LoadTrack(context.Background(), path)
+	s.Require().NoError(err)
+	s.Equal(Rating(Score40), loaded.Rating)
+	loaded.Rating = 0
+	s.Equal(library.Track{Genre: "Psychedelic", FileType: loaded.FileType, Path: path}, *loaded)
+}
+
+// TestHistoryWhilePlaying skips tracks while the player is checked in the
+// background, as when a track finishes during a key press. Run with -race.
+func (s *TrackPageSuite) TestHistoryWhilePlaying() {
+	history := library.NewHistory(filepath.Join(s.T().TempDir(), "history.jsonl"))
+	s.page.history = history
+	s.page.player = &player.MockAudioPlayer{Tick: time.Second, Length: 2 * time.Second}
+
+	screen := tcell.NewSimulationScreen("")
+	s.Require().NoError(screen.Init())
+	app = tview.NewApplication().SetScreen(screen).SetRoot(s.page.trackList, true)
+	stopped := make(chan error)
+	// the stopped app is left in place, play counts may still queue updates
+	go func() { stopped <- app.Run() }()
+
+	// key presses run on the ui goroutine
+	press := func(f func()) {
+		done := make(chan bool)
+		app.QueueUpdate(func() {
+			f()
+			close(done)
+		})
+		<-done
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	press(func() {
+		s.page.renderTracks()
+		s.page.cellChosen(1, 0)
+	})
+	go s.page.audioPlaying(ctx)
+
+	for i := 0; i < 6; i++ {
+		time.Sleep(checkAudioMillis * time.Millisecond / 2)
+		press(func() { s.page.skip(1) })
+	}
+
+	cancel()
+	press(func() { s.page.endPlay(false) })
+	app.Stop()
+	s.NoError(<-stopped)
+
+	plays, err := history.Recent(100)
+	s.Require().NoError(err)
+	s.GreaterOrEqual(len(plays), 7)
+
+	// every play is recorded once, with no more than its own track's length
+	seen := map[string]bool{}
+	for _, p := range plays {
+		key := p.Path + p.Start.String()
+		s.False(seen[key], "%s recorded twice", p.Path)
+		seen[key] = true
+		s.LessOrEqual(p.Listened, 2000)
+	}
+}
+
+func TestPlayReached(t *testing.T) {
+	pc := config.PlayCountConfig{Percent: 50, Seconds: 240}
+
+	var tests = []struct {
+		heard, length time.Duration
+		pc            config.PlayCountConfig
+		expected      bool
+	}{
+		{89 * time.Second, 180 * time.Second, pc, false},
+		{90 * time.Second, 180 * time.Second, pc, true},
+		{240 * time.Second, 20 * time.Minute, pc, true},
+		{239 * time.Second, 20 * time.Minute, pc, false},
+		{300 * time.Second, 0, pc, true},
+		{100 * time.Second, 0, pc, false},
+		{5 * time.Minute, 20 * time.Minute, config.PlayCountConfig{Percent: 25}, true},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, playReached(test.heard, test.length, test.pc), "%s of %s", test.heard, test.length)
+	}
+}
+
 // In order for 'go test' to run this suite, we need to create
 // a normal test function and pass our suite to suite.Run
 func TestTrackPageSuite(t *testing.T) {
@@ -0,0 +1,160 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dhulihan/grump/library"
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+	log "github.com/sirupsen/logrus"
+)
+
+// TrashPage lists deleted tracks so they can be restored or purged
+type TrashPage struct {
+	trash   *library.Trash
+	tracks  *TrackPage
+	entries []library.TrashEntry
+
+	table  *tview.Table
+	bottom *tview.TextView
+}
+
+// NewTrashPage creates the trash page. trash may be nil if it is disabled.
+func NewTrashPage(ctx context.Context, trash *library.Trash, tracks *TrackPage) *TrashPage {
+	return &TrashPage{
+		trash:  trash,
+		tracks: tracks,
+		table:  tview.NewTable().SetFixed(1, 0).SetSelectable(true, false),
+		bottom: tview.NewTextView(),
+	}
+}
+
+// Page populates the layout for the trash page
+func (p *TrashPage) Page(ctx context.Context) tview.Primitive {
+	p.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		globalInputCapture(event)
+
+		switch keyBindings().action(event, scopeTrash) {
+		case ActionTrashRestore:
+			p.restore(ctx)
+			return nil
+		case ActionTrashPurge:
+			p.confirmPurge()
+			return nil
+		}
+
+		switch event.Key() {
+		case tcell.KeyESC:
+			pages.SwitchToPage("tracks")
+		}
+
+		return event
+	})
+	p.table.SetBorder(true).SetTitle("Trash").SetBorderColor(theme.BorderColor)
+
+	main := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(p.table, 0, 6, true).
+		AddItem(p.bottom, 1, 0, false)
+
+	return tview.NewFlex().AddItem(main, 0, 3, true)
+}
+
+// help describes the page's keys in the bottom bar
+func (p *TrashPage) help() {
+	p.bottom.SetText(fmt.Sprintf("%d deleted tracks in %s. Press escape to go back, %s to restore, %s to purge.",
+		len(p.entries),
+		p.trash.Dir(),
+		strings.Join(keyBindings().keysFor(ActionTrashRestore), ", "),
+		strings.Join(keyBindings().keysFor(ActionTrashPurge), ", ")))
+}
+
+// refresh reloads the deleted tracks, newest first
+func (p *TrashPage) refresh() {
+	p.table.Clear()
+	p.entries = nil
+
+	for i, title := range []string{"Deleted", "File", "Folder", "Sidecars"} {
+		p.table.SetCell(0, i, &tview.TableCell{Text: title, Color: theme.TitleColor, NotSelectable: true})
+	}
+
+	if p.trash == nil {
+		p.bottom.SetText("The trash is disabled, deleted tracks are removed right away. Set trash.dir to enable it.")
+		return
+	}
+
+	entries, err := p.trash.Entries()
+	if err != nil {
+		log.WithError(err).Error("could not read trash")
+		p.bottom.SetText("Could not read the trash, see logs.")
+		return
+	}
+	p.entries = entries
+
+	for i, entry := range entries {
+		row := i + 1
+		p.table.SetCell(row, 0, &tview.TableCell{Text: entry.Deleted.Format("2006-01-02 15:04"), Color: theme.BorderColor})
+		p.table.SetCell(row, 1, &tview.TableCell{Text: filepath.Base(entry.Path), Color: theme.PrimaryTextColor, MaxWidth: 50, Expansion: 2})
+		p.table.SetCell(row, 2, &tview.TableCell{Text: filepath.Dir(entry.Path), Color: theme.SecondaryTextColor, MaxWidth: 60, Expansion: 2})
+		p.table.SetCell(row, 3, &tview.TableCell{Text: fmt.Sprintf("%d", len(entry.Sidecars)), Color: theme.BorderColor, Align: tview.AlignRight})
+	}
+
+	p.table.Select(1, 0).ScrollToBeginning()
+	p.help()
+}
+
+// hovered returns the entry on the selected row
+func (p *TrashPage) hovered() (library.TrashEntry, bool) {
+	row, _ := p.table.GetSelection()
+	if row < 1 || row > len(p.entries) {
+		return library.TrashEntry{}, false
+	}
+
+	return p.entries[row-1], true
+}
+
+// restore moves the hovered track back into the library
+func (p *TrashPage) restore(ctx context.Context) {
+	entry, ok := p.hovered()
+	if !ok {
+		return
+	}
+
+	err := p.tracks.restore(ctx, entry)
+	if err != nil {
+		log.WithError(err).WithField("path", entry.Path).Error("could not restore track")
+		p.bottom.SetText("Could not restore " + filepath.Base(entry.Path) + ", see logs.")
+		return
+	}
+
+	p.refresh()
+	p.bottom.SetText("Restored " + entry.Path)
+}
+
+// confirmPurge deletes the hovered track for good, after asking
+func (p *TrashPage) confirmPurge() {
+	entry, ok := p.hovered()
+	if !ok {
+		return
+	}
+
+	modal := tview.NewModal().
+		SetText(fmt.Sprintf("Delete for good? This can not be undone.\n\n%s", entry.Path)).
+		AddButtons([]string{"Purge", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			if buttonLabel == "Purge" {
+				err := p.trash.Purge(entry)
+				if err != nil {
+					log.WithError(err).WithField("path", entry.Path).Error("could not purge track")
+				} else {
+					log.WithField("path", entry.Path).Info("purged track")
+				}
+				p.refresh()
+			}
+			app.SetRoot(pages, true).SetFocus(p.table)
+		})
+
+	app.SetRoot(modal, false).SetFocus(modal)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/dhulihan/grump/internal/config"
 	"github.com/dhulihan/grump/library"
 	"github.com/dhulihan/grump/player"
 	"github.com/gdamore/tcell"
@@ -22,7 +23,14 @@ var (
 	deleteModal *tview.Modal
 	editForm    *tview.Form
 	editPage    *tview.Flex
+	batchForm   *tview.Form
+	batchPage   *tview.Flex
 	theme       *tview.Theme
+	conf        *config.Config
+	historyPage *HistoryPage
+	// pathTagsPage is opened from the track page
+	pathTagsPage *PathTagsPage
+	trashPage    *TrashPage
 )
 
 // BuildInfo contains build-time data for displaying version, etc.
@@ -31,14 +39,19 @@ type BuildInfo struct {
 	Commit  string
 }
 
-// Start starts the ui
-func Start(ctx context.Context, b BuildInfo, db *library.Library, musicPlayer player.AudioPlayer, loggers []io.Writer) error {
-	// hard code first for now
-	musicLibrary := db.AudioShelves[0]
+// Start starts the ui. Plays are recorded to history unless it is nil, and
+// deleted tracks can be restored from trash unless it is nil.
+func Start(ctx context.Context, b BuildInfo, c *config.Config, db *library.Library, musicPlayer player.AudioPlayer, history *library.History, trash *library.Trash) error {
 	app = tview.NewApplication()
 	build = b
-	start(ctx, musicLibrary, musicPlayer, loggers)
-	if err := app.Run(); err != nil {
+	conf = c
+	trackPage := start(ctx, db, musicPlayer, history, trash, c.Loggers())
+	err := app.Run()
+
+	// record the track that was playing on exit
+	trackPage.endPlay(false)
+
+	if err != nil {
 		return fmt.Errorf("Error running application: %s", err)
 	}
 
@@ -46,27 +59,53 @@ func Start(ctx context.Context, b BuildInfo, db *library.Library, musicPlayer pl
 }
 
 // start the ui
-func start(ctx context.Context, ml library.AudioShelf, pl player.AudioPlayer, loggers []io.Writer) {
+func start(ctx context.Context, ml library.AudioShelf, pl player.AudioPlayer, history *library.History, trash *library.Trash, loggers []io.Writer) *TrackPage {
 	theme = defaultTheme()
 	setupLoggers(loggers)
+	setupKeys(cfg().KeyboardShortcuts)
 
 	// Set up the pages
 	trackPage := NewTrackPage(ctx, ml, pl)
+	trackPage.history = history
+	trackPage.trash = trash
 	helpPage := NewHelpPage(ctx)
 	logsPage := NewLogsPage(ctx)
+	historyPage = NewHistoryPage(ctx, history)
+	pathTagsPage = NewPathTagsPage(ctx, trackPage)
+	trashPage = NewTrashPage(ctx, trash, trackPage)
 
 	editForm = tview.NewForm()
 	editPage = modalWrapper(editForm, 60, 20)
 
+	batchForm = tview.NewForm()
+	batchPage = modalWrapper(batchForm, 70, 25)
+
 	deleteModal = tview.NewModal()
 
 	pages = tview.NewPages().
 		AddPage("help", helpPage.Page(ctx), true, false).
 		AddPage("logs", logsPage.Page(ctx), true, false).
+		AddPage("history", historyPage.Page(ctx), true, false).
+		AddPage("pathtags", pathTagsPage.Page(ctx), true, false).
+		AddPage("trash", trashPage.Page(ctx), true, false).
 		AddPage("tracks", trackPage.Page(ctx), true, true).
-		AddPage("edit", editPage, true, false)
+		AddPage("edit", editPage, true, false).
+		AddPage("batch", batchPage, true, false)
 
 	app.SetRoot(pages, true).SetFocus(trackPage.trackList)
+	app.SetAfterDrawFunc(trackPage.artwork.afterDraw)
+
+	return trackPage
+}
+
+// cfg returns application config, falling back to defaults when the ui was
+// started without any (eg: in tests)
+func cfg() *config.Config {
+	if conf == nil {
+		return config.DefaultConfig()
+	}
+
+	return conf
 }
 
 func defaultTheme() *tview.Theme {
@@ -88,15 +127,20 @@ func defaultTheme() *tview.Theme {
 // globalInputCapture handles input and behavior that is the same across the
 // entire application
 var globalInputCapture = func(event *tcell.EventKey) *tcell.EventKey {
-	s := string(event.Rune())
-	switch s {
-	case "l":
+	switch keyBindings().action(event, scopeGlobal) {
+	case ActionLogs:
 		pages.SwitchToPage("logs")
-	case "t":
+	case ActionTracks:
 		pages.SwitchToPage("tracks")
-	case "?":
+	case ActionHistory:
+		historyPage.refresh()
+		pages.SwitchToPage("history")
+	case ActionTrash:
+		trashPage.refresh()
+		pages.SwitchToPage("trash")
+	case ActionHelp:
 		pages.SwitchToPage("help")
-	case "q":
+	case ActionQuit:
 		log.Info("exiting")
 		app.Stop()
 	}